@@ -0,0 +1,476 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"skv/internal/config"
+)
+
+// errPeerCredUnsupported is returned by peerUID on platforms without peer
+// credentials for Unix sockets.
+var errPeerCredUnsupported = errors.New("peer credentials are not supported on this platform")
+
+func newAgentCmd() *cobra.Command {
+	var socket string
+
+	c := &cobra.Command{
+		Use:   "agent",
+		Short: "Cache fetched secrets in a local agent",
+		Long: `Run a local agent that keeps fetched secrets in memory and serves them over
+a Unix socket, similar to ssh-agent.
+
+Start it with "skv agent serve" and set SKV_AGENT_SOCK to the printed socket
+path; get, run, export, render and materialize then ask the agent first and
+fetch from the providers themselves only when it is not available. The
+other subcommands control a running agent.
+
+Lock drops the cached values, for example when the screen locks. It is not
+a security boundary: any process of the same user can unlock the agent,
+and can fetch the secrets with the user's credentials anyway.`,
+		Args: cobra.NoArgs,
+	}
+	c.PersistentFlags().StringVar(&socket, "socket", "", "Agent socket (default: $SKV_AGENT_SOCK, else a per-user runtime path)")
+	sock := func() string {
+		if socket != "" {
+			return socket
+		}
+		if s := os.Getenv(agentSockEnv); s != "" {
+			return s
+		}
+		return defaultAgentSocket()
+	}
+
+	c.AddCommand(newAgentServeCmd(sock))
+	c.AddCommand(newAgentControlCmd(sock, agentOpStatus, "Show the agent's state and cached aliases"))
+	c.AddCommand(newAgentControlCmd(sock, agentOpLock, "Drop all cached values and refuse requests until unlocked"))
+	c.AddCommand(newAgentControlCmd(sock, agentOpUnlock, "Serve requests again after lock (needs no credential)"))
+	c.AddCommand(newAgentControlCmd(sock, agentOpFlush, "Drop all cached values"))
+	c.AddCommand(newAgentControlCmd(sock, agentOpRefresh, "Fetch the given aliases (default: all cached) again"))
+	return c
+}
+
+func newAgentServeCmd(sock func() string) *cobra.Command {
+	var (
+		ttlStr      string
+		timeoutStr  string
+		concurrency int
+		retries     int
+		retryDelay  string
+	)
+
+	c := &cobra.Command{
+		Use:   "serve",
+		Short: "Run the agent in the foreground",
+		Long: `Run the agent in the foreground until SIGINT or SIGTERM.
+
+Values are fetched on first use and kept in memory for --ttl. The socket is
+created with mode 0600 in a 0700 directory owned by the user; an existing
+directory that others can access is refused. Connections from other users
+are refused using the peer credentials of the socket.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			ttl, err := time.ParseDuration(ttlStr)
+			if err != nil || ttl <= 0 {
+				return exitCodeError{code: 2, err: fmt.Errorf("invalid --ttl: %q", ttlStr)}
+			}
+			timeout, err := time.ParseDuration(timeoutStr)
+			if err != nil || timeout <= 0 {
+				return exitCodeError{code: 2, err: fmt.Errorf("invalid --timeout: %q", timeoutStr)}
+			}
+			cfg, err := config.Load(cfgPath)
+			if err != nil {
+				return exitCodeError{code: 2, err: err}
+			}
+			path := sock()
+			ln, err := listenAgent(path)
+			if err != nil {
+				return exitCodeError{code: 5, err: err}
+			}
+			if !peerCredSupported {
+				slog.Warn("peer credentials are not available; access is limited by socket permissions only")
+			}
+
+			s := &agentServer{
+				cfg:      cfg,
+				ttl:      ttl,
+				timeout:  timeout,
+				uid:      os.Getuid(),
+				breakers: newConfigBreakers(cfg),
+				limits:   newLimiterSet(cfg),
+				newResolver: func() *secretResolver {
+					return newSecretResolver(cfg, concurrency, retries, parseRetryDelay(retryDelay))
+				},
+				entries: map[string]agentEntry{},
+			}
+			if _, err := fmt.Fprintf(cmd.OutOrStdout(), "%s=%s; export %s;\n", agentSockEnv, shellQuote(path), agentSockEnv); err != nil {
+				return err
+			}
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			slog.Info("secrets agent listening", "socket", path, "config", cfg.Path, "ttl", ttl)
+			s.serve(ctx, ln)
+			return nil
+		},
+	}
+
+	c.Flags().StringVar(&ttlStr, "ttl", "15m", "How long fetched values are kept")
+	c.Flags().StringVar(&timeoutStr, "timeout", "30s", "Timeout for fetching secrets per request")
+	c.Flags().IntVar(&concurrency, "concurrency", 4, "Number of concurrent provider calls per request")
+	c.Flags().IntVar(&retries, "retries", 0, "Number of retries on transient errors")
+	c.Flags().StringVar(&retryDelay, "retry-delay", "500ms", "Delay between retries (e.g., 200ms, 1s)")
+	return c
+}
+
+// newAgentControlCmd returns the subcommand sending op to a running agent.
+func newAgentControlCmd(sock func() string, op, short string) *cobra.Command {
+	use := op
+	args := cobra.NoArgs
+	if op == agentOpRefresh {
+		use, args = "refresh [alias...]", cobra.ArbitraryArgs
+	}
+	return &cobra.Command{
+		Use:   use,
+		Short: short,
+		Args:  args,
+		RunE: func(cmd *cobra.Command, aliases []string) error {
+			client := &agentClient{socket: sock()}
+			if op == agentOpRefresh {
+				// Refresh needs the configuration the agent serves.
+				cfg, err := config.Load(cfgPath)
+				if err != nil {
+					return exitCodeError{code: 2, err: err}
+				}
+				client.digest = cfg.Digest
+			}
+			resp, err := client.control(cmd.Context(), op, aliases)
+			if err != nil {
+				return exitCodeError{code: 5, err: fmt.Errorf("agent %s: %w", op, err)}
+			}
+			out := cmd.OutOrStdout()
+			switch op {
+			case agentOpStatus:
+				return printAgentStatus(out, resp.Status)
+			case agentOpRefresh:
+				names := make([]string, 0, len(resp.Errors))
+				for alias := range resp.Errors {
+					names = append(names, alias)
+				}
+				sort.Strings(names)
+				for _, alias := range names {
+					if e := resp.Errors[alias]; !e.Skipped {
+						return e.err(alias)
+					}
+				}
+				_, err = fmt.Fprintf(out, "refreshed %d secret(s)\n", len(resp.Sources))
+			default:
+				_, err = fmt.Fprintf(out, "agent: %s done\n", op)
+			}
+			return err
+		},
+	}
+}
+
+func printAgentStatus(w io.Writer, st *agentStatus) error {
+	if st == nil {
+		return errors.New("agent returned no status")
+	}
+	locked := "no"
+	if st.Locked {
+		locked = "yes"
+	}
+	if _, err := fmt.Fprintf(w, "Config: %s\nLocked: %s\nTTL: %s\nCached: %d\n", st.Config, locked, st.TTL, len(st.Entries)); err != nil {
+		return err
+	}
+	for _, e := range st.Entries {
+		if _, err := fmt.Fprintf(w, "  %s (%s, expires in %s)\n", e.Alias, e.Source, e.ExpiresIn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shellQuote quotes s for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// listenAgent creates the agent socket at path with mode 0600 in a 0700
+// directory owned by the user, and refuses a directory others can access.
+// A stale socket left by an agent that exited is replaced.
+func listenAgent(path string) (net.Listener, error) {
+	if err := privateDir(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	if _, err := os.Lstat(path); err == nil {
+		if c, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			_ = c.Close()
+			return nil, fmt.Errorf("an agent is already listening on %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("remove stale socket: %w", err)
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		_ = ln.Close()
+		return nil, fmt.Errorf("restrict socket: %w", err)
+	}
+	return ln, nil
+}
+
+// agentServer answers agent requests from an in-memory cache, fetching
+// values that are missing or expired.
+type agentServer struct {
+	cfg         *config.Config
+	ttl         time.Duration
+	timeout     time.Duration
+	uid         int
+	breakers    *breakerSet
+	limits      *limiterSet
+	newResolver func() *secretResolver
+
+	mu      sync.Mutex
+	locked  bool
+	entries map[string]agentEntry
+}
+
+// agentEntry is a cached value.
+type agentEntry struct {
+	value   string
+	source  string
+	expires time.Time
+}
+
+// serve accepts connections until ctx is done, then drops all values.
+func (s *agentServer) serve(ctx context.Context, ln net.Listener) {
+	go func() {
+		<-ctx.Done()
+		_ = ln.Close()
+	}()
+	expire := time.NewTicker(time.Minute)
+	defer expire.Stop()
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-expire.C:
+				s.dropExpired()
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Warn("agent accept failed", "error", err)
+				continue
+			}
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.handle(ctx, conn)
+		}()
+	}
+	wg.Wait()
+	s.flush()
+}
+
+// handle answers one request on conn after checking the peer's user.
+func (s *agentServer) handle(ctx context.Context, conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(s.timeout + 10*time.Second))
+	enc := json.NewEncoder(conn)
+	uid, err := peerUID(conn)
+	switch {
+	case errors.Is(err, errPeerCredUnsupported):
+	case err != nil:
+		slog.Warn("agent refused a connection: cannot read peer credentials", "error", err)
+		_ = enc.Encode(agentResponse{Error: "cannot verify peer"})
+		return
+	case uid != s.uid:
+		slog.Warn("agent refused a connection from another user", "uid", uid)
+		_ = enc.Encode(agentResponse{Error: "permission denied"})
+		return
+	}
+	var req agentRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		_ = enc.Encode(agentResponse{Error: "invalid request"})
+		return
+	}
+	_ = enc.Encode(s.process(ctx, req))
+}
+
+func (s *agentServer) process(ctx context.Context, req agentRequest) agentResponse {
+	switch req.Op {
+	case agentOpStatus:
+		return agentResponse{Status: s.status()}
+	case agentOpLock:
+		s.mu.Lock()
+		s.locked = true
+		s.entries = map[string]agentEntry{}
+		s.mu.Unlock()
+		slog.Info("agent locked")
+		return agentResponse{}
+	case agentOpUnlock:
+		// Any client of the same user may unlock: lock only drops values
+		// and is not an access control (see the agent help).
+		s.mu.Lock()
+		s.locked = false
+		s.mu.Unlock()
+		slog.Info("agent unlocked")
+		return agentResponse{}
+	case agentOpFlush:
+		s.flush()
+		return agentResponse{}
+	case agentOpGet, agentOpRefresh:
+	default:
+		return agentResponse{Error: fmt.Sprintf("unknown operation %q", req.Op)}
+	}
+
+	s.mu.Lock()
+	locked := s.locked
+	s.mu.Unlock()
+	switch {
+	case locked:
+		return agentResponse{Error: "agent is locked"}
+	case req.Digest != s.cfg.Digest:
+		return agentResponse{Error: "agent serves a different configuration: " + s.cfg.Path}
+	}
+	aliases := req.Aliases
+	if req.Op == agentOpRefresh {
+		aliases = s.drop(aliases)
+	}
+	resp := s.get(ctx, aliases)
+	if req.Op == agentOpRefresh {
+		resp.Values = nil
+	}
+	return resp
+}
+
+// get returns the values of aliases, fetching those not cached.
+func (s *agentServer) get(ctx context.Context, aliases []string) agentResponse {
+	resp := agentResponse{Values: map[string]string{}, Sources: map[string]string{}, Errors: map[string]agentAliasError{}}
+	now := time.Now()
+	var missing []string
+	s.mu.Lock()
+	for _, alias := range aliases {
+		if e, ok := s.entries[alias]; ok && now.Before(e.expires) {
+			resp.Values[alias], resp.Sources[alias] = e.value, e.source
+			continue
+		}
+		missing = append(missing, alias)
+	}
+	s.mu.Unlock()
+	if len(missing) == 0 {
+		return resp
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	resolver := s.newResolver()
+	resolver.breakers, resolver.limits = s.breakers, s.limits
+	type result struct {
+		value string
+		err   error
+	}
+	results := make([]result, len(missing))
+	var wg sync.WaitGroup
+	for i, alias := range missing {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := resolver.resolve(ctx, alias)
+			results[i] = result{v, err}
+		}()
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, alias := range missing {
+		if err := results[i].err; err != nil {
+			resp.Errors[alias] = newAgentAliasError(err)
+			continue
+		}
+		source := resolver.source(alias)
+		resp.Values[alias], resp.Sources[alias] = results[i].value, source
+		if !s.locked {
+			s.entries[alias] = agentEntry{value: results[i].value, source: source, expires: time.Now().Add(s.ttl)}
+		}
+	}
+	slog.Debug("agent fetched secrets", "aliases", missing)
+	return resp
+}
+
+// drop removes aliases from the cache, or every entry when aliases is
+// empty, and returns the aliases removed or requested.
+func (s *agentServer) drop(aliases []string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(aliases) == 0 {
+		for alias := range s.entries {
+			aliases = append(aliases, alias)
+		}
+		sort.Strings(aliases)
+	}
+	for _, alias := range aliases {
+		delete(s.entries, alias)
+	}
+	return aliases
+}
+
+func (s *agentServer) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = map[string]agentEntry{}
+}
+
+func (s *agentServer) dropExpired() {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for alias, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, alias)
+		}
+	}
+}
+
+func (s *agentServer) status() *agentStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := &agentStatus{Config: s.cfg.Path, Locked: s.locked, TTL: s.ttl.String(), Entries: []agentEntryStatus{}}
+	now := time.Now()
+	for alias, e := range s.entries {
+		if now.Before(e.expires) {
+			st.Entries = append(st.Entries, agentEntryStatus{Alias: alias, Source: e.source, ExpiresIn: e.expires.Sub(now).Round(time.Second).String()})
+		}
+	}
+	sort.Slice(st.Entries, func(i, j int) bool { return st.Entries[i].Alias < st.Entries[j].Alias })
+	return st
+}
+
@@ -0,0 +1,236 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"skv/internal/config"
+)
+
+// startTestAgent serves cfgPath on a socket in a temporary directory and
+// points SKV_AGENT_SOCK at it.
+func startTestAgent(t *testing.T) (*agentServer, string) {
+	t.Helper()
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := os.MkdirTemp("", "skv-agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	sock := filepath.Join(dir, "agent.sock")
+	ln, err := listenAgent(sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(sock); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("socket mode = %v, %v; want 0600", fi.Mode().Perm(), err)
+	}
+	s := &agentServer{
+		cfg:         cfg,
+		ttl:         time.Hour,
+		timeout:     5 * time.Second,
+		uid:         os.Getuid(),
+		breakers:    newBreakerSet(3, 30*time.Second),
+		newResolver: func() *secretResolver { return newSecretResolver(cfg, 4, 0, 0) },
+		entries:     map[string]agentEntry{},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.serve(ctx, ln)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	t.Setenv(agentSockEnv, sock)
+	return s, sock
+}
+
+func TestAgent(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secret, []byte("v1"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_ = newRootCmd()
+	cfgPath = writeTestConfig(t, "secrets:\n  - alias: token\n    provider: exec\n    name: "+secret+"\n    extras:\n      cmd: cat\n"+
+		"  - alias: short\n    provider: exec\n    name: "+secret+"\n    extras:\n      cmd: cat\n    validate:\n      min_length: 10\n")
+	_, sock := startTestAgent(t)
+
+	get := func(alias string) (string, error) {
+		t.Helper()
+		var out strings.Builder
+		c := newGetCmd()
+		c.SetOut(&out)
+		c.SetArgs([]string{alias})
+		err := c.Execute()
+		return out.String(), err
+	}
+	control := func(args ...string) string {
+		t.Helper()
+		var out strings.Builder
+		c := newAgentCmd()
+		c.SetOut(&out)
+		c.SetArgs(append(args, "--socket", sock))
+		if err := c.Execute(); err != nil {
+			t.Fatalf("agent %v: %v", args, err)
+		}
+		return out.String()
+	}
+	write := func(v string) {
+		t.Helper()
+		if err := os.WriteFile(secret, []byte(v), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if v, err := get("token"); err != nil || v != "v1" {
+		t.Fatalf("get = %q, %v; want v1", v, err)
+	}
+	write("v2")
+	if v, _ := get("token"); v != "v1" {
+		t.Fatalf("cached get = %q, want v1", v)
+	}
+	assertStringContains(t, control("status"), []string{"Locked: no", "Cached: 1", "token (exec"})
+
+	assertStringContains(t, control("refresh", "token"), []string{"refreshed 1 secret(s)"})
+	if v, _ := get("token"); v != "v2" {
+		t.Fatalf("get after refresh = %q, want v2", v)
+	}
+
+	write("v3")
+	control("flush")
+	if v, _ := get("token"); v != "v3" {
+		t.Fatalf("get after flush = %q, want v3", v)
+	}
+
+	// A locked agent serves nothing; get falls back to the provider.
+	control("lock")
+	assertStringContains(t, control("status"), []string{"Locked: yes", "Cached: 0"})
+	write("v4")
+	if v, err := get("token"); err != nil || v != "v4" {
+		t.Fatalf("get while locked = %q, %v; want v4", v, err)
+	}
+	client := newAgentClient(&config.Config{})
+	if _, _, err := client.get(context.Background(), "token"); !errors.Is(err, errAgentUnavailable) {
+		t.Fatalf("locked agent get = %v, want errAgentUnavailable", err)
+	}
+	control("unlock")
+
+	// Validation failures keep their type across the socket.
+	cfg, _ := config.Load(cfgPath)
+	_, _, err := newAgentClient(cfg).get(context.Background(), "short")
+	var verr *config.ValidationError
+	if !errors.As(err, &verr) || verr.Rule != "min_length" || exitCodeOf(err) != 6 {
+		t.Fatalf("get short = %v, want a min_length validation error with code 6", err)
+	}
+
+	// Another configuration is not served.
+	client.digest = "other"
+	if _, _, err := client.get(context.Background(), "token"); !errors.Is(err, errAgentUnavailable) || !strings.Contains(err.Error(), "different configuration") {
+		t.Fatalf("get with another config = %v", err)
+	}
+}
+
+func TestAgentSocket(t *testing.T) {
+	_ = newRootCmd()
+	registerMock("mock")
+	cfgPath = writeTestConfig(t, "secrets:\n  - alias: a\n    provider: mock\n    name: a\n    extras:\n      value: v\n")
+	_, sock := startTestAgent(t)
+	if _, err := listenAgent(sock); err == nil || !strings.Contains(err.Error(), "already listening") {
+		t.Fatalf("second listen = %v, want already listening", err)
+	}
+
+	// A socket left behind by an agent that exited is replaced.
+	stale := filepath.Join(filepath.Dir(sock), "stale.sock")
+	ln, err := listenAgent(stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ul, ok := ln.(interface{ SetUnlinkOnClose(bool) }); ok {
+		ul.SetUnlinkOnClose(false)
+	}
+	_ = ln.Close()
+	ln, err = listenAgent(stale)
+	if err != nil {
+		t.Fatalf("listen over stale socket: %v", err)
+	}
+	_ = ln.Close()
+
+	// Unreachable agents make clients fetch directly.
+	t.Setenv(agentSockEnv, filepath.Join(t.TempDir(), "missing.sock"))
+	var out strings.Builder
+	c := newGetCmd()
+	c.SetOut(&out)
+	c.SetArgs([]string{"a"})
+	if err := c.Execute(); err != nil || out.String() != "v" {
+		t.Fatalf("get without agent = %q, %v", out.String(), err)
+	}
+}
+
+func TestListenAgentPrivateDir(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, dir string) // prepares dir, which does not exist yet
+		wantErr string
+	}{
+		{"created", func(*testing.T, string) {}, ""},
+		{"existing 0700", func(t *testing.T, dir string) { mkdirMode(t, dir, 0o700) }, ""},
+		{"group readable", func(t *testing.T, dir string) { mkdirMode(t, dir, 0o750) }, "must be 0700"},
+		{"world writable", func(t *testing.T, dir string) { mkdirMode(t, dir, 0o777) }, "must be 0700"},
+		{"symlink", func(t *testing.T, dir string) {
+			target := filepath.Join(filepath.Dir(dir), "target")
+			mkdirMode(t, target, 0o700)
+			if err := os.Symlink(target, dir); err != nil {
+				t.Fatal(err)
+			}
+		}, "not a directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "skv")
+			tt.setup(t, dir)
+			ln, err := listenAgent(filepath.Join(dir, "agent.sock"))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("listenAgent() = %v", err)
+				}
+				_ = ln.Close()
+				if fi, err := os.Stat(dir); err != nil || fi.Mode().Perm() != 0o700 {
+					t.Errorf("directory mode = %v, %v; want 0700", fi.Mode().Perm(), err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				if ln != nil {
+					_ = ln.Close()
+				}
+				t.Fatalf("listenAgent() = %v, want error %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// mkdirMode creates dir with exactly mode, regardless of the umask.
+func mkdirMode(t *testing.T, dir string, mode os.FileMode) {
+	t.Helper()
+	if err := os.Mkdir(dir, mode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(dir, mode); err != nil {
+		t.Fatal(err)
+	}
+}
+
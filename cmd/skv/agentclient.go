@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"skv/internal/config"
+)
+
+// agentSockEnv names the variable holding the socket of a running agent.
+const agentSockEnv = "SKV_AGENT_SOCK"
+
+// Agent operations.
+const (
+	agentOpGet     = "get"
+	agentOpRefresh = "refresh"
+	agentOpFlush   = "flush"
+	agentOpLock    = "lock"
+	agentOpUnlock  = "unlock"
+	agentOpStatus  = "status"
+)
+
+// errAgentUnavailable means the agent could not serve a request, so the
+// caller should fetch from the providers itself.
+var errAgentUnavailable = errors.New("secrets agent unavailable")
+
+// agentRequest is one request to the agent, sent as a JSON line.
+type agentRequest struct {
+	Op      string   `json:"op"`
+	Digest  string   `json:"digest,omitempty"` // configuration the client uses
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+// agentResponse answers an agentRequest. Error is set when the request as
+// a whole failed; Errors holds per-alias failures.
+type agentResponse struct {
+	Values  map[string]string          `json:"values,omitempty"`
+	Sources map[string]string          `json:"sources,omitempty"`
+	Errors  map[string]agentAliasError `json:"errors,omitempty"`
+	Error   string                     `json:"error,omitempty"`
+	Status  *agentStatus               `json:"status,omitempty"`
+}
+
+type agentAliasError struct {
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+	Skipped bool   `json:"skipped,omitempty"` // optional secret that was unavailable
+	Rule    string `json:"rule,omitempty"`    // failed validation rule
+	Reason  string `json:"reason,omitempty"`
+}
+
+// newAgentAliasError encodes err for the wire.
+func newAgentAliasError(err error) agentAliasError {
+	e := agentAliasError{Message: err.Error(), Code: exitCodeOf(err)}
+	var skipped skippedError
+	e.Skipped = errors.As(err, &skipped)
+	var verr *config.ValidationError
+	if errors.As(err, &verr) {
+		e.Rule, e.Reason = verr.Rule, verr.Reason
+	}
+	return e
+}
+
+// err decodes e for alias.
+func (e agentAliasError) err(alias string) error {
+	switch {
+	case e.Skipped:
+		return skippedError{err: errors.New(e.Message)}
+	case e.Rule != "":
+		return exitCodeError{code: e.Code, err: fmt.Errorf("%s: %w", alias, &config.ValidationError{Rule: e.Rule, Reason: e.Reason})}
+	}
+	return exitCodeError{code: e.Code, err: errors.New(e.Message)}
+}
+
+type agentStatus struct {
+	Config  string             `json:"config"`
+	Locked  bool               `json:"locked"`
+	TTL     string             `json:"ttl"`
+	Entries []agentEntryStatus `json:"entries"`
+}
+
+type agentEntryStatus struct {
+	Alias     string `json:"alias"`
+	Source    string `json:"source"`
+	ExpiresIn string `json:"expires_in"`
+}
+
+// agentClient talks to the agent listening on socket.
+type agentClient struct {
+	socket string
+	digest string
+}
+
+// newAgentClient returns a client for the agent named by SKV_AGENT_SOCK,
+// or nil when it is not set.
+func newAgentClient(cfg *config.Config) *agentClient {
+	sock := os.Getenv(agentSockEnv)
+	if sock == "" {
+		return nil
+	}
+	return &agentClient{socket: sock, digest: cfg.Digest}
+}
+
+// defaultAgentSocket returns where the agent listens unless told otherwise:
+// $XDG_RUNTIME_DIR/skv/agent.sock, else a per-user directory in the
+// system temp directory.
+func defaultAgentSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "skv", "agent.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("skv-%d", os.Getuid()), "agent.sock")
+}
+
+// call sends req and returns the response. Connection failures wrap
+// errAgentUnavailable.
+func (c *agentClient) call(ctx context.Context, req agentRequest) (agentResponse, error) {
+	var resp agentResponse
+	d := net.Dialer{Timeout: 2 * time.Second}
+	conn, err := d.DialContext(ctx, "unix", c.socket)
+	if err != nil {
+		return resp, fmt.Errorf("%w: %v", errAgentUnavailable, err)
+	}
+	defer func() { _ = conn.Close() }()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(2 * time.Minute)
+	}
+	_ = conn.SetDeadline(deadline)
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return resp, fmt.Errorf("%w: %v", errAgentUnavailable, err)
+	}
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return resp, fmt.Errorf("%w: %v", errAgentUnavailable, err)
+	}
+	return resp, nil
+}
+
+// control sends an operation that returns no values.
+func (c *agentClient) control(ctx context.Context, op string, aliases []string) (agentResponse, error) {
+	resp, err := c.call(ctx, agentRequest{Op: op, Digest: c.digest, Aliases: aliases})
+	if err != nil {
+		return resp, err
+	}
+	if resp.Error != "" {
+		return resp, errors.New(resp.Error)
+	}
+	return resp, nil
+}
+
+// get returns the value of alias and its source. An agent that is not
+// running, locked or serving another configuration returns an error
+// wrapping errAgentUnavailable.
+func (c *agentClient) get(ctx context.Context, alias string) (string, string, error) {
+	resp, err := c.call(ctx, agentRequest{Op: agentOpGet, Digest: c.digest, Aliases: []string{alias}})
+	if err != nil {
+		return "", "", err
+	}
+	if resp.Error != "" {
+		return "", "", fmt.Errorf("%w: %s", errAgentUnavailable, resp.Error)
+	}
+	if e, ok := resp.Errors[alias]; ok {
+		return "", "", e.err(alias)
+	}
+	val, ok := resp.Values[alias]
+	if !ok {
+		return "", "", fmt.Errorf("%w: no value for %s", errAgentUnavailable, alias)
+	}
+	return val, "agent: " + resp.Sources[alias], nil
+}
+
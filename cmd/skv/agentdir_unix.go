@@ -0,0 +1,36 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// privateDir creates dir with mode 0700, or checks that an existing dir is
+// a real directory owned by the current user that no one else can access.
+// The agent socket is only reachable through it, including in the moment
+// before the socket itself is restricted.
+func privateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("create socket directory: %w", err)
+	}
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return fmt.Errorf("check socket directory: %w", err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("socket directory %s is not a directory", dir)
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return errors.New("check socket directory: no owner information")
+	}
+	if int(st.Uid) != os.Getuid() || fi.Mode().Perm()&0o077 != 0 {
+		return fmt.Errorf("socket directory %s has mode %04o and owner %d; it must be 0700 and owned by uid %d", dir, fi.Mode().Perm(), st.Uid, os.Getuid())
+	}
+	return nil
+}
+
@@ -0,0 +1,18 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// privateDir creates dir. Windows has no POSIX modes; access follows the
+// ACLs inherited from the user's profile directory.
+func privateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("create socket directory: %w", err)
+	}
+	return nil
+}
+
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newCircuitBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	steps := []struct {
+		name      string
+		action    func()
+		wantAllow bool
+		wantState string
+	}{
+		{"starts closed", func() {}, true, breakerClosed},
+		{"one failure stays closed", b.failure, true, breakerClosed},
+		{"threshold opens", b.failure, false, breakerOpen},
+		{"cooldown elapses", func() { now = now.Add(time.Minute) }, true, breakerHalfOpen},
+		{"only one trial in half-open", func() {}, false, breakerHalfOpen},
+		{"failed trial reopens", b.failure, false, breakerOpen},
+		{"second cooldown", func() { now = now.Add(time.Minute) }, true, breakerHalfOpen},
+		{"successful trial closes", b.success, true, breakerClosed},
+	}
+	for _, s := range steps {
+		s.action()
+		if got := b.state(); got != s.wantState {
+			t.Fatalf("%s: state = %s, want %s", s.name, got, s.wantState)
+		}
+		if got := b.allow(); got != s.wantAllow {
+			t.Fatalf("%s: allow = %v, want %v", s.name, got, s.wantAllow)
+		}
+	}
+}
+
+func TestBreakerSetKeys(t *testing.T) {
+	set := newBreakerSet(1, time.Minute)
+	set.get("aws/us-east-1").failure()
+	if set.get("aws/us-east-1") != set.get("aws/us-east-1") {
+		t.Fatal("get() should return the same breaker for a key")
+	}
+	want := map[string]string{"aws/us-east-1": breakerOpen, "aws/us-west-2": breakerClosed}
+	set.get("aws/us-west-2")
+	got := set.states()
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("states()[%s] = %s, want %s", k, got[k], v)
+		}
+	}
+}
+
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"skv/internal/config"
+)
+
+func newCacheCmd() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "cache",
+		Short: "Inspect and purge the on-disk cache",
+		Long: `Inspect and purge the encrypted on-disk cache of fetched values.
+
+The cache is enabled with cache.enabled in the configuration. Values are
+never printed; ls shows only what is cached and until when it is fresh.`,
+		Args: cobra.NoArgs,
+	}
+	c.AddCommand(newCacheLsCmd())
+	c.AddCommand(newCachePurgeCmd())
+	return c
+}
+
+func newCacheLsCmd() *cobra.Command {
+	var all bool
+	c := &cobra.Command{
+		Use:   "ls",
+		Short: "List cached secrets without their values",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, err := config.Load(cfgPath)
+			if err != nil {
+				return exitCodeError{code: 2, err: err}
+			}
+			entries, dir, err := cacheEntries(cfg, all)
+			if err != nil {
+				return err
+			}
+			return printCacheEntries(cmd.OutOrStdout(), dir, entries, all, time.Now())
+		},
+	}
+	c.Flags().BoolVar(&all, "all", false, "List entries of every configuration, not just the current one")
+	return c
+}
+
+func newCachePurgeCmd() *cobra.Command {
+	var all, expired bool
+	c := &cobra.Command{
+		Use:   "purge [alias...]",
+		Short: "Delete cached secrets",
+		Long: `Delete cached secrets of the current configuration, or only the given
+aliases. With --all every entry is deleted, along with the passphrase
+parameters, so the cache can be used with a new passphrase.`,
+		RunE: func(cmd *cobra.Command, aliases []string) error {
+			if all && len(aliases) > 0 {
+				return exitCodeError{code: 2, err: errors.New("--all cannot be combined with aliases")}
+			}
+			cfg, err := config.Load(cfgPath)
+			if err != nil {
+				return exitCodeError{code: 2, err: err}
+			}
+			entries, dir, err := cacheEntries(cfg, all)
+			if err != nil {
+				return err
+			}
+			now := time.Now()
+			removed := 0
+			for _, e := range entries {
+				if len(aliases) > 0 && !slices.Contains(aliases, e.Alias) {
+					continue
+				}
+				if expired && e.fresh(now) {
+					continue
+				}
+				if err := os.Remove(e.file); err != nil && !errors.Is(err, os.ErrNotExist) {
+					return exitCodeError{code: 5, err: fmt.Errorf("purge %s: %w", e.Alias, err)}
+				}
+				removed++
+			}
+			if all && !expired {
+				if err := os.Remove(filepath.Join(dir, cacheKeyFile)); err != nil && !errors.Is(err, os.ErrNotExist) {
+					return exitCodeError{code: 5, err: fmt.Errorf("purge key parameters: %w", err)}
+				}
+			}
+			_, err = fmt.Fprintf(cmd.OutOrStdout(), "purged %d cached secret(s)\n", removed)
+			return err
+		},
+	}
+	c.Flags().BoolVar(&all, "all", false, "Delete the entries of every configuration")
+	c.Flags().BoolVar(&expired, "expired", false, "Delete only entries that are no longer fresh")
+	return c
+}
+
+// cacheEntries returns the cache directory and its entries, limited to the
+// configuration cfg was loaded from unless all is set.
+func cacheEntries(cfg *config.Config, all bool) ([]*cacheEntry, string, error) {
+	dir, err := cacheDir(cfg)
+	if err != nil {
+		return nil, "", exitCodeError{code: 2, err: err}
+	}
+	entries, err := readCacheEntries(dir)
+	if err != nil {
+		return nil, dir, exitCodeError{code: 5, err: fmt.Errorf("read cache: %w", err)}
+	}
+	if !all {
+		entries = slices.DeleteFunc(entries, func(e *cacheEntry) bool { return e.Config != cfg.Path })
+	}
+	return entries, dir, nil
+}
+
+func printCacheEntries(w io.Writer, dir string, entries []*cacheEntry, all bool, now time.Time) error {
+	if _, err := fmt.Fprintf(w, "Cache: %s\nCached: %d\n", dir, len(entries)); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		state := "expires in " + e.ExpiresAt.Sub(now).Round(time.Second).String()
+		if !e.fresh(now) {
+			state = "expired " + now.Sub(e.ExpiresAt).Round(time.Second).String() + " ago"
+		}
+		line := fmt.Sprintf("  %s (%s, fetched %s, %s)", e.Alias, e.Source, e.FetchedAt.Local().Format(time.RFC3339), state)
+		if all {
+			line += " " + e.Config
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
@@ -0,0 +1,179 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"skv/internal/config"
+)
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret")
+	write := func(v string) {
+		t.Helper()
+		if err := os.WriteFile(secret, []byte(v), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("first-value")
+	old := cacheKDFIterations
+	cacheKDFIterations = 1000
+	t.Cleanup(func() { cacheKDFIterations = old })
+	t.Setenv(cachePassphraseEnv, "correct horse")
+	t.Setenv(offlineEnv, "")
+	t.Setenv(agentSockEnv, "")
+
+	_ = newRootCmd()
+	cacheDir := filepath.Join(dir, "cache")
+	cfgPath = writeTestConfig(t, "cache:\n  enabled: true\n  dir: "+cacheDir+"\n  ttl: 1h\n"+
+		"secrets:\n"+
+		"  - alias: token\n    provider: exec\n    name: "+secret+"\n    extras:\n      cmd: cat\n"+
+		"  - alias: live\n    provider: exec\n    name: "+secret+"\n    cache_ttl: 0s\n    extras:\n      cmd: cat\n"+
+		"  - alias: never\n    provider: exec\n    name: "+secret+".missing\n    extras:\n      cmd: cat\n")
+
+	get := func(alias string) (string, error) {
+		t.Helper()
+		var out strings.Builder
+		c := newGetCmd()
+		c.SetOut(&out)
+		c.SetArgs([]string{alias})
+		err := c.Execute()
+		return out.String(), err
+	}
+	cache := func(args ...string) string {
+		t.Helper()
+		var out strings.Builder
+		c := newCacheCmd()
+		c.SetOut(&out)
+		c.SetArgs(args)
+		if err := c.Execute(); err != nil {
+			t.Fatalf("cache %v: %v", args, err)
+		}
+		return out.String()
+	}
+
+	for _, alias := range []string{"token", "live"} {
+		if v, err := get(alias); err != nil || v != "first-value" {
+			t.Fatalf("get %s = %q, %v; want first-value", alias, v, err)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(cacheDir, cacheFileName(cfgPath, "token")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "first-value") {
+		t.Fatal("cache entry contains the plaintext value")
+	}
+
+	// Fresh values are served without asking the provider; a TTL of 0
+	// always asks.
+	write("v2")
+	if v, _ := get("token"); v != "first-value" {
+		t.Fatalf("fresh get = %q, want first-value", v)
+	}
+	if v, _ := get("live"); v != "v2" {
+		t.Fatalf("live get = %q, want v2", v)
+	}
+
+	// A failing provider falls back to the stale value.
+	if err := os.Remove(secret); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := get("live"); err != nil || v != "v2" {
+		t.Fatalf("stale get = %q, %v; want v2", v, err)
+	}
+
+	// Offline, only the cache is used.
+	offline = true
+	t.Cleanup(func() { offline = false })
+	if v, err := get("live"); err != nil || v != "v2" {
+		t.Fatalf("offline get = %q, %v; want v2", v, err)
+	}
+	if _, err := get("never"); exitCodeOf(err) != 4 {
+		t.Fatalf("offline get of uncached alias: err = %v, want exit code 4", err)
+	}
+	offline = false
+
+	// A wrong passphrase is a miss online and an error offline.
+	t.Setenv(cachePassphraseEnv, "wrong")
+	write("v3")
+	if v, err := get("token"); err != nil || v != "v3" {
+		t.Fatalf("get with wrong passphrase = %q, %v; want v3", v, err)
+	}
+	t.Setenv(offlineEnv, "1")
+	if _, err := get("token"); exitCodeOf(err) != 2 {
+		t.Fatalf("offline get with wrong passphrase: err = %v, want exit code 2", err)
+	}
+	t.Setenv(offlineEnv, "")
+	t.Setenv(cachePassphraseEnv, "correct horse")
+
+	out := cache("ls")
+	assertStringContains(t, out, []string{"Cached: 2", "token (exec", "live (exec", "expires in", "expired"})
+	if strings.Contains(out, "first-value") || strings.Contains(out, "v2") {
+		t.Fatalf("cache ls printed a value:\n%s", out)
+	}
+	assertStringContains(t, cache("purge", "--expired"), []string{"purged 1 cached secret(s)"})
+	assertStringContains(t, cache("purge", "token"), []string{"purged 1 cached secret(s)"})
+	assertStringContains(t, cache("ls"), []string{"Cached: 0"})
+
+	cache("purge", "--all")
+	if _, err := os.Stat(filepath.Join(cacheDir, cacheKeyFile)); !os.IsNotExist(err) {
+		t.Fatalf("purge --all kept the key parameters: %v", err)
+	}
+}
+
+func TestOpenCacheOffline(t *testing.T) {
+	t.Setenv(offlineEnv, "1")
+	tests := []struct {
+		name     string
+		cache    config.CacheConfig
+		watching bool
+	}{
+		{name: "cache disabled"},
+		{name: "watching", cache: config.CacheConfig{Enabled: true}, watching: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := openCache(&config.Config{Cache: tt.cache}, tt.watching); exitCodeOf(err) != 2 {
+				t.Fatalf("openCache() err = %v, want exit code 2", err)
+			}
+		})
+	}
+}
+
+func TestCacheOfflineSkipsAgent(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secret, []byte("live-value"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	old := cacheKDFIterations
+	cacheKDFIterations = 1000
+	t.Cleanup(func() { cacheKDFIterations = old })
+	t.Setenv(cachePassphraseEnv, "correct horse")
+	t.Setenv(offlineEnv, "1")
+
+	_ = newRootCmd()
+	cfgPath = writeTestConfig(t, "cache:\n  enabled: true\n  dir: "+filepath.Join(dir, "cache")+"\n  ttl: 1h\n"+
+		"secrets:\n  - alias: token\n    provider: exec\n    name: "+secret+"\n    extras:\n      cmd: cat\n")
+	agent, _ := startTestAgent(t)
+
+	var out strings.Builder
+	c := newGetCmd()
+	c.SetOut(&out)
+	c.SetArgs([]string{"token"})
+	if err := c.Execute(); exitCodeOf(err) != 4 || strings.Contains(out.String(), "live-value") {
+		t.Fatalf("offline get = %q, %v; want exit code 4", out.String(), err)
+	}
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+	if len(agent.entries) != 0 {
+		t.Fatalf("offline get fetched through the agent: %d entries", len(agent.entries))
+	}
+}
+
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"skv/internal/config"
+)
+
+// Environment variables read by the cache.
+const (
+	cachePassphraseEnv = "SKV_CACHE_PASSPHRASE"
+	offlineEnv         = "SKV_OFFLINE"
+)
+
+// cacheKeyFile holds the passphrase salt in the cache directory.
+const cacheKeyFile = "key.json"
+
+// cacheKDFIterations is the PBKDF2-SHA256 work factor for new passphrase
+// keys. The count is stored with the salt, so changing it only affects
+// caches created afterwards.
+var cacheKDFIterations = 600000
+
+// keyringService names the OS keyring item holding the cache key.
+const keyringService = "skv-cache"
+
+// cacheEntry is one cached value as stored on disk. Everything but the
+// ciphertext is readable without the key so `skv cache ls` can list
+// entries; it is authenticated as additional data.
+type cacheEntry struct {
+	Alias       string    `json:"alias"`
+	Config      string    `json:"config"`
+	Source      string    `json:"source"`
+	Fingerprint string    `json:"fingerprint"` // keyed hash of the secret definition
+	FetchedAt   time.Time `json:"fetched_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Nonce       []byte    `json:"nonce,omitempty"`
+	Ciphertext  []byte    `json:"ciphertext,omitempty"`
+
+	file string // set when read from disk
+}
+
+// fresh reports whether e can be served without asking the provider.
+func (e *cacheEntry) fresh(now time.Time) bool { return now.Before(e.ExpiresAt) }
+
+func (e *cacheEntry) additionalData() []byte {
+	meta := *e
+	meta.Nonce, meta.Ciphertext = nil, nil
+	data, _ := json.Marshal(meta)
+	return data
+}
+
+// cachedValue is a decrypted cache entry.
+type cachedValue struct {
+	value string
+	entry *cacheEntry
+}
+
+// secretCache stores fetched values encrypted with AES-256-GCM, one file
+// per alias and configuration.
+type secretCache struct {
+	dir      string
+	config   string
+	aead     cipher.AEAD
+	macKey   []byte
+	offline  bool          // serve only from the cache
+	maxStale time.Duration // 0 means stale values are served regardless of age
+}
+
+// offlineMode reports whether --offline or SKV_OFFLINE is set.
+func offlineMode() bool {
+	if offline {
+		return true
+	}
+	v, _ := strconv.ParseBool(os.Getenv(offlineEnv))
+	return v
+}
+
+// openCache opens the on-disk cache when the configuration enables it.
+// Without one it returns nil, unless --offline asks to serve from it.
+// Callers that watch for rotations pass watching and get no cache.
+func openCache(cfg *config.Config, watching bool) (*secretCache, error) {
+	off := offlineMode()
+	switch {
+	case off && watching:
+		return nil, exitCodeError{code: 2, err: errors.New("--offline cannot be used with --watch")}
+	case watching:
+		return nil, nil
+	case !cfg.Cache.Enabled && off:
+		return nil, exitCodeError{code: 2, err: errors.New("--offline needs the cache; set cache.enabled in the configuration")}
+	case !cfg.Cache.Enabled:
+		return nil, nil
+	}
+	c, err := newSecretCache(cfg)
+	if err != nil {
+		if off {
+			return nil, exitCodeError{code: 2, err: err}
+		}
+		slog.Warn("cache unavailable, fetching from providers", "error", err)
+		return nil, nil
+	}
+	c.offline = off
+	return c, nil
+}
+
+func newSecretCache(cfg *config.Config) (*secretCache, error) {
+	dir, err := cacheDir(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create cache directory: %w", err)
+	}
+	key, err := loadCacheKey(cfg.Cache.Key, dir)
+	if err != nil {
+		return nil, err
+	}
+	encKey, err := hkdf.Key(sha256.New, key, nil, "skv cache encryption", 32)
+	if err != nil {
+		return nil, err
+	}
+	macKey, err := hkdf.Key(sha256.New, key, nil, "skv cache fingerprint", 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &secretCache{
+		dir:      dir,
+		config:   cfg.Path,
+		aead:     aead,
+		macKey:   macKey,
+		maxStale: cfg.Cache.MaxStaleDuration(),
+	}, nil
+}
+
+// cacheDir returns cache.dir, else skv in the user cache directory.
+func cacheDir(cfg *config.Config) (string, error) {
+	if cfg.Cache.Dir != "" {
+		return cfg.Cache.Dir, nil
+	}
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("locate cache directory: %w", err)
+	}
+	return filepath.Join(base, "skv"), nil
+}
+
+// cacheFileName names the file caching alias of the configuration at path.
+func cacheFileName(path, alias string) string {
+	sum := sha256.Sum256([]byte(path + "\x00" + alias))
+	return hex.EncodeToString(sum[:20]) + ".json"
+}
+
+// fingerprint identifies the definition of s and its TTL, so entries are
+// ignored once the secret is reconfigured.
+func (c *secretCache) fingerprint(s *config.Secret, ttl time.Duration) string {
+	def, err := json.Marshal(s)
+	if err != nil {
+		// Pointers make this differ between runs, so the entry never matches.
+		def = fmt.Appendf(nil, "%+v", *s)
+	}
+	mac := hmac.New(sha256.New, c.macKey)
+	mac.Write(def)
+	mac.Write([]byte(ttl.String()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// get returns the cached value of s. Entries that are missing, for another
+// definition or cannot be decrypted are misses.
+func (c *secretCache) get(s *config.Secret, ttl time.Duration) (cachedValue, bool) {
+	path := filepath.Join(c.dir, cacheFileName(c.config, s.Alias))
+	e, err := readCacheEntry(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("ignoring unreadable cache entry", "alias", s.Alias, "error", err)
+		}
+		return cachedValue{}, false
+	}
+	if e.Alias != s.Alias || e.Config != c.config || !hmac.Equal([]byte(e.Fingerprint), []byte(c.fingerprint(s, ttl))) {
+		slog.Debug("cache entry is for another definition", "alias", s.Alias)
+		return cachedValue{}, false
+	}
+	plain, err := c.aead.Open(nil, e.Nonce, e.Ciphertext, e.additionalData())
+	if err != nil {
+		slog.Warn("ignoring cache entry that cannot be decrypted", "alias", s.Alias)
+		return cachedValue{}, false
+	}
+	return cachedValue{value: string(plain), entry: e}, true
+}
+
+// put stores val for s, fresh for ttl.
+func (c *secretCache) put(s *config.Secret, ttl time.Duration, val, source string) error {
+	now := time.Now().UTC()
+	e := &cacheEntry{
+		Alias:       s.Alias,
+		Config:      c.config,
+		Source:      source,
+		Fingerprint: c.fingerprint(s, ttl),
+		FetchedAt:   now,
+		ExpiresAt:   now.Add(ttl),
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	e.Nonce = nonce
+	e.Ciphertext = c.aead.Seal(nil, nonce, []byte(val), e.additionalData())
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(c.dir, cacheFileName(c.config, s.Alias)), data, 0o600, -1, -1)
+}
+
+// usable reports whether a stale entry may stand in for a failed fetch.
+func (c *secretCache) usable(e *cacheEntry, now time.Time) bool {
+	return c.maxStale <= 0 || now.Sub(e.FetchedAt) <= c.maxStale
+}
+
+func readCacheEntry(path string) (*cacheEntry, error) {
+	// #nosec G304 - path is inside the cache directory
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", filepath.Base(path), err)
+	}
+	e.file = path
+	return &e, nil
+}
+
+// readCacheEntries returns the entries in dir, sorted by configuration and
+// alias. Unreadable files are skipped.
+func readCacheEntries(dir string) ([]*cacheEntry, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var entries []*cacheEntry
+	for _, name := range names {
+		if filepath.Base(name) == cacheKeyFile {
+			continue
+		}
+		e, err := readCacheEntry(name)
+		if err != nil {
+			slog.Debug("skipping cache file", "file", name, "error", err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Config != entries[j].Config {
+			return entries[i].Config < entries[j].Config
+		}
+		return entries[i].Alias < entries[j].Alias
+	})
+	return entries, nil
+}
+
+// loadCacheKey returns the 32-byte cache key from the configured source.
+// auto uses the passphrase when SKV_CACHE_PASSPHRASE is set and the OS
+// keyring otherwise.
+func loadCacheKey(source, dir string) ([]byte, error) {
+	pass := os.Getenv(cachePassphraseEnv)
+	switch source {
+	case config.CacheKeyPassphrase:
+		if pass == "" {
+			return nil, fmt.Errorf("cache.key is passphrase but %s is not set", cachePassphraseEnv)
+		}
+		return passphraseKey(pass, dir)
+	case config.CacheKeyKeyring:
+		return keyringKey()
+	}
+	if pass != "" {
+		return passphraseKey(pass, dir)
+	}
+	return keyringKey()
+}
+
+// passphraseParams is stored in the cache directory so the same key is
+// derived again. Check lets a wrong passphrase be reported as such.
+type passphraseParams struct {
+	Salt       []byte `json:"salt"`
+	Iterations int    `json:"iterations"`
+	Check      string `json:"check"`
+}
+
+// passphraseKey derives the key from pass with PBKDF2-SHA256, creating the
+// salt on first use.
+func passphraseKey(pass, dir string) ([]byte, error) {
+	path := filepath.Join(dir, cacheKeyFile)
+	var p passphraseParams
+	// #nosec G304 - path is inside the cache directory
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		p.Salt = make([]byte, 16)
+		if _, err := rand.Read(p.Salt); err != nil {
+			return nil, err
+		}
+		p.Iterations = cacheKDFIterations
+	case err != nil:
+		return nil, fmt.Errorf("read cache key parameters: %w", err)
+	default:
+		if err := json.Unmarshal(data, &p); err != nil || len(p.Salt) == 0 || p.Iterations <= 0 {
+			return nil, fmt.Errorf("invalid cache key parameters in %s", path)
+		}
+	}
+	key, err := pbkdf2.Key(sha256.New, pass, p.Salt, p.Iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("skv cache key check"))
+	check := hex.EncodeToString(mac.Sum(nil))
+	if p.Check != "" {
+		if !hmac.Equal([]byte(check), []byte(p.Check)) {
+			return nil, fmt.Errorf("%s does not match the passphrase the cache was created with; run `skv cache purge --all` to start over", cachePassphraseEnv)
+		}
+		return key, nil
+	}
+	p.Check = check
+	if data, err = json.Marshal(p); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(path, data, 0o600, -1, -1); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// keyringKey returns the cache key stored in the OS keyring, creating a
+// random one on first use. macOS uses the login keychain through
+// security(1) and Linux the Secret Service through secret-tool(1).
+func keyringKey() ([]byte, error) {
+	account := "skv"
+	if u, err := user.Current(); err == nil {
+		account = u.Username
+	}
+	if enc, err := keyringLookup(account); err == nil && enc != "" {
+		key, err := base64.StdEncoding.DecodeString(enc)
+		if err != nil || len(key) != 32 {
+			return nil, errors.New("invalid cache key in the OS keyring")
+		}
+		return key, nil
+	} else if errors.Is(err, errors.ErrUnsupported) {
+		return nil, fmt.Errorf("no OS keyring support on %s; set %s to use a passphrase", runtime.GOOS, cachePassphraseEnv)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := keyringStore(account, base64.StdEncoding.EncodeToString(key)); err != nil {
+		return nil, fmt.Errorf("store cache key in the OS keyring: %w; set %s to use a passphrase", err, cachePassphraseEnv)
+	}
+	return key, nil
+}
+
+func keyringLookup(account string) (string, error) {
+	var c *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		c = exec.Command("security", "find-generic-password", "-s", keyringService, "-a", account, "-w")
+	case "linux":
+		c = exec.Command("secret-tool", "lookup", "service", keyringService, "account", account)
+	default:
+		return "", errors.ErrUnsupported
+	}
+	var out bytes.Buffer
+	c.Stdout = &out
+	err := runCommand(c)
+	return strings.TrimSpace(out.String()), err
+}
+
+// keyringStore saves secret in the keyring. The secret is written to the
+// tool's standard input so it never appears in a process listing.
+func keyringStore(account, secret string) error {
+	var c *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		c = exec.Command("security", "-i")
+		c.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %q -a %q -w %q\n", keyringService, account, secret))
+	case "linux":
+		c = exec.Command("secret-tool", "store", "--label=skv cache key", "service", keyringService, "account", account)
+		c.Stdin = strings.NewReader(secret)
+	default:
+		return errors.ErrUnsupported
+	}
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	if err := runCommand(c); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"time"
+)
+
+// childOptions controls how runChild supervises the child process.
+type childOptions struct {
+	processGroup bool          // run the child in its own process group and signal the group
+	gracePeriod  time.Duration // wait this long after a terminating signal before SIGKILL; 0 waits forever
+	interactive  bool          // stdin is a terminal, so SIGINT already reached the child
+}
+
+// runChild starts cmd, relays signals received by skv to it, and waits for
+// it to exit. It returns the child's exit code (128+N when it was killed by
+// signal N); err is set only when the child could not be started or waited
+// for. When skv runs as PID 1 it also reaps orphaned processes.
+func runChild(cmd *exec.Cmd, opts childOptions) (int, error) {
+	configureChild(cmd, opts.processGroup)
+
+	sigs := make(chan os.Signal, 8)
+	signal.Notify(sigs, forwardedSignals...)
+	defer signal.Stop(sigs)
+
+	if err := startChild(cmd); err != nil {
+		return 0, err
+	}
+
+	type result struct {
+		code int
+		err  error
+	}
+	exited := make(chan result, 1)
+	go func() {
+		code, err := waitChild(cmd)
+		exited <- result{code, err}
+	}()
+
+	var kill <-chan time.Time
+	for {
+		select {
+		case res := <-exited:
+			return res.code, res.err
+		case sig := <-sigs:
+			// A terminal delivers SIGINT to the whole foreground process
+			// group; relaying it again would look like a second Ctrl+C.
+			if sig == os.Interrupt && opts.interactive && !opts.processGroup {
+				slog.Debug("child received interrupt from the terminal")
+			} else if err := signalChild(cmd.Process, sig, opts.processGroup); err != nil && !errors.Is(err, os.ErrProcessDone) {
+				slog.Warn("failed to forward signal", "signal", sig.String(), "error", err)
+			}
+			if terminating(sig) && kill == nil && opts.gracePeriod > 0 {
+				kill = time.After(opts.gracePeriod)
+			}
+		case <-kill:
+			slog.Warn("child did not exit within the grace period; killing it", "grace_period", opts.gracePeriod.String())
+			if err := killChild(cmd.Process, opts.processGroup); err != nil && !errors.Is(err, os.ErrProcessDone) {
+				slog.Warn("failed to kill child", "error", err)
+			}
+			kill = nil
+		}
+	}
+}
+
@@ -0,0 +1,230 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// forwardedSignals are relayed from skv to the child.
+var forwardedSignals = []os.Signal{
+	syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGUSR1, syscall.SIGUSR2,
+}
+
+// stopSignal asks the child to exit before it is restarted.
+var stopSignal os.Signal = syscall.SIGTERM
+
+// reloadSignals are the signals accepted by --reload-signal.
+var reloadSignals = map[string]syscall.Signal{
+	"HUP": syscall.SIGHUP, "USR1": syscall.SIGUSR1, "USR2": syscall.SIGUSR2,
+	"INT": syscall.SIGINT, "TERM": syscall.SIGTERM, "QUIT": syscall.SIGQUIT,
+}
+
+// parseSignal parses a signal name such as HUP, SIGHUP or usr1.
+func parseSignal(name string) (os.Signal, error) {
+	if sig, ok := reloadSignals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]; ok {
+		return sig, nil
+	}
+	return nil, fmt.Errorf("unsupported signal %q (use HUP, USR1, USR2, INT, TERM or QUIT)", name)
+}
+
+// shellCommand runs script with the system shell.
+func shellCommand(script string) *exec.Cmd {
+	// #nosec G204 - the script is intentionally user-provided
+	return exec.Command("sh", "-c", script)
+}
+
+// terminating reports whether sig asks the child to exit, which starts the
+// grace period.
+func terminating(sig os.Signal) bool {
+	switch sig {
+	case syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGQUIT:
+		return true
+	}
+	return false
+}
+
+func configureChild(cmd *exec.Cmd, group bool) {
+	if !group {
+		return
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+func signalChild(p *os.Process, sig os.Signal, group bool) error {
+	if s, ok := sig.(syscall.Signal); ok && group {
+		return syscall.Kill(-p.Pid, s)
+	}
+	return p.Signal(sig)
+}
+
+func killChild(p *os.Process, group bool) error {
+	if group {
+		return syscall.Kill(-p.Pid, syscall.SIGKILL)
+	}
+	return p.Kill()
+}
+
+// startChild starts cmd. As PID 1 (for example in a container) skv inherits
+// orphaned processes and reaps every exited child, so cmd is registered with
+// the reaper, which hands its exit status to waitChild.
+func startChild(cmd *exec.Cmd) error {
+	if !reapOrphans {
+		return cmd.Start()
+	}
+	return reaper.start(cmd)
+}
+
+// waitChild waits for a command started with startChild to exit and returns
+// its exit code.
+func waitChild(cmd *exec.Cmd) (int, error) {
+	if ws, ok := reaper.wait(cmd.Process.Pid); ok {
+		// The process is gone; Wait only finishes copying its output.
+		_ = cmd.Wait()
+		return waitStatusCode(ws), nil
+	}
+	err := cmd.Wait()
+	var ee *exec.ExitError
+	if err != nil && !errors.As(err, &ee) {
+		return 0, err
+	}
+	ws, _ := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	return waitStatusCode(ws), nil
+}
+
+// runCommand runs cmd like cmd.Run. Every process skv starts while it may
+// be reaping orphans goes through it or startChild, so that the reaper
+// hands the exit status back instead of discarding it.
+func runCommand(cmd *exec.Cmd) error {
+	if !reapOrphans {
+		return cmd.Run()
+	}
+	if err := startChild(cmd); err != nil {
+		return err
+	}
+	code, err := waitChild(cmd)
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return fmt.Errorf("exit status %d", code)
+	}
+	return nil
+}
+
+// reapOrphans is set when skv runs as PID 1.
+var reapOrphans = os.Getpid() == 1
+
+// reaper reaps exited children while commands started by skv are running.
+var reaper = &childReaper{waiters: map[int]chan syscall.WaitStatus{}}
+
+// childReaper collects the exit status of every child. The status of a
+// registered child goes to its waiter; any other child is an orphan and
+// is dropped. It reaps only while registered children are running.
+type childReaper struct {
+	mu      sync.Mutex // held while reaping, and while starting a child so it is registered before it can be reaped
+	waiters map[int]chan syscall.WaitStatus
+	running int // registered children that have not exited
+	stop    chan struct{}
+}
+
+// start starts cmd and registers it.
+func (r *childReaper) start(cmd *exec.Cmd) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	r.waiters[cmd.Process.Pid] = make(chan syscall.WaitStatus, 1)
+	r.running++
+	if r.stop == nil {
+		r.stop = make(chan struct{})
+		go r.loop(r.stop)
+	}
+	return nil
+}
+
+// wait returns the exit status of the registered child pid once it exits;
+// ok is false when pid was not started through the reaper.
+func (r *childReaper) wait(pid int) (ws syscall.WaitStatus, ok bool) {
+	r.mu.Lock()
+	ch, ok := r.waiters[pid]
+	r.mu.Unlock()
+	if !ok {
+		return 0, false
+	}
+	ws = <-ch
+	r.mu.Lock()
+	delete(r.waiters, pid)
+	r.mu.Unlock()
+	return ws, true
+}
+
+// loop reaps children on every SIGCHLD until stop is closed.
+func (r *childReaper) loop(stop chan struct{}) {
+	sigchld := make(chan os.Signal, 1)
+	signal.Notify(sigchld, syscall.SIGCHLD)
+	defer signal.Stop(sigchld)
+	for {
+		r.reap()
+		select {
+		case <-sigchld:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// reap collects every exited child.
+func (r *childReaper) reap() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for {
+		var ws syscall.WaitStatus
+		pid, err := syscall.Wait4(-1, &ws, syscall.WNOHANG, nil)
+		if errors.Is(err, syscall.EINTR) {
+			continue
+		}
+		if err != nil || pid <= 0 {
+			return
+		}
+		ch, ok := r.waiters[pid]
+		if !ok {
+			slog.Debug("reaped orphaned process", "pid", pid)
+			continue
+		}
+		ch <- ws
+		r.running--
+		if r.running == 0 {
+			close(r.stop)
+			r.stop = nil
+			return
+		}
+	}
+}
+
+// waitStatusCode follows the shell convention of 128+N for a process killed
+// by signal N.
+func waitStatusCode(ws syscall.WaitStatus) int {
+	if ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return ws.ExitStatus()
+}
+
+// execReplace replaces the skv process with path. It only returns on error.
+func execReplace(path string, argv, env []string) error {
+	return syscall.Exec(path, argv, env)
+}
+
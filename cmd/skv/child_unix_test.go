@@ -0,0 +1,257 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"skv/internal/config"
+)
+
+// startReady runs script under runChild and sends sig to skv once the
+// script has written its ready file.
+func startReady(t *testing.T, script string, opts childOptions, sig syscall.Signal) int {
+	t.Helper()
+	ready := filepath.Join(t.TempDir(), "ready")
+	cmd := exec.Command("sh", "-c", script)
+	cmd.Env = append(os.Environ(), "READY="+ready)
+
+	if sig != 0 {
+		go func() {
+			for i := 0; i < 200; i++ {
+				if _, err := os.Stat(ready); err == nil {
+					_ = syscall.Kill(os.Getpid(), sig)
+					return
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		}()
+	}
+	code, err := runChild(cmd, opts)
+	if err != nil {
+		t.Fatalf("runChild: %v", err)
+	}
+	return code
+}
+
+func TestRunChild(t *testing.T) {
+	skipIfShort(t)
+
+	loop := `touch "$READY"; while :; do sleep 0.05; done`
+	tests := []struct {
+		name   string
+		script string
+		opts   childOptions
+		sig    syscall.Signal
+		want   int
+	}{
+		{"exit code", "exit 3", childOptions{}, 0, 3},
+		{"forwards SIGUSR1", `trap "exit 42" USR1; ` + loop, childOptions{}, syscall.SIGUSR1, 42},
+		{"forwards SIGTERM to the group", `trap "exit 43" TERM; ` + loop, childOptions{processGroup: true}, syscall.SIGTERM, 43},
+		{"kills after grace period", `trap "" TERM; ` + loop, childOptions{gracePeriod: 100 * time.Millisecond}, syscall.SIGTERM, 128 + int(syscall.SIGKILL)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := startReady(t, tt.script, tt.opts, tt.sig); got != tt.want {
+				t.Errorf("exit code = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunTimeoutDoesNotKillChild(t *testing.T) {
+	skipIfShort(t)
+	_ = newRootCmd()
+	registerMock("mock")
+	cfgPath = writeTestConfig(t, "secrets:\n  - alias: a\n    provider: mock\n    name: a\n")
+
+	c := newRunCmd()
+	c.SetArgs([]string{"--all", "--timeout", "50ms", "--", "sh", "-c", "sleep 0.3"})
+	start := time.Now()
+	if err := c.Execute(); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("child ended after %v; --timeout must only bound fetching", elapsed)
+	}
+}
+
+// TestRunExecHelper is not a real test: TestRunExec runs the test binary with
+// SKV_TEST_EXEC_CONFIG set so that skv can replace that process.
+func TestRunExecHelper(t *testing.T) {
+	path := os.Getenv("SKV_TEST_EXEC_CONFIG")
+	if path == "" {
+		t.Skip("helper process only")
+	}
+	_ = newRootCmd()
+	registerMock("mock")
+	cfgPath = path
+	c := newRunCmd()
+	c.SetArgs([]string{"--all", "--exec", "--", "sh", "-c", `printf '%s %s' "$$" "$TOKEN"`})
+	err := c.Execute()
+	t.Fatalf("exec returned: %v", err)
+}
+
+func TestRunExec(t *testing.T) {
+	skipIfShort(t)
+	cfg := writeTestConfig(t, "secrets:\n  - alias: token\n    provider: mock\n    name: t\n    env: TOKEN\n    extras:\n      value: s3cret\n")
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRunExecHelper$")
+	cmd.Env = append(os.Environ(), "SKV_TEST_EXEC_CONFIG="+cfg)
+	var out strings.Builder
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("helper: %v (output %q)", err, out.String())
+	}
+	want := fmt.Sprintf("%d s3cret", cmd.Process.Pid)
+	if out.String() != want {
+		t.Errorf("output = %q, want %q (command must replace the skv process)", out.String(), want)
+	}
+}
+
+func TestRunExecRejectsIncompatibleOptions(t *testing.T) {
+	_ = newRootCmd()
+	registerMock("mock")
+	cfgPath = writeTestConfig(t, "secrets:\n  - alias: a\n    provider: mock\n    name: a\n    file: true\n")
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"process group", []string{"--process-group"}, "--process-group"},
+		{"grace period", []string{"--grace-period", "1s"}, "--grace-period"},
+		{"as-file flag", []string{"--as-file", "a"}, "--as-file"},
+		{"per-secret file", nil, "as files"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newRunCmd()
+			c.SetArgs(append(append([]string{"--all", "--exec"}, tt.args...), "--", "true"))
+			err := c.Execute()
+			var ee exitCodeError
+			if !errors.As(err, &ee) || ee.code != 2 || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected usage error mentioning %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestReaperHandsBackHelperStatus(t *testing.T) {
+	skipIfShort(t)
+	// Reap as skv does when it runs as PID 1.
+	old := reapOrphans
+	reapOrphans = true
+	t.Cleanup(func() { reapOrphans = old })
+
+	main := exec.Command("sh", "-c", "sleep 0.5")
+	if err := startChild(main); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	// A child skv did not register stands in for an orphan.
+	orphan := exec.Command("true")
+	if err := orphan.Start(); err != nil {
+		t.Fatalf("start orphan: %v", err)
+	}
+	helper := exec.Command("sh", "-c", "exit 3")
+	if err := startChild(helper); err != nil {
+		t.Fatalf("start helper: %v", err)
+	}
+	// Reap both before anyone waits, as on a SIGCHLD for another child.
+	time.Sleep(200 * time.Millisecond)
+	reaper.reap()
+	if code, err := waitChild(helper); err != nil || code != 3 {
+		t.Errorf("helper waitChild() = %d, %v; want 3", code, err)
+	}
+	if err := orphan.Wait(); !errors.Is(err, syscall.ECHILD) {
+		t.Errorf("orphan was not reaped: Wait() = %v", err)
+	}
+
+	s := &supervisor{
+		environ: func(*injection) ([]string, *secretFiles, error) { return os.Environ(), &secretFiles{}, nil },
+		command: func() *exec.Cmd { return exec.Command("true") },
+	}
+	tests := []struct {
+		name    string
+		health  string
+		wantErr string
+	}{
+		{"passes", "exit 0", ""},
+		{"fails", "exit 3", "exit status 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.opts.healthCmd = tt.health
+			err := s.healthy(&injection{})
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("healthy() = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("healthy() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if code, err := waitChild(main); err != nil || code != 0 {
+		t.Fatalf("waitChild() = %d, %v", code, err)
+	}
+}
+
+func TestReaperExecProviderFetch(t *testing.T) {
+	skipIfShort(t)
+	script := filepath.Join(t.TempDir(), "fetch.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nsleep 0.3\necho v1\n"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	_ = newRootCmd()
+	cfg, err := config.Load(writeTestConfig(t, "secrets:\n  - alias: token\n    provider: exec\n    name: "+script+"\n    extras:\n      trim: \"true\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := reapOrphans
+	reapOrphans = true
+	t.Cleanup(func() { reapOrphans = old })
+	main := exec.Command("sh", "-c", "sleep 2")
+	if err := startChild(main); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	type result struct {
+		v   string
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		v, err := newSecretResolver(cfg, 1, 0, 0).resolve(context.Background(), "token")
+		done <- result{v, err}
+	}()
+
+	// A refetch during --watch must hand its child to the reaper, or the
+	// reaper takes its exit status and the fetch fails with ECHILD.
+	registered := false
+	for deadline := time.Now().Add(time.Second); !registered && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		reaper.mu.Lock()
+		registered = len(reaper.waiters) >= 2
+		reaper.mu.Unlock()
+	}
+	if !registered {
+		t.Error("exec provider child was not registered with the reaper")
+	}
+	if r := <-done; r.err != nil || r.v != "v1" {
+		t.Fatalf("resolve() = %q, %v", r.v, r.err)
+	}
+	if code, err := waitChild(main); err != nil || code != 0 {
+		t.Fatalf("waitChild() = %d, %v", code, err)
+	}
+}
+
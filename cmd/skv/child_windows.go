@@ -0,0 +1,58 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// forwardedSignals are relayed from skv to the child.
+var forwardedSignals = []os.Signal{os.Interrupt}
+
+// stopSignal asks the child to exit before it is restarted. Windows cannot
+// deliver SIGTERM, so the child is killed.
+var stopSignal = os.Kill
+
+func parseSignal(string) (os.Signal, error) {
+	return nil, errors.New("reload signals are not supported on Windows")
+}
+
+func shellCommand(script string) *exec.Cmd {
+	// #nosec G204 - the script is intentionally user-provided
+	return exec.Command("cmd", "/C", script)
+}
+
+func terminating(os.Signal) bool { return true }
+
+func configureChild(*exec.Cmd, bool) {}
+
+func signalChild(p *os.Process, sig os.Signal, _ bool) error {
+	return p.Signal(sig)
+}
+
+func killChild(p *os.Process, _ bool) error {
+	return p.Kill()
+}
+
+func startChild(cmd *exec.Cmd) error {
+	return cmd.Start()
+}
+
+func runCommand(cmd *exec.Cmd) error {
+	return cmd.Run()
+}
+
+func waitChild(cmd *exec.Cmd) (int, error) {
+	err := cmd.Wait()
+	if cmd.ProcessState == nil {
+		return 0, err
+	}
+	return cmd.ProcessState.ExitCode(), nil
+}
+
+func execReplace(string, []string, []string) error {
+	return errors.New("--exec is not supported on Windows")
+}
+
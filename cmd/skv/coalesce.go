@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"skv/internal/provider"
+)
+
+// keySelectingProviders return the field named by the "key" extra of a
+// JSON object. Aliases reading different keys of one object share a fetch
+// of the whole object and select their field from it. Other providers,
+// such as aws, have no such extra: aliases picking fields with a json
+// transform already share a fetch, as transforms are not part of the
+// fetch key.
+var keySelectingProviders = map[string]bool{"vault": true}
+
+// fetchFlight is one fetch of a backend object, shared by every spec with
+// the same fetch key.
+type fetchFlight struct {
+	done  chan struct{}
+	value string
+	err   error // unwrapped provider error
+}
+
+// fetchKey identifies the backend object a spec fetches: provider, name
+// and every extra, which covers versions, connection settings and
+// credentials. The alias and env name do not take part.
+func fetchKey(spec provider.SecretSpec) string {
+	keys := make([]string, 0, len(spec.Extras))
+	for k := range spec.Extras {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(spec.Provider)
+	b.WriteByte(0)
+	b.WriteString(spec.Name)
+	for _, k := range keys {
+		b.WriteByte(0)
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(spec.Extras[k])
+	}
+	return b.String()
+}
+
+// fetchCoalesced returns the raw value of spec. Specs reading different
+// keys of one object fetch the object once; when the key cannot be
+// selected from it the way the provider would, spec is fetched as is.
+func (r *secretResolver) fetchCoalesced(ctx context.Context, p provider.Provider, spec provider.SecretSpec) (string, error) {
+	key := spec.Extras["key"]
+	if key == "" || !keySelectingProviders[spec.Provider] {
+		return r.fetchShared(ctx, p, spec)
+	}
+	whole := spec
+	whole.Extras = make(map[string]string, len(spec.Extras))
+	for k, v := range spec.Extras {
+		if k != "key" {
+			whole.Extras[k] = v
+		}
+	}
+	obj, err := r.fetchShared(ctx, p, whole)
+	if err != nil {
+		return "", err
+	}
+	if v, ok := selectKey(obj, key); ok {
+		return v, nil
+	}
+	return r.fetchShared(ctx, p, spec)
+}
+
+// fetchShared fetches spec once per resolver: concurrent callers wait for
+// the fetch in flight and later callers get its result. Fetches cut short
+// by a cancelled context are not kept.
+func (r *secretResolver) fetchShared(ctx context.Context, p provider.Provider, spec provider.SecretSpec) (string, error) {
+	key := fetchKey(spec)
+	r.mu.Lock()
+	if f, ok := r.flights[key]; ok {
+		r.mu.Unlock()
+		slog.Debug("sharing fetch", "alias", spec.Alias)
+		select {
+		case <-f.done:
+			return f.value, f.err
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	f := &fetchFlight{done: make(chan struct{})}
+	r.flights[key] = f
+	r.mu.Unlock()
+	// Closed even if the provider panics, so that waiters are not stuck.
+	defer close(f.done)
+
+	f.value, f.err = r.fetchGuarded(ctx, p, spec)
+	if errors.Is(f.err, context.Canceled) || errors.Is(f.err, context.DeadlineExceeded) {
+		r.mu.Lock()
+		delete(r.flights, key)
+		r.mu.Unlock()
+	}
+	return f.value, f.err
+}
+
+// fetchGuarded fetches spec through the circuit breaker of its backend.
+// Not-found answers and throttling show the backend is up, so they do not
+// count as failures.
+func (r *secretResolver) fetchGuarded(ctx context.Context, p provider.Provider, spec provider.SecretSpec) (string, error) {
+	key := backendKey(spec)
+	b := r.breakers.get(key)
+	if !b.allow() {
+		slog.Debug("circuit open, failing fast", "backend", key)
+		return "", fmt.Errorf("%w for %s", errCircuitOpen, key)
+	}
+	slog.Debug("fetching secret", "spec", spec)
+	lp := limitedProvider{Provider: p, limiters: r.limits.forSpec(spec), global: r.sem}
+	val, err := fetchWithRetry(ctx, lp, spec, r.retries, r.retryDelay)
+	var te *provider.ThrottledError
+	switch {
+	case err == nil, errors.Is(err, provider.ErrNotFound), errors.As(err, &te):
+		b.success()
+	default:
+		b.failure()
+		if b.state() == breakerOpen {
+			slog.Debug("circuit open", "backend", key, "cooldown", b.cooldown)
+		}
+	}
+	return val, err
+}
+
+// selectKey picks the string field key of obj, the unkeyed value of a
+// key-selecting provider. Without a key, the provider returns the object
+// only when it has no string "value" field and not exactly one string
+// field; any other result is a field's content and cannot be selected from.
+func selectKey(obj, key string) (string, bool) {
+	var m map[string]any
+	if err := json.Unmarshal([]byte(obj), &m); err != nil {
+		return "", false
+	}
+	strs := 0
+	for _, v := range m {
+		if _, ok := v.(string); ok {
+			strs++
+		}
+	}
+	if _, ok := m["value"].(string); ok || strs == 1 {
+		return "", false
+	}
+	v, ok := m[key].(string)
+	return v, ok
+}
+
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"skv/internal/config"
+	"skv/internal/provider"
+)
+
+// countingProvider returns the object stored under a spec's name and counts
+// fetches per name. With a "key" extra it returns that string field, as
+// the vault provider does.
+type countingProvider struct {
+	objects map[string]string
+	mu      sync.Mutex
+	calls   map[string]int
+}
+
+func (p *countingProvider) FetchSecret(_ context.Context, spec provider.SecretSpec) (string, error) {
+	p.mu.Lock()
+	p.calls[spec.Name]++
+	p.mu.Unlock()
+	time.Sleep(20 * time.Millisecond) // keep fetches in flight together
+	obj, ok := p.objects[spec.Name]
+	if !ok {
+		return "", provider.ErrNotFound
+	}
+	if key := spec.Extras["key"]; key != "" {
+		var m map[string]any
+		_ = json.Unmarshal([]byte(obj), &m)
+		if v, ok := m[key].(string); ok {
+			return v, nil
+		}
+	}
+	return obj, nil
+}
+
+func TestResolverCoalescesFetches(t *testing.T) {
+	_ = newRootCmd()
+	p := &countingProvider{
+		objects: map[string]string{
+			"app/db":  `{"user":"app","password":"s3cret","port":"5432"}`,
+			"app/api": `{"value":"tok","other":"x"}`,
+		},
+		calls: map[string]int{},
+	}
+	provider.Register("counting", p)
+	keySelectingProviders["counting"] = true
+	t.Cleanup(func() { delete(keySelectingProviders, "counting") })
+
+	cfgText := `secrets:
+  - alias: db_user
+    provider: counting
+    name: app/db
+    extras:
+      key: user
+  - alias: db_password
+    provider: counting
+    name: app/db
+    extras:
+      key: password
+  - alias: db_port
+    provider: counting
+    name: app/db
+    transform:
+      type: json
+      path: .port
+  - alias: db_url
+    provider: composite
+    composite:
+      template: "{{ .user }}:{{ .pass }}"
+      inputs:
+        user: db_user
+        pass: db_password
+  - alias: other_creds
+    provider: counting
+    name: app/db
+    token: different
+    extras:
+      key: user
+  - alias: api_other
+    provider: counting
+    name: app/api
+    extras:
+      key: other
+`
+	cfg, err := config.Load(writeTestConfig(t, cfgText))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	r := newSecretResolver(cfg, 8, 0, 0)
+	aliases := []string{"db_user", "db_password", "db_port", "db_url", "other_creds", "api_other"}
+	values, errs := r.resolveAll(context.Background(), aliases)
+	if len(errs) > 0 {
+		t.Fatalf("errors: %v", errs)
+	}
+	want := map[string]string{
+		"db_user":     "app",
+		"db_password": "s3cret",
+		"db_port":     "5432",
+		"db_url":      "app:s3cret",
+		"other_creds": "app",
+		"api_other":   "x",
+	}
+	for alias, w := range want {
+		if values[alias] != w {
+			t.Errorf("%s = %q, want %q", alias, values[alias], w)
+		}
+	}
+	// One fetch of app/db for the shared credentials and one for other
+	// credentials. app/api has a "value" field, so the whole fetch cannot
+	// stand in for the keyed one.
+	if got := p.calls["app/db"]; got != 2 {
+		t.Errorf("app/db fetched %d times, want 2", got)
+	}
+	if got := p.calls["app/api"]; got != 2 {
+		t.Errorf("app/api fetched %d times, want 2", got)
+	}
+
+	// Completed fetches are reused within the resolver.
+	if _, err := r.resolve(context.Background(), "db_port"); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.calls["app/db"]; got != 2 {
+		t.Errorf("app/db fetched %d times after reuse, want 2", got)
+	}
+}
+
+func TestResolverCoalescesJSONTransforms(t *testing.T) {
+	_ = newRootCmd()
+	p := &countingProvider{objects: map[string]string{"myapp/db": `{"username":"app","password":"s3cret"}`}, calls: map[string]int{}}
+	orig, _ := provider.Get("aws")
+	provider.Register("aws", p)
+	t.Cleanup(func() { provider.Register("aws", orig) })
+
+	cfg, err := config.Load(writeTestConfig(t, `secrets:
+  - alias: db_user
+    provider: aws
+    name: myapp/db
+    extras: {region: eu-west-1}
+    transform: {type: json, path: .username}
+  - alias: db_password
+    provider: aws
+    name: myapp/db
+    extras: {region: eu-west-1}
+    transform: {type: json, path: .password}
+`))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	values, errs := newSecretResolver(cfg, 8, 0, 0).resolveAll(context.Background(), []string{"db_user", "db_password"})
+	if len(errs) > 0 {
+		t.Fatalf("errors: %v", errs)
+	}
+	if values["db_user"] != "app" || values["db_password"] != "s3cret" {
+		t.Errorf("values = %v", values)
+	}
+	if got := p.calls["myapp/db"]; got != 1 {
+		t.Errorf("myapp/db fetched %d times, want 1", got)
+	}
+}
+
+func TestSelectKey(t *testing.T) {
+	tests := []struct {
+		name, obj, key, want string
+		ok                   bool
+	}{
+		{"field", `{"a":"1","b":"2"}`, "a", "1", true},
+		{"missing field", `{"a":"1","b":"2"}`, "c", "", false},
+		{"non-string field", `{"a":1,"b":"2","c":"3"}`, "a", "", false},
+		{"value field returned instead", `{"value":"v","b":"2"}`, "b", "", false},
+		{"single string field returned instead", `{"a":"1","n":2}`, "a", "", false},
+		{"not an object", `plain`, "a", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := selectKey(tt.obj, tt.key)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("selectKey(%s, %s) = %q, %v; want %q, %v", tt.obj, tt.key, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
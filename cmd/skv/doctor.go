@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -20,6 +22,7 @@ func newDoctorCmd() *cobra.Command {
 		checkAuth  bool
 		checkNet   bool
 		timeoutStr string
+		output     string
 	)
 
 	c := &cobra.Command{
@@ -33,9 +36,27 @@ The doctor command checks:
 - Authentication and permissions (when --auth is specified)
 - Network connectivity to providers (when --net is specified)
 - File permissions and environment setup
-- System information and Go version`,
+- System information and Go version
+
+It exits with code 2 when the configuration has issues and, with --auth,
+3 when a secret cannot be fetched.`,
 		RunE: func(cmd *cobra.Command, _ []string) error {
-			return runDoctor(cmd, verbose, checkAuth, checkNet, timeoutStr)
+			if err := checkOutput(output); err != nil {
+				return err
+			}
+			rep := &doctorReport{Schema: schemaName("doctor"), Providers: []doctorProvider{}, Issues: []string{}}
+			out := cmd.ErrOrStderr() // Use stderr for diagnostic output
+			if output == outputJSON {
+				out = io.Discard
+			}
+			err := runDoctor(out, rep, verbose, checkAuth, checkNet, timeoutStr)
+			rep.OK = err == nil
+			if output == outputJSON {
+				if werr := writeJSON(cmd.OutOrStdout(), rep); werr != nil {
+					return werr
+				}
+			}
+			return err
 		},
 	}
 
@@ -43,12 +64,53 @@ The doctor command checks:
 	c.Flags().BoolVar(&checkAuth, "auth", false, "Check authentication and permissions (may make API calls)")
 	c.Flags().BoolVar(&checkNet, "net", false, "Check network connectivity to providers")
 	c.Flags().StringVar(&timeoutStr, "timeout", "30s", "Timeout for network checks")
+	addOutputFlag(c.Flags(), &output)
 
 	return c
 }
 
-func runDoctor(cmd *cobra.Command, verbose, checkAuth, checkNet bool, timeoutStr string) error {
-	out := cmd.ErrOrStderr() // Use stderr for diagnostic output
+// doctorReport is the JSON document of skv doctor.
+type doctorReport struct {
+	Schema    string           `json:"schema"`
+	OK        bool             `json:"ok"`
+	System    doctorSystem     `json:"system"`
+	Config    doctorConfig     `json:"config"`
+	Providers []doctorProvider `json:"providers"`
+	Issues    []string         `json:"issues"`
+	Auth      []doctorAuth     `json:"auth,omitempty"`
+}
+
+type doctorSystem struct {
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	GoVersion string `json:"go_version"`
+}
+
+type doctorConfig struct {
+	Path    string `json:"path"`
+	Loaded  bool   `json:"loaded"`
+	Secrets int    `json:"secrets"`
+	Error   string `json:"error,omitempty"`
+}
+
+type doctorProvider struct {
+	Name       string `json:"name"`
+	Registered bool   `json:"registered"`
+}
+
+// doctorAuth is the result of fetching one secret with --auth: ok,
+// not_found or error.
+type doctorAuth struct {
+	Alias    string `json:"alias"`
+	Provider string `json:"provider"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+// runDoctor writes the diagnostic report as text to out and records it in rep.
+func runDoctor(out io.Writer, rep *doctorReport, verbose, checkAuth, checkNet bool, timeoutStr string) error {
+	rep.System = doctorSystem{OS: runtime.GOOS, Arch: runtime.GOARCH, GoVersion: runtime.Version()}
+	rep.Config.Path = getConfigPath()
 	if _, err := fmt.Fprintln(out, "skv Doctor - Diagnostic Report"); err != nil {
 		return fmt.Errorf("failed to write output: %w", err)
 	}
@@ -75,6 +137,8 @@ func runDoctor(cmd *cobra.Command, verbose, checkAuth, checkNet bool, timeoutStr
 	// Load configuration (this will find the config file automatically)
 	cfg, err := config.Load(cfgPath)
 	if err != nil {
+		rep.Config.Error = err.Error()
+		err = exitCodeError{code: 2, err: err}
 		if strings.Contains(err.Error(), "no config file found") {
 			if _, err := fmt.Fprintln(out, "  ERROR: No configuration file found"); err != nil {
 				return fmt.Errorf("failed to write output: %w", err)
@@ -105,6 +169,7 @@ func runDoctor(cmd *cobra.Command, verbose, checkAuth, checkNet bool, timeoutStr
 		return err
 	}
 
+	rep.Config.Loaded, rep.Config.Secrets = true, len(cfg.Secrets)
 	if _, err := fmt.Fprintf(out, "  OK: Configuration loaded: %d secrets configured\n", len(cfg.Secrets)); err != nil {
 		return fmt.Errorf("failed to write output: %w", err)
 	}
@@ -115,7 +180,9 @@ func runDoctor(cmd *cobra.Command, verbose, checkAuth, checkNet bool, timeoutStr
 	}
 	allProviders := []string{"aws", "aws-ssm", "gcp", "azure", "azure-appconfig", "vault", "exec"}
 	for _, p := range allProviders {
-		if _, ok := provider.Get(p); ok {
+		_, ok := provider.Get(p)
+		rep.Providers = append(rep.Providers, doctorProvider{Name: p, Registered: ok})
+		if ok {
 			if _, err := fmt.Fprintf(out, "  OK: %s: registered\n", p); err != nil {
 				return fmt.Errorf("failed to write output: %w", err)
 			}
@@ -131,6 +198,15 @@ func runDoctor(cmd *cobra.Command, verbose, checkAuth, checkNet bool, timeoutStr
 		return fmt.Errorf("failed to write output: %w", err)
 	}
 	issues := 0
+	issue := func(format string, args ...any) error {
+		msg := fmt.Sprintf(format, args...)
+		rep.Issues = append(rep.Issues, msg)
+		issues++
+		if _, err := fmt.Fprintf(out, "    ERROR: %s\n", msg); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		return nil
+	}
 
 	for i, secret := range cfg.Secrets {
 		if verbose {
@@ -140,41 +216,42 @@ func runDoctor(cmd *cobra.Command, verbose, checkAuth, checkNet bool, timeoutStr
 		}
 
 		// Check provider exists
-		if _, ok := provider.Get(secret.Provider); !ok {
-			if _, err := fmt.Fprintf(out, "    ERROR: Secret '%s': unknown provider '%s'\n", secret.Alias, secret.Provider); err != nil {
-				return fmt.Errorf("failed to write output: %w", err)
+		if secret.IsComposite() {
+			if verbose {
+				if _, err := fmt.Fprintf(out, "    Composite of: %s\n", strings.Join(secret.Dependencies(), ", ")); err != nil {
+					return fmt.Errorf("failed to write output: %w", err)
+				}
+			}
+		} else if missing := missingProvider(secret); missing != "" {
+			if err := issue("Secret '%s': unknown provider '%s'", secret.Alias, missing); err != nil {
+				return err
 			}
-			issues++
 			continue
 		}
 
 		// Validate required fields
 		if secret.Alias == "" {
-			if _, err := fmt.Fprintf(out, "    ERROR: Secret %d: missing alias\n", i+1); err != nil {
-				return fmt.Errorf("failed to write output: %w", err)
+			if err := issue("Secret %d: missing alias", i+1); err != nil {
+				return err
 			}
-			issues++
 		}
-		if secret.Provider == "" {
-			if _, err := fmt.Fprintf(out, "    ERROR: Secret '%s': missing provider\n", secret.Alias); err != nil {
-				return fmt.Errorf("failed to write output: %w", err)
+		if secret.Provider == "" && len(secret.Sources) == 0 {
+			if err := issue("Secret '%s': missing provider", secret.Alias); err != nil {
+				return err
 			}
-			issues++
 		}
-		if secret.Name == "" {
-			if _, err := fmt.Fprintf(out, "    ERROR: Secret '%s': missing name\n", secret.Alias); err != nil {
-				return fmt.Errorf("failed to write output: %w", err)
+		if secret.Name == "" && len(secret.Sources) == 0 {
+			if err := issue("Secret '%s': missing name", secret.Alias); err != nil {
+				return err
 			}
-			issues++
 		}
 
 		// Check for duplicate aliases
 		for j, other := range cfg.Secrets {
 			if i != j && secret.Alias == other.Alias {
-				if _, err := fmt.Fprintf(out, "    ERROR: Duplicate alias: '%s' (secrets %d and %d)\n", secret.Alias, i+1, j+1); err != nil {
-					return fmt.Errorf("failed to write output: %w", err)
+				if err := issue("Duplicate alias: '%s' (secrets %d and %d)", secret.Alias, i+1, j+1); err != nil {
+					return err
 				}
-				issues++
 			}
 		}
 	}
@@ -190,11 +267,13 @@ func runDoctor(cmd *cobra.Command, verbose, checkAuth, checkNet bool, timeoutStr
 	}
 
 	// Authentication Check (if requested)
+	authFailures := 0
 	if checkAuth {
 		if _, err := fmt.Fprintln(out, "\nAuthentication Check:"); err != nil {
 			return fmt.Errorf("failed to write output: %w", err)
 		}
 		timeout, _ := time.ParseDuration(timeoutStr)
+		resolver := newSecretResolver(cfg, 1, 0, 0)
 
 		for _, secret := range cfg.Secrets {
 			if _, err := fmt.Fprintf(out, "  Checking %s (%s)... ", secret.Alias, secret.Provider); err != nil {
@@ -202,25 +281,27 @@ func runDoctor(cmd *cobra.Command, verbose, checkAuth, checkNet bool, timeoutStr
 			}
 
 			ctx, cancel := context.WithTimeout(context.Background(), timeout)
-			spec := secret.ToSpec()
-
-			p, _ := provider.Get(spec.Provider)
-			_, err := p.FetchSecret(ctx, spec)
+			_, err := resolver.resolve(ctx, secret.Alias)
 			cancel()
 
+			res := doctorAuth{Alias: secret.Alias, Provider: secret.Provider, Status: "ok"}
 			if err == nil {
 				if _, err := fmt.Fprintln(out, "OK"); err != nil {
 					return fmt.Errorf("failed to write output: %w", err)
 				}
-			} else if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "404") {
+			} else if errors.Is(err, provider.ErrNotFound) || strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "404") {
+				res.Status, res.Error = "not_found", err.Error()
 				if _, err := fmt.Fprintln(out, "WARNING: (secret not found)"); err != nil {
 					return fmt.Errorf("failed to write output: %w", err)
 				}
 			} else {
+				res.Status, res.Error = "error", err.Error()
+				authFailures++
 				if _, err := fmt.Fprintf(out, "ERROR: (%v)\n", err); err != nil {
 					return fmt.Errorf("failed to write output: %w", err)
 				}
 			}
+			rep.Auth = append(rep.Auth, res)
 		}
 	}
 
@@ -289,6 +370,12 @@ func runDoctor(cmd *cobra.Command, verbose, checkAuth, checkNet bool, timeoutStr
 		}
 	}
 
+	if issues > 0 {
+		return exitCodeError{code: 2, err: fmt.Errorf("found %d configuration issue(s)", issues)}
+	}
+	if authFailures > 0 {
+		return exitCodeError{code: 3, err: fmt.Errorf("%d secret(s) could not be fetched", authFailures)}
+	}
 	return nil
 }
 
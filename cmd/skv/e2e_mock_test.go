@@ -2,9 +2,12 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"strings"
 	"testing"
 
+	"github.com/spf13/cobra"
+
 	"skv/internal/provider"
 	mockprovider "skv/internal/provider/mock"
 )
@@ -206,3 +209,124 @@ func TestE2E_Mock_MultipleFormats(t *testing.T) {
 	}
 }
 
+func TestE2E_Mock_CompositeSecret(t *testing.T) {
+	_ = newRootCmd() // ensure core providers registered
+	registerMock("mock")
+
+	cfg := "secrets:\n" +
+		"  - alias: db_user\n    provider: mock\n    name: user\n    env: DB_USER\n    extras:\n      value: app\n" +
+		"  - alias: db_pass\n    provider: mock\n    name: pass\n    env: DB_PASS\n    extras:\n      value: s3cret\n" +
+		"  - alias: db_url\n    env: DATABASE_URL\n    composite:\n      template: \"postgres://{{ .user }}:{{ .pass }}@db/app\"\n" +
+		"      inputs:\n        user: db_user\n        pass: db_pass\n"
+	cfgPath = writeTestConfig(t, cfg)
+
+	var out bytes.Buffer
+	g := newGetCmd()
+	g.SetOut(&out)
+	g.SetArgs([]string{"db_url"})
+	if err := g.Execute(); err != nil {
+		t.Fatalf("get composite: %v", err)
+	}
+	if got := out.String(); got != "postgres://app:s3cret@db/app" {
+		t.Fatalf("unexpected composite value: %q", got)
+	}
+
+	// Selecting only the composite fetches its inputs but injects just the composite.
+	var errBuf bytes.Buffer
+	r := newRunCmd()
+	r.SetErr(&errBuf)
+	r.SetArgs([]string{"-s", "db_url", "--dry-run", "--mask=false", "--", "/usr/bin/env"})
+	if err := r.Execute(); err != nil {
+		t.Fatalf("run composite: %v", err)
+	}
+	dr := errBuf.String()
+	if !strings.Contains(dr, "DATABASE_URL=postgres://app:s3cret@db/app") {
+		t.Fatalf("unexpected dry-run: %q", dr)
+	}
+	if strings.Contains(dr, "DB_USER=") || strings.Contains(dr, "DB_PASS=") {
+		t.Fatalf("inputs should not be injected: %q", dr)
+	}
+
+	// A failing input fails the composite with the input's exit code.
+	cfg = "secrets:\n" +
+		"  - alias: db_pass\n    provider: mock\n    name: pass\n    extras:\n      not_found: \"true\"\n" +
+		"  - alias: db_url\n    composite:\n      template: \"{{ .pass }}\"\n      inputs:\n        pass: db_pass\n"
+	cfgPath = writeTestConfig(t, cfg)
+	g = newGetCmd()
+	g.SetOut(&out)
+	g.SetArgs([]string{"db_url"})
+	err := g.Execute()
+	var ee exitCodeError
+	if !errors.As(err, &ee) || ee.code != 4 {
+		t.Fatalf("expected exit code 4, got %v", err)
+	}
+}
+
+func TestE2E_Mock_SecretRefs(t *testing.T) {
+	_ = newRootCmd() // ensure core providers registered
+	registerMock("mock")
+
+	cfg := "secrets:\n" +
+		"  - alias: bootstrap\n    provider: mock\n    name: bootstrap\n    extras:\n      value: from-bootstrap\n" +
+		"  - alias: app\n    provider: mock\n    name: app\n    extras:\n      value: {ref: bootstrap}\n"
+	cfgPath = writeTestConfig(t, cfg)
+
+	var out bytes.Buffer
+	g := newGetCmd()
+	g.SetOut(&out)
+	g.SetArgs([]string{"app"})
+	if err := g.Execute(); err != nil {
+		t.Fatalf("get with ref: %v", err)
+	}
+	if got := out.String(); got != "from-bootstrap" {
+		t.Fatalf("unexpected value: %q", got)
+	}
+}
+
+func TestE2E_Mock_ValidationRules(t *testing.T) {
+	_ = newRootCmd() // ensure core providers registered
+	registerMock("mock")
+
+	cfg := "secrets:\n" +
+		"  - alias: ok\n    provider: mock\n    name: ok\n    extras:\n      value: s3cr3t-value\n    validate:\n      min_length: 8\n" +
+		"  - alias: bad\n    provider: mock\n    name: bad\n    extras:\n      value: changeme\n    validate:\n      not_placeholder: true\n"
+	cfgPath = writeTestConfig(t, cfg)
+
+	tests := []struct {
+		name     string
+		cmd      func() *cobra.Command
+		args     []string
+		wantCode int // 0 means success
+	}{
+		{"get valid value", newGetCmd, []string{"ok"}, 0},
+		{"get placeholder", newGetCmd, []string{"bad"}, 6},
+		{"export placeholder", newExportCmd, []string{"--all"}, 6},
+		{"run without strict still fails", newRunCmd, []string{"--all", "--strict=false", "--dry-run", "--", "true"}, 6},
+		{"health skips rules", newHealthCmd, nil, 0},
+		{"health deep applies rules", newHealthCmd, []string{"--deep"}, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			c := tt.cmd()
+			c.SetOut(&out)
+			c.SetErr(&out)
+			c.SetArgs(tt.args)
+			err := c.Execute()
+			if tt.wantCode == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var ee exitCodeError
+			if !errors.As(err, &ee) || ee.code != tt.wantCode {
+				t.Fatalf("expected exit code %d, got %v", tt.wantCode, err)
+			}
+			if strings.Contains(err.Error(), "changeme") || strings.Contains(out.String(), "changeme") {
+				t.Errorf("output must not contain the value: %v", err)
+			}
+		})
+	}
+}
+
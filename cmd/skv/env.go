@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+
+	"skv/internal/config"
+)
+
+// Policies for secrets whose env name already exists in the parent environment.
+const (
+	conflictOverride = "override"
+	conflictKeep     = "keep"
+	conflictError    = "error"
+)
+
+// What happens to an injected variable.
+const (
+	envAdded      = "added"
+	envOverridden = "overridden"
+	envKept       = "kept"
+)
+
+// envPlan decides how the child's environment is built from skv's own
+// environment and the injected secrets, so that dry-run can report exactly
+// what run would do.
+type envPlan struct {
+	base    []string          // parent entries passed through, without overridden names
+	actions map[string]string // injected env name -> envAdded, envOverridden or envKept
+	dropped []string          // parent names removed by --clean-env, sorted
+}
+
+// newEnvPlan filters parent (KEY=VALUE entries) and resolves conflicts with
+// names. With clean only the variables matching a pass pattern are kept.
+func newEnvPlan(parent, names []string, clean bool, pass []string, onConflict string) (*envPlan, error) {
+	switch onConflict {
+	case "", conflictOverride, conflictKeep, conflictError:
+	default:
+		return nil, fmt.Errorf("invalid --on-conflict %q (use override, keep or error)", onConflict)
+	}
+	p := &envPlan{actions: make(map[string]string, len(names))}
+	existing := map[string]bool{}
+	var passed []string
+	dropped := map[string]bool{}
+	for _, kv := range parent {
+		name, _, _ := strings.Cut(kv, "=")
+		if clean && !passEnv(pass, name) {
+			dropped[name] = true
+			continue
+		}
+		existing[envKey(name)] = true
+		passed = append(passed, kv)
+	}
+	for name := range dropped {
+		p.dropped = append(p.dropped, name)
+	}
+	sort.Strings(p.dropped)
+
+	injected := map[string]bool{}
+	var conflicts []string
+	for _, name := range names {
+		switch {
+		case !existing[envKey(name)]:
+			p.actions[name] = envAdded
+		case onConflict == conflictKeep:
+			p.actions[name] = envKept
+		case onConflict == conflictError:
+			conflicts = append(conflicts, name)
+		default:
+			p.actions[name] = envOverridden
+			injected[envKey(name)] = true
+		}
+	}
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return nil, fmt.Errorf("secrets conflict with existing environment variables: %s", strings.Join(conflicts, ", "))
+	}
+	for _, kv := range passed {
+		name, _, _ := strings.Cut(kv, "=")
+		if !injected[envKey(name)] {
+			p.base = append(p.base, kv)
+		}
+	}
+	return p, nil
+}
+
+// environ returns the child's environment: the passed-through parent
+// variables followed by the injected values that are not kept.
+func (p *envPlan) environ(values map[string]string) []string {
+	env := append([]string(nil), p.base...)
+	names := make([]string, 0, len(values))
+	for name := range values {
+		if p.actions[name] != envKept {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env = append(env, name+"="+values[name])
+	}
+	return env
+}
+
+// passEnv reports whether name matches one of the --pass-env patterns.
+func passEnv(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(envKey(p), envKey(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// envKey normalizes a variable name for comparison; Windows treats names
+// case-insensitively.
+func envKey(name string) string {
+	if runtime.GOOS == "windows" {
+		return strings.ToUpper(name)
+	}
+	return name
+}
+
+// injection is what run adds to the command's environment for one set of
+// fetched secrets.
+type injection struct {
+	additions map[string]string // env name -> value
+	sources   map[string]string // env name -> source, for reports
+	fileNames map[string]string // env name -> file name, for secrets delivered as files
+	aliasEnv  map[string]string // alias -> env name
+	skipped   []string          // env names of optional secrets that were unavailable
+}
+
+// newInjection maps the resolved values of aliases to env names. Secrets
+// configured with file: or matching an asFile pattern are delivered as files.
+func newInjection(cfg *config.Config, resolver *secretResolver, aliases []string, values map[string]string, errs map[string]error, asFile []string) *injection {
+	inj := &injection{
+		additions: map[string]string{},
+		sources:   map[string]string{},
+		fileNames: map[string]string{},
+		aliasEnv:  map[string]string{},
+	}
+	for _, alias := range aliases {
+		s, ok := cfg.FindByAlias(alias)
+		if !ok {
+			continue
+		}
+		envName := s.ToSpec().EnvName
+		val, ok := values[alias]
+		if !ok {
+			if _, failed := errs[alias]; !failed {
+				inj.skipped = append(inj.skipped, envName)
+			}
+			continue
+		}
+		inj.additions[envName] = val
+		inj.sources[envName] = resolver.source(alias)
+		inj.aliasEnv[alias] = envName
+		if s.AsFile() || matchesAny(asFile, alias) {
+			inj.fileNames[envName] = s.FileName()
+		}
+	}
+	return inj
+}
+
+// names returns the injected env names, sorted.
+func (inj *injection) names() []string {
+	names := make([]string, 0, len(inj.additions))
+	for k := range inj.additions {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// files returns the env names delivered as files under plan, sorted.
+// Kept variables are not injected, so they get no file.
+func (inj *injection) files(plan *envPlan) []string {
+	var names []string
+	for k := range inj.fileNames {
+		if plan.actions[k] != envKept {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// values returns the injected values keyed by alias, for redaction.
+func (inj *injection) values(plan *envPlan) map[string]string {
+	out := make(map[string]string, len(inj.aliasEnv))
+	for alias, k := range inj.aliasEnv {
+		if plan.actions[k] != envKept {
+			out[alias] = inj.additions[k]
+		}
+	}
+	return out
+}
+
+// environ writes file secrets to files and returns the child's environment.
+func (inj *injection) environ(plan *envPlan, files *secretFiles) ([]string, error) {
+	vals := make(map[string]string, len(inj.additions))
+	for k, v := range inj.additions {
+		vals[k] = v
+	}
+	for _, k := range inj.files(plan) {
+		path, err := files.add(inj.fileNames[k], inj.additions[k])
+		if err != nil {
+			return nil, err
+		}
+		vals[k] = path
+	}
+	return plan.environ(vals), nil
+}
+
+// changed returns the env names whose value or delivery differs between
+// inj and other, sorted. It never returns values.
+func (inj *injection) changed(other *injection) []string {
+	var names []string
+	for k, v := range other.additions {
+		old, ok := inj.additions[k]
+		if !ok || old != v || inj.fileNames[k] != other.fileNames[k] {
+			names = append(names, k)
+		}
+	}
+	for k := range inj.additions {
+		if _, ok := other.additions[k]; !ok {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestEnvPlan(t *testing.T) {
+	parent := []string{"PATH=/bin", "HOME=/root", "LC_ALL=C", "LC_CTYPE=C", "TOKEN=old"}
+	tests := []struct {
+		name        string
+		clean       bool
+		pass        []string
+		onConflict  string
+		wantEnv     []string
+		wantActions map[string]string
+		wantDropped []string
+		wantErr     string
+	}{
+		{
+			name:        "override by default",
+			wantEnv:     []string{"PATH=/bin", "HOME=/root", "LC_ALL=C", "LC_CTYPE=C", "API=a", "TOKEN=new"},
+			wantActions: map[string]string{"API": envAdded, "TOKEN": envOverridden},
+		},
+		{
+			name:        "keep existing",
+			onConflict:  conflictKeep,
+			wantEnv:     []string{"PATH=/bin", "HOME=/root", "LC_ALL=C", "LC_CTYPE=C", "TOKEN=old", "API=a"},
+			wantActions: map[string]string{"API": envAdded, "TOKEN": envKept},
+		},
+		{
+			name:       "error on conflict",
+			onConflict: conflictError,
+			wantErr:    "conflict with existing environment variables: TOKEN",
+		},
+		{
+			name:        "clean env with globs",
+			clean:       true,
+			pass:        []string{"PATH", "LC_*"},
+			onConflict:  conflictError,
+			wantEnv:     []string{"PATH=/bin", "LC_ALL=C", "LC_CTYPE=C", "API=a", "TOKEN=new"},
+			wantActions: map[string]string{"API": envAdded, "TOKEN": envAdded},
+			wantDropped: []string{"HOME", "TOKEN"},
+		},
+		{
+			name:        "clean env without allowlist",
+			clean:       true,
+			wantEnv:     []string{"API=a", "TOKEN=new"},
+			wantActions: map[string]string{"API": envAdded, "TOKEN": envAdded},
+			wantDropped: []string{"HOME", "LC_ALL", "LC_CTYPE", "PATH", "TOKEN"},
+		},
+		{
+			name:       "invalid policy",
+			onConflict: "merge",
+			wantErr:    `invalid --on-conflict "merge"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newEnvPlan(parent, []string{"API", "TOKEN"}, tt.clean, tt.pass, tt.onConflict)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("newEnvPlan() = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newEnvPlan() = %v", err)
+			}
+			if got := p.environ(map[string]string{"API": "a", "TOKEN": "new"}); !reflect.DeepEqual(got, tt.wantEnv) {
+				t.Errorf("environ() = %q, want %q", got, tt.wantEnv)
+			}
+			if !reflect.DeepEqual(p.actions, tt.wantActions) {
+				t.Errorf("actions = %v, want %v", p.actions, tt.wantActions)
+			}
+			if !reflect.DeepEqual(p.dropped, tt.wantDropped) {
+				t.Errorf("dropped = %v, want %v", p.dropped, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestRunCleanEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	_ = newRootCmd()
+	registerMock("mock")
+	cfgPath = writeTestConfig(t, "secrets:\n  - alias: token\n    provider: mock\n    name: t\n    env: TOKEN\n    extras:\n      value: new-token\n  - alias: api\n    provider: mock\n    name: a\n    env: API_KEY\n    extras:\n      value: api-key\n")
+	t.Setenv("TOKEN", "old-token")
+	t.Setenv("SKV_TEST_KEEP", "1")
+	t.Setenv("SKV_TEST_DROP", "1")
+
+	var dr bytes.Buffer
+	c := newRunCmd()
+	c.SetErr(&dr)
+	c.SetArgs([]string{"--all", "--dry-run", "--clean-env", "--pass-env", "PATH,SKV_TEST_K*,TOKEN", "--on-conflict", "keep", "--", "env"})
+	if err := c.Execute(); err != nil {
+		t.Fatalf("dry-run: %v", err)
+	}
+	assertStringContains(t, dr.String(), []string{"API_KEY=", "TOKEN kept (already set; source: mock)", "dropped from the parent environment", "  SKV_TEST_DROP\n"})
+	if strings.Contains(dr.String(), "  SKV_TEST_KEEP\n") || strings.Contains(dr.String(), "old-token") {
+		t.Fatalf("unexpected dry-run output %q", dr.String())
+	}
+
+	out := filepath.Join(t.TempDir(), "env")
+	c = newRunCmd()
+	c.SetArgs([]string{"--all", "--clean-env", "--pass-env", "PATH,SKV_TEST_K*,TOKEN", "--on-conflict", "keep", "--", "sh", "-c", `env > "$0"`, out})
+	if err := c.Execute(); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := "\n" + string(data)
+	assertStringContains(t, env, []string{"\nTOKEN=old-token\n", "\nAPI_KEY=api-key\n", "\nSKV_TEST_KEEP=1\n"})
+	if strings.Contains(env, "SKV_TEST_DROP") || strings.Contains(env, "\nHOME=") {
+		t.Fatalf("clean env leaked parent variables: %q", data)
+	}
+
+	c = newRunCmd()
+	c.SetArgs([]string{"--all", "--on-conflict", "error", "--", "true"})
+	err = c.Execute()
+	var ec exitCodeError
+	if !errors.As(err, &ec) || ec.code != 2 || !strings.Contains(err.Error(), "TOKEN") {
+		t.Fatalf("expected conflict error with code 2, got %v", err)
+	}
+
+	c = newRunCmd()
+	c.SetArgs([]string{"--all", "--pass-env", "PATH", "--", "true"})
+	if err := c.Execute(); err == nil || !strings.Contains(err.Error(), "requires --clean-env") {
+		t.Fatalf("expected --pass-env error, got %v", err)
+	}
+}
+
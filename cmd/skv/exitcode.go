@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Every command exits with one of these codes. Scripts and monitoring rely
+// on them, so a code never changes meaning:
+//
+//	0  success
+//	1  unexpected error
+//	2  configuration or usage error: invalid config, flags or arguments
+//	3  provider error: a backend failed, timed out or is unhealthy
+//	4  not found: a secret, alias or required variable is missing
+//	5  command error: a command could not be started or output not written
+//	6  validation error: a value failed its validate: rules
+//
+// run passes on the exit status of the command it started, or 128+N when
+// it was killed by signal N.
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e exitCodeError) Error() string { return e.err.Error() }
+
+func (e exitCodeError) Unwrap() error { return e.err }
+
+// exitStatus returns the process exit status for an error returned by the
+// root command.
+func exitStatus(err error) int {
+	var ee exitCodeError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &ee):
+		return ee.code
+	case strings.HasPrefix(err.Error(), "unknown command "):
+		// Returned by cobra before any argument validator runs.
+		return 2
+	}
+	return 1
+}
+
+// usageErrors makes flag and argument errors of cmd and its subcommands
+// exit with code 2.
+func usageErrors(cmd *cobra.Command) {
+	cmd.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return exitCodeError{code: 2, err: err}
+	})
+	if args := cmd.Args; args != nil {
+		cmd.Args = func(c *cobra.Command, a []string) error {
+			if err := args(c, a); err != nil {
+				return exitCodeError{code: 2, err: err}
+			}
+			return nil
+		}
+	}
+	for _, sub := range cmd.Commands() {
+		usageErrors(sub)
+	}
+}
+
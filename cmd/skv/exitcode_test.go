@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestExitStatus(t *testing.T) {
+	_ = newRootCmd()
+	registerMock("mock")
+	old := cfgPath
+	t.Cleanup(func() { cfgPath = old })
+	cfg := writeTestConfig(t, "secrets:\n  - alias: a\n    provider: mock\n    name: a\n    extras:\n      not_found: \"true\"\n")
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"unknown command", []string{"frobnicate"}, 2},
+		{"unknown flag", []string{"list", "--no-such-flag"}, 2},
+		{"bad arguments", []string{"get"}, 2},
+		{"bad output format", []string{"--config", cfg, "health", "--output", "xml"}, 2},
+		{"not found", []string{"--config", cfg, "get", "a"}, 4},
+		{"success", []string{"--config", cfg, "list"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := newRootCmd()
+			root.SetOut(&bytes.Buffer{})
+			root.SetErr(&bytes.Buffer{})
+			root.SetArgs(tt.args)
+			if got := exitStatus(root.Execute()); got != tt.want {
+				t.Errorf("exit status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	if got := exitStatus(errors.New("boom")); got != 1 {
+		t.Errorf("exitStatus(plain error) = %d, want 1", got)
+	}
+}
+
+// mainArgsEnv makes the test binary run main with these arguments,
+// separated by newlines, so that the exit status of the process is seen.
+const mainArgsEnv = "SKV_TEST_MAIN_ARGS"
+
+func TestMainExitStatus(t *testing.T) {
+	if args, ok := os.LookupEnv(mainArgsEnv); ok {
+		os.Args = append([]string{"skv"}, strings.Split(args, "\n")...)
+		main()
+		os.Exit(0)
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("requires echo")
+	}
+	skipIfShort(t)
+	cfg := writeTestConfig(t, "secrets:\n"+
+		"  - alias: short\n    provider: exec\n    name: abc\n    extras:\n      cmd: echo\n    validate:\n      min_length: 100\n"+
+		"  - alias: ok\n    provider: exec\n    name: abc\n    extras:\n      cmd: echo\n")
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"success", []string{"--config", cfg, "get", "ok"}, 0},
+		{"usage", []string{"get"}, 2},
+		{"validation", []string{"--config", cfg, "get", "short"}, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := exec.Command(os.Args[0], "-test.run=^TestMainExitStatus$")
+			c.Env = append(os.Environ(), mainArgsEnv+"="+strings.Join(tt.args, "\n"))
+			out, err := c.CombinedOutput()
+			var ee *exec.ExitError
+			switch {
+			case tt.want == 0 && err != nil:
+				t.Fatalf("skv %v: %v\n%s", tt.args, err, out)
+			case tt.want != 0 && (!errors.As(err, &ee) || ee.ExitCode() != tt.want):
+				t.Fatalf("skv %v: %v, want exit status %d\n%s", tt.args, err, tt.want, out)
+			}
+		})
+	}
+}
+
@@ -6,21 +6,17 @@ import (
 	"fmt"
 	"os"
 	"sort"
-	"sync"
-	"time"
 
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
 
 	"skv/internal/config"
-	"skv/internal/provider"
 )
 
 func newExportCmd() *cobra.Command {
 	var (
-		all         bool
-		secretsCSV  string
-		allExcept   string
+		sel         secretSelection
+		fail        failureFlags
 		envFile     bool
 		format      string
 		output      string
@@ -34,105 +30,35 @@ func newExportCmd() *cobra.Command {
 		Use:   "export",
 		Short: "Export secrets as env lines or a .env file",
 		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := fail.check(); err != nil {
+				return err
+			}
 			cfg, err := config.Load(cfgPath)
 			if err != nil {
 				return exitCodeError{code: 2, err: err}
 			}
-			excluded := map[string]struct{}{}
-			for _, a := range splitCSV(allExcept) {
-				excluded[a] = struct{}{}
-			}
-			requested := map[string]struct{}{}
-			if all {
-				for _, s := range cfg.Secrets {
-					if _, skip := excluded[s.Alias]; !skip {
-						requested[s.Alias] = struct{}{}
-					}
-				}
-			}
-			if secretsCSV != "" {
-				for _, a := range splitCSV(secretsCSV) {
-					requested[a] = struct{}{}
-				}
-			}
-			if len(requested) == 0 {
-				return exitCodeError{code: 2, err: fmt.Errorf("no secrets selected; use --all or --secrets")}
+			aliases, err := sel.resolve(cfg)
+			if err != nil {
+				return err
 			}
 
 			ctx := context.Background()
-			kv := map[string]string{}
-			if concurrency <= 0 {
-				concurrency = 4
+			resolver := newSecretResolver(cfg, concurrency, retries, parseRetryDelay(retryDelay))
+			resolver.agent = newAgentClient(cfg)
+			if resolver.cache, err = openCache(cfg, false); err != nil {
+				return err
 			}
-			var wg sync.WaitGroup
-			sem := make(chan struct{}, concurrency)
-			var mu sync.Mutex
-			var firstErr error
-			for alias := range requested {
-				alias := alias
-				wg.Add(1)
-				sem <- struct{}{}
-				go func() {
-					defer wg.Done()
-					defer func() { <-sem }()
-					if firstErr != nil {
-						return
-					}
-					s, ok := cfg.FindByAlias(alias)
-					if !ok {
-						mu.Lock()
-						if firstErr == nil {
-							firstErr = exitCodeError{code: 4, err: fmt.Errorf("alias not found: %s", alias)}
-						}
-						mu.Unlock()
-						return
-					}
-					spec := s.ToSpec()
-					p, ok := provider.Get(spec.Provider)
-					if !ok {
-						mu.Lock()
-						if firstErr == nil {
-							firstErr = exitCodeError{code: 3, err: fmt.Errorf("unknown provider: %s", spec.Provider)}
-						}
-						mu.Unlock()
-						return
-					}
-					d := 500 * time.Millisecond
-					if retryDelay != "" {
-						if dd, err := time.ParseDuration(retryDelay); err == nil {
-							d = dd
-						}
-					}
-					val, err := fetchWithRetry(ctx, p, spec, retries, d)
-					if err != nil {
-						mu.Lock()
-						if firstErr == nil {
-							firstErr = exitCodeError{code: 3, err: fmt.Errorf("%s: %w", alias, err)}
-						}
-						mu.Unlock()
-						return
-					}
-
-					// Apply transformation if configured
-					transformedVal, err := s.TransformValue(val)
-					if err != nil {
-						mu.Lock()
-						if firstErr == nil {
-							firstErr = exitCodeError{code: 3, err: fmt.Errorf("%s: transform error: %w", alias, err)}
-						}
-						mu.Unlock()
-						return
-					}
-					val = transformedVal
-
-					mu.Lock()
-					kv[spec.EnvName] = val
-					mu.Unlock()
-				}()
+			values, errs := resolver.resolveAll(ctx, aliases)
+			if err := fail.collect(cmd.ErrOrStderr(), cfg, aliases, errs, true); err != nil {
+				return err
 			}
-			wg.Wait()
-			if firstErr != nil {
-				return firstErr
+			kv := map[string]string{}
+			for _, alias := range aliases {
+				if _, failed := errs[alias]; failed {
+					continue
+				}
+				s, _ := cfg.FindByAlias(alias)
+				kv[s.ToSpec().EnvName] = values[alias]
 			}
 
 			out := cmd.OutOrStdout()
@@ -189,9 +115,8 @@ func newExportCmd() *cobra.Command {
 		},
 	}
 
-	c.Flags().BoolVar(&all, "all", false, "Export all configured secrets")
-	c.Flags().StringVar(&secretsCSV, "secrets", "", "Comma-separated list of aliases")
-	c.Flags().StringVar(&allExcept, "all-except", "", "Comma-separated aliases to exclude when using --all")
+	sel.addFlags(c.Flags(), "Export")
+	fail.addFlags(c.Flags(), "Export")
 	c.Flags().BoolVar(&envFile, "env-file", false, "Write in .env format (no quoting)")
 	c.Flags().StringVar(&format, "format", "", "Output format: shell|env|json|yaml")
 	c.Flags().StringVar(&output, "output", "", "Output file path (stdout if empty)")
@@ -2,14 +2,12 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"time"
 
 	"github.com/spf13/cobra"
 
 	"skv/internal/config"
-	"skv/internal/provider"
 )
 
 func newGetCmd() *cobra.Command {
@@ -30,17 +28,10 @@ func newGetCmd() *cobra.Command {
 				return exitCodeError{code: 2, err: err}
 			}
 
-			s, ok := cfg.FindByAlias(alias)
-			if !ok {
+			if _, ok := cfg.FindByAlias(alias); !ok {
 				return exitCodeError{code: 4, err: fmt.Errorf("alias not found: %s", alias)}
 			}
 
-			spec := s.ToSpec()
-			p, ok := provider.Get(spec.Provider)
-			if !ok {
-				return exitCodeError{code: 3, err: fmt.Errorf("unknown provider: %s", spec.Provider)}
-			}
-
 			ctx := context.Background()
 			if timeoutStr != "" {
 				d, err := time.ParseDuration(timeoutStr)
@@ -52,27 +43,15 @@ func newGetCmd() *cobra.Command {
 				defer cancel()
 			}
 
-			delay := 500 * time.Millisecond
-			if retryDelayStr != "" {
-				if d, err := time.ParseDuration(retryDelayStr); err == nil {
-					delay = d
-				}
-			}
-
-			val, err := fetchWithRetry(ctx, p, spec, retries, delay)
-			if err != nil {
-				if errors.Is(err, provider.ErrNotFound) {
-					return exitCodeError{code: 4, err: err}
-				}
-				return exitCodeError{code: 3, err: err}
+			resolver := newSecretResolver(cfg, 0, retries, parseRetryDelay(retryDelayStr))
+			resolver.agent = newAgentClient(cfg)
+			if resolver.cache, err = openCache(cfg, false); err != nil {
+				return err
 			}
-
-			// Apply transformation if configured
-			transformedVal, err := s.TransformValue(val)
+			val, err := resolver.resolve(ctx, alias)
 			if err != nil {
-				return exitCodeError{code: 3, err: fmt.Errorf("transform error: %w", err)}
+				return err
 			}
-			val = transformedVal
 
 			out := cmd.OutOrStdout()
 			if raw {
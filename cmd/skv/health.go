@@ -2,7 +2,11 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -15,6 +19,8 @@ func newHealthCmd() *cobra.Command {
 	var (
 		timeout    string
 		secretName string
+		deep       bool
+		output     string
 	)
 
 	cmd := &cobra.Command{
@@ -22,11 +28,17 @@ func newHealthCmd() *cobra.Command {
 		Short: "Health check for secret providers",
 		Long: `Perform health checks on configured secret providers to ensure
 they are accessible and responding correctly. This is useful for
-monitoring and alerting in production environments.`,
-		RunE: func(_ *cobra.Command, _ []string) error {
+monitoring and alerting in production environments.
+
+With --deep, fetched values are also checked against their validate: rules.
+Use "skv health serve" to run the checks on a schedule behind HTTP probes.`,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := checkOutput(output); err != nil {
+				return err
+			}
 			cfg, err := config.Load(cfgPath)
 			if err != nil {
-				return fmt.Errorf("failed to load configuration: %w", err)
+				return exitCodeError{code: 2, err: fmt.Errorf("failed to load configuration: %w", err)}
 			}
 
 			// Parse timeout
@@ -34,7 +46,7 @@ monitoring and alerting in production environments.`,
 			if timeout != "" {
 				timeoutDuration, err = time.ParseDuration(timeout)
 				if err != nil {
-					return fmt.Errorf("invalid timeout duration: %w", err)
+					return exitCodeError{code: 2, err: fmt.Errorf("invalid timeout duration: %w", err)}
 				}
 			} else {
 				timeoutDuration = 10 * time.Second
@@ -47,11 +59,18 @@ monitoring and alerting in production environments.`,
 				defer cancel()
 			}
 
-			fmt.Printf("Health check starting (timeout: %v)\n", timeoutDuration)
-			fmt.Printf("Checking %d secret(s)\n\n", len(cfg.Secrets))
+			// JSON replaces the progress text with one document.
+			out := cmd.OutOrStdout()
+			if output == outputJSON {
+				out = io.Discard
+			}
+			_, _ = fmt.Fprintf(out, "Health check starting (timeout: %v)\n", timeoutDuration)
+			_, _ = fmt.Fprintf(out, "Checking %d secret(s)\n\n", len(cfg.Secrets))
 
-			var healthyCount, totalCount int
-			var firstError error
+			resolver := newSecretResolver(cfg, 1, 0, 0)
+			resolver.skipValidation = !deep
+			rep := healthReport{Schema: schemaName("health"), Secrets: []secretHealth{}}
+			var firstError, firstWarning error
 
 			for _, secret := range cfg.Secrets {
 				// Skip if specific secret requested and this isn't it
@@ -59,57 +78,209 @@ monitoring and alerting in production environments.`,
 					continue
 				}
 
-				totalCount++
-				fmt.Printf("Checking %s (%s)... ", secret.Alias, secret.Provider)
-
-				spec := secret.ToSpec()
-				p, ok := provider.Get(spec.Provider)
-				if !ok {
-					fmt.Printf("ERROR: Provider not found\n")
+				h := checkSecretHealth(ctx, resolver, secret)
+				_, _ = fmt.Fprintf(out, "Checking %s (%s)... %s\n", h.Alias, h.Provider, h.text())
+				for _, f := range h.FailedSources {
+					_, _ = fmt.Fprintf(out, "    %s failed after %.2fs: %s\n", f.Source, float64(f.DurationMS)/1000, f.Error)
+				}
+				switch h.Status {
+				case healthOK, healthDegraded:
+					rep.Healthy++
+				case healthWarning:
+					if firstWarning == nil {
+						firstWarning = h.err
+					}
+				default:
 					if firstError == nil {
-						firstError = fmt.Errorf("provider %s not found", spec.Provider)
+						firstError = h.err
 					}
-					continue
 				}
+				rep.Secrets = append(rep.Secrets, h)
+			}
+			rep.Total = len(rep.Secrets)
+			rep.Backends, rep.Limits = backendStates(resolver), limitStates(resolver)
+			printBackendState(out, rep)
 
-				start := time.Now()
-				_, err := p.FetchSecret(ctx, spec)
-				duration := time.Since(start)
-
-				if err != nil {
-					if err == provider.ErrNotFound {
-						fmt.Printf("WARNING: Not found (%.2fs)\n", duration.Seconds())
-					} else {
-						fmt.Printf("ERROR: %v (%.2fs)\n", err, duration.Seconds())
-						if firstError == nil {
-							firstError = err
-						}
-					}
-				} else {
-					fmt.Printf("OK (%.2fs)\n", duration.Seconds())
-					healthyCount++
+			_, _ = fmt.Fprintf(out, "\nHealth check summary:\n")
+			_, _ = fmt.Fprintf(out, "  Healthy: %d/%d (%.1f%%)\n", rep.Healthy, rep.Total, float64(rep.Healthy)/float64(rep.Total)*100)
+			if output == outputJSON {
+				if err := writeJSON(cmd.OutOrStdout(), rep); err != nil {
+					return err
 				}
 			}
 
-			fmt.Printf("\nHealth check summary:\n")
-			fmt.Printf("  Healthy: %d/%d (%.1f%%)\n", healthyCount, totalCount, float64(healthyCount)/float64(totalCount)*100)
-
-			if healthyCount == totalCount {
-				fmt.Printf("All secrets are healthy!\n")
+			if rep.Healthy == rep.Total {
+				_, _ = fmt.Fprintf(out, "All secrets are healthy!\n")
 				return nil
 			}
 
-			fmt.Printf("WARNING: %d secret(s) have issues\n", totalCount-healthyCount)
-			if firstError != nil {
-				return fmt.Errorf("health check failed: %w", firstError)
+			_, _ = fmt.Fprintf(out, "WARNING: %d secret(s) have issues\n", rep.Total-rep.Healthy)
+			if firstError == nil {
+				firstError = firstWarning
 			}
-			return fmt.Errorf("health check failed: %d/%d secrets unhealthy", totalCount-healthyCount, totalCount)
+			return exitCodeError{code: exitCodeOf(firstError), err: fmt.Errorf("health check failed: %d/%d secrets unhealthy: %w", rep.Total-rep.Healthy, rep.Total, firstError)}
 		},
 	}
 
 	cmd.Flags().StringVar(&timeout, "timeout", "10s", "Timeout for each health check")
 	cmd.Flags().StringVarP(&secretName, "secret", "s", "", "Check specific secret only")
+	cmd.Flags().BoolVar(&deep, "deep", false, "Also apply validate: rules to fetched values")
+	addOutputFlag(cmd.Flags(), &output)
+	cmd.AddCommand(newHealthServeCmd())
 
 	return cmd
 }
 
+// Health statuses of a secret.
+const (
+	healthOK       = "ok"
+	healthDegraded = "degraded" // served, but not by its first source
+	healthWarning  = "warning"  // not found, or optional and unavailable
+	healthInvalid  = "invalid"  // fetched, but fails its validate: rules
+	healthError    = "error"
+)
+
+// healthReport is the result of skv health, and its JSON document.
+type healthReport struct {
+	Schema   string          `json:"schema"`
+	Healthy  int             `json:"healthy"`
+	Total    int             `json:"total"`
+	Secrets  []secretHealth  `json:"secrets"`
+	Backends []backendHealth `json:"backends"`
+	Limits   []limitState    `json:"limits"`
+}
+
+// secretHealth is the result of checking one secret. It never holds the value.
+type secretHealth struct {
+	Alias         string         `json:"alias"`
+	Provider      string         `json:"provider"`
+	Status        string         `json:"status"`
+	Source        string         `json:"source,omitempty"`
+	Error         string         `json:"error,omitempty"`
+	DurationMS    int64          `json:"duration_ms"`
+	FailedSources []sourceHealth `json:"failed_sources,omitempty"`
+
+	summary string // text shown after the status
+	err     error  // decides the exit code
+}
+
+// sourceHealth is a source that failed before another one served a secret.
+type sourceHealth struct {
+	Source     string `json:"source"`
+	Error      string `json:"error"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// backendHealth is the circuit breaker state of a backend.
+type backendHealth struct {
+	Backend string `json:"backend"`
+	Circuit string `json:"circuit"`
+}
+
+// checkSecretHealth resolves secret through r and classifies the outcome.
+func checkSecretHealth(ctx context.Context, r *secretResolver, secret config.Secret) secretHealth {
+	h := secretHealth{Alias: secret.Alias, Provider: describeProviders(secret)}
+	if missing := missingProvider(secret); missing != "" {
+		h.err = exitCodeError{code: 2, err: fmt.Errorf("provider %s not found", missing)}
+		h.Status, h.Error, h.summary = healthError, h.err.Error(), "Provider not found"
+		return h
+	}
+
+	start := time.Now()
+	_, err := r.resolve(ctx, secret.Alias)
+	duration := time.Since(start)
+	h.DurationMS = duration.Milliseconds()
+	took := fmt.Sprintf("(%.2fs)", duration.Seconds())
+
+	var skipped skippedError
+	var invalid *config.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		h.Status, h.Error, h.summary = healthInvalid, invalid.Error(), invalid.Error()+" "+took
+	case errors.As(err, &skipped):
+		h.Status, h.Error, h.summary = healthWarning, err.Error(), "Optional secret unavailable "+took
+	case errors.Is(err, provider.ErrNotFound):
+		h.Status, h.Error, h.summary = healthWarning, err.Error(), "Not found "+took
+	case err != nil:
+		h.Status, h.Error, h.summary = healthError, err.Error(), err.Error()+" "+took
+	case r.degraded(secret.Alias):
+		h.Status, h.Source = healthDegraded, r.source(secret.Alias)
+		h.summary = "OK via " + h.Source + " " + took
+		for _, a := range r.attempts(secret.Alias) {
+			if a.err != nil {
+				h.FailedSources = append(h.FailedSources, sourceHealth{Source: a.source, Error: a.err.Error(), DurationMS: a.duration.Milliseconds()})
+			}
+		}
+	default:
+		h.Status, h.Source, h.summary = healthOK, r.source(secret.Alias), took
+	}
+	h.err = err
+	return h
+}
+
+// text returns the result line shown by skv health.
+func (h secretHealth) text() string {
+	if h.Status == healthOK {
+		return "OK " + h.summary
+	}
+	return strings.ToUpper(h.Status) + ": " + h.summary
+}
+
+// missingProvider returns the first provider used by secret that is not
+// registered, or "" when all of them are available.
+func missingProvider(secret config.Secret) string {
+	for _, p := range secret.Providers() {
+		if _, ok := provider.Get(p); !ok {
+			return p
+		}
+	}
+	return ""
+}
+
+// describeProviders returns the provider name shown for a secret in reports.
+func describeProviders(secret config.Secret) string {
+	if len(secret.Sources) == 0 {
+		return secret.Provider
+	}
+	return strings.Join(secret.Providers(), ", ")
+}
+
+// backendStates returns the circuit breakers of the backends r contacted,
+// by backend.
+func backendStates(r *secretResolver) []backendHealth {
+	states := r.breakers.states()
+	out := make([]backendHealth, 0, len(states))
+	for key, state := range states {
+		out = append(out, backendHealth{Backend: key, Circuit: state})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Backend < out[j].Backend })
+	return out
+}
+
+// limitStates returns the configured limits r applied.
+func limitStates(r *secretResolver) []limitState {
+	used := r.limits.used()
+	out := make([]limitState, 0, len(used))
+	for _, l := range used {
+		out = append(out, l.state())
+	}
+	return out
+}
+
+// printBackendState reports the circuit breakers and limits used by the
+// checks, when there are any.
+func printBackendState(w io.Writer, rep healthReport) {
+	if len(rep.Backends) > 0 {
+		_, _ = fmt.Fprintf(w, "\nBackends:\n")
+		for _, b := range rep.Backends {
+			_, _ = fmt.Fprintf(w, "  %s: circuit %s\n", b.Backend, b.Circuit)
+		}
+	}
+	if len(rep.Limits) > 0 {
+		_, _ = fmt.Fprintf(w, "\nLimits:\n")
+		for _, l := range rep.Limits {
+			_, _ = fmt.Fprintf(w, "  %s\n", l)
+		}
+	}
+}
+
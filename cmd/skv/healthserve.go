@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"skv/internal/config"
+)
+
+func newHealthServeCmd() *cobra.Command {
+	var (
+		listen      string
+		intervalStr string
+		timeoutStr  string
+		concurrency int
+		deep        bool
+		sel         secretSelection
+	)
+
+	c := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve health checks over HTTP for probes and monitoring",
+		Long: `Check the configured secrets every --interval and serve the latest results
+over HTTP until SIGINT or SIGTERM:
+
+  /healthz  200 while the checks keep running (liveness)
+  /readyz   200 when the last check found every secret healthy (readiness)
+  /status   the results as a versioned JSON document
+
+Requests are answered from the results of the last check, so probe traffic
+never reaches the backends. Responses never contain secret values, but they
+do name aliases, providers and errors; listen on a private address.
+
+Without selection flags every configured secret is checked.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			interval, err := time.ParseDuration(intervalStr)
+			if err != nil || interval <= 0 {
+				return exitCodeError{code: 2, err: fmt.Errorf("invalid --interval: %q", intervalStr)}
+			}
+			timeout, err := time.ParseDuration(timeoutStr)
+			if err != nil || timeout <= 0 {
+				return exitCodeError{code: 2, err: fmt.Errorf("invalid --timeout: %q", timeoutStr)}
+			}
+			if concurrency < 1 {
+				return exitCodeError{code: 2, err: fmt.Errorf("invalid --concurrency: %d", concurrency)}
+			}
+			cfg, err := config.Load(cfgPath)
+			if err != nil {
+				return exitCodeError{code: 2, err: fmt.Errorf("failed to load configuration: %w", err)}
+			}
+			if sel.empty() {
+				sel.all = true
+			}
+			aliases, err := sel.resolve(cfg)
+			if err != nil {
+				return err
+			}
+			for _, alias := range aliases {
+				if _, ok := cfg.FindByAlias(alias); !ok {
+					return exitCodeError{code: 2, err: fmt.Errorf("alias not found: %s", alias)}
+				}
+			}
+
+			m := newHealthMonitor(cfg, aliases, interval, timeout)
+			m.concurrency, m.deep = concurrency, deep
+			ln, err := net.Listen("tcp", listen)
+			if err != nil {
+				return exitCodeError{code: 5, err: fmt.Errorf("listen on %s: %w", listen, err)}
+			}
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			slog.Info("health server listening", "addr", ln.Addr().String(), "secrets", len(aliases), "interval", interval)
+			return m.serve(ctx, ln)
+		},
+	}
+
+	c.Flags().StringVar(&listen, "listen", ":8080", "Address to serve HTTP on")
+	c.Flags().StringVar(&intervalStr, "interval", "30s", "How often the secrets are checked")
+	c.Flags().StringVar(&timeoutStr, "timeout", "10s", "Timeout for each round of checks")
+	c.Flags().IntVar(&concurrency, "concurrency", 4, "Number of secrets checked at the same time")
+	c.Flags().BoolVar(&deep, "deep", false, "Also apply validate: rules to fetched values")
+	sel.addFlags(c.Flags(), "Check")
+	return c
+}
+
+// Provider statuses of /status.
+const (
+	providerUp      = "ok"      // every secret healthy
+	providerPartial = "partial" // some secrets healthy
+	providerDown    = "down"    // no secret healthy
+)
+
+// healthStatus is the /status document.
+type healthStatus struct {
+	Schema    string            `json:"schema"`
+	Ready     bool              `json:"ready"`
+	StartedAt time.Time         `json:"started_at"`
+	CheckedAt *time.Time        `json:"checked_at,omitempty"`
+	Interval  string            `json:"interval"`
+	Healthy   int               `json:"healthy"`
+	Total     int               `json:"total"`
+	Providers []providerHealth  `json:"providers"`
+	Secrets   []monitoredHealth `json:"secrets"`
+	Backends  []backendHealth   `json:"backends"`
+	Limits    []limitState      `json:"limits"`
+}
+
+// monitoredHealth is the last check of a secret with its history.
+type monitoredHealth struct {
+	secretHealth
+	CheckedAt   time.Time  `json:"checked_at"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	Failures    int        `json:"consecutive_failures"`
+}
+
+// providerHealth aggregates the secrets of one provider.
+type providerHealth struct {
+	Provider      string `json:"provider"`
+	Status        string `json:"status"`
+	Healthy       int    `json:"healthy"`
+	Total         int    `json:"total"`
+	MaxDurationMS int64  `json:"max_duration_ms"`
+}
+
+// healthMonitor checks secrets on a schedule and answers probes from the
+// results of the last round.
+type healthMonitor struct {
+	cfg         *config.Config
+	aliases     []string
+	interval    time.Duration
+	timeout     time.Duration
+	concurrency int
+	deep        bool
+	breakers    *breakerSet
+	limits      *limiterSet
+	now         func() time.Time
+
+	mu      sync.Mutex
+	started time.Time
+	checked time.Time // end of the last round; zero before the first
+	secrets map[string]monitoredHealth
+	status  healthStatus
+}
+
+func newHealthMonitor(cfg *config.Config, aliases []string, interval, timeout time.Duration) *healthMonitor {
+	m := &healthMonitor{
+		cfg:         cfg,
+		aliases:     aliases,
+		interval:    interval,
+		timeout:     timeout,
+		concurrency: 4,
+		breakers:    newConfigBreakers(cfg),
+		limits:      newLimiterSet(cfg),
+		now:         time.Now,
+		secrets:     map[string]monitoredHealth{},
+	}
+	m.started = m.now()
+	m.status = m.build(nil)
+	return m
+}
+
+// serve checks the secrets every interval and answers HTTP requests on ln
+// until ctx is done.
+func (m *healthMonitor) serve(ctx context.Context, ln net.Listener) error {
+	srv := &http.Server{
+		Handler:           m.handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      10 * time.Second,
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.loop(ctx)
+	}()
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errc:
+	}
+	shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = srv.Shutdown(shutdown)
+	wg.Wait()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return exitCodeError{code: 5, err: fmt.Errorf("health server: %w", err)}
+	}
+	return nil
+}
+
+// loop runs a round of checks right away and then every interval.
+func (m *healthMonitor) loop(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		m.check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check runs one round of checks and publishes the results. The breakers and
+// limits are shared between rounds; resolved values are not.
+func (m *healthMonitor) check(ctx context.Context) {
+	round, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+	r := newSecretResolver(m.cfg, m.concurrency, 0, 0)
+	r.breakers, r.limits, r.skipValidation = m.breakers, m.limits, !m.deep
+
+	results := make([]secretHealth, len(m.aliases))
+	sem := make(chan struct{}, m.concurrency)
+	var wg sync.WaitGroup
+	for i, alias := range m.aliases {
+		secret, _ := m.cfg.FindByAlias(alias)
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = checkSecretHealth(round, r, *secret)
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return // shutting down; keep the last complete round
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	first, wasReady := m.checked.IsZero(), m.status.Ready
+	now := m.now()
+	for _, h := range results {
+		prev := m.secrets[h.Alias]
+		cur := monitoredHealth{secretHealth: h, CheckedAt: now, LastSuccess: prev.LastSuccess}
+		if healthy(h) {
+			cur.LastSuccess = &now
+		} else {
+			cur.Failures = prev.Failures + 1
+		}
+		m.secrets[h.Alias] = cur
+	}
+	m.checked = now
+	m.status = m.build(r)
+	// Log changes of readiness only, not every round.
+	switch {
+	case m.status.Ready && (first || !wasReady):
+		slog.Info("health checks passing", "healthy", m.status.Healthy, "total", m.status.Total)
+	case !m.status.Ready && (first || wasReady):
+		slog.Warn("health checks failing", "healthy", m.status.Healthy, "total", m.status.Total)
+	}
+}
+
+// healthy reports whether h counts as healthy, as in skv health.
+func healthy(h secretHealth) bool {
+	return h.Status == healthOK || h.Status == healthDegraded
+}
+
+// build assembles the /status document from the recorded results. r is the
+// resolver of the last round, nil before the first. m.mu must be held.
+func (m *healthMonitor) build(r *secretResolver) healthStatus {
+	st := healthStatus{
+		Schema:    schemaName("health-status"),
+		StartedAt: m.started,
+		Interval:  m.interval.String(),
+		Providers: []providerHealth{},
+		Secrets:   []monitoredHealth{},
+		Backends:  []backendHealth{},
+		Limits:    []limitState{},
+	}
+	if r == nil {
+		return st
+	}
+	checked := m.checked
+	st.CheckedAt = &checked
+
+	providers := map[string]*providerHealth{}
+	for _, alias := range m.aliases {
+		h := m.secrets[alias]
+		st.Secrets = append(st.Secrets, h)
+		p := providers[h.Provider]
+		if p == nil {
+			p = &providerHealth{Provider: h.Provider}
+			providers[h.Provider] = p
+		}
+		p.Total++
+		p.MaxDurationMS = max(p.MaxDurationMS, h.DurationMS)
+		if healthy(h.secretHealth) {
+			st.Healthy++
+			p.Healthy++
+		}
+	}
+	st.Total = len(st.Secrets)
+	st.Ready = st.Healthy == st.Total
+
+	for _, p := range providers {
+		switch p.Healthy {
+		case p.Total:
+			p.Status = providerUp
+		case 0:
+			p.Status = providerDown
+		default:
+			p.Status = providerPartial
+		}
+		st.Providers = append(st.Providers, *p)
+	}
+	sort.Slice(st.Providers, func(i, j int) bool { return st.Providers[i].Provider < st.Providers[j].Provider })
+	st.Backends, st.Limits = backendStates(r), limitStates(r)
+	return st
+}
+
+// snapshot returns the current /status document.
+func (m *healthMonitor) snapshot() healthStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+// live reports whether rounds of checks are still completing. A round may
+// take up to the timeout on top of the interval; two missed rounds are stale.
+func (m *healthMonitor) live() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	last := m.checked
+	if last.IsZero() {
+		last = m.started
+	}
+	return m.now().Sub(last) <= 2*(m.interval+m.timeout)
+}
+
+// handler routes the probe endpoints.
+func (m *healthMonitor) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		if !m.live() {
+			probeReply(w, http.StatusServiceUnavailable, "health checks stalled")
+			return
+		}
+		probeReply(w, http.StatusOK, "ok")
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, _ *http.Request) {
+		st := m.snapshot()
+		switch {
+		case st.CheckedAt == nil:
+			probeReply(w, http.StatusServiceUnavailable, "not ready: no check completed yet")
+		case !st.Ready:
+			probeReply(w, http.StatusServiceUnavailable, fmt.Sprintf("not ready: %d/%d secrets unhealthy", st.Total-st.Healthy, st.Total))
+		default:
+			probeReply(w, http.StatusOK, "ok")
+		}
+	})
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, _ *http.Request) {
+		st := m.snapshot()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if !st.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := writeJSON(w, st); err != nil {
+			slog.Debug("health status not written", "error", err)
+		}
+	})
+	return mux
+}
+
+// probeReply writes a one-line plain text probe response.
+func probeReply(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_, _ = fmt.Fprintln(w, msg)
+}
+
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"skv/internal/config"
+	"skv/internal/provider"
+)
+
+const healthServeTestConfig = `secrets:
+  - alias: api
+    provider: health-counting
+    name: app/api
+  - alias: gone
+    provider: health-counting
+    name: app/gone
+`
+
+func newTestHealthMonitor(t *testing.T, aliases ...string) (*healthMonitor, *countingProvider) {
+	t.Helper()
+	_ = newRootCmd()
+	p := &countingProvider{objects: map[string]string{"app/api": "topsecret-value"}, calls: map[string]int{}}
+	provider.Register("health-counting", p)
+	cfg, err := config.Load(writeTestConfig(t, healthServeTestConfig))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	return newHealthMonitor(cfg, aliases, time.Minute, 5*time.Second), p
+}
+
+func probe(t *testing.T, h http.Handler, path string) (int, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec.Code, rec.Body.String()
+}
+
+func TestHealthMonitorEndpoints(t *testing.T) {
+	tests := []struct {
+		name    string
+		aliases []string
+		check   bool
+		path    string
+		want    int
+		wantOut []string
+	}{
+		{"live before first check", []string{"api"}, false, "/healthz", http.StatusOK, []string{"ok"}},
+		{"not ready before first check", []string{"api"}, false, "/readyz", http.StatusServiceUnavailable, []string{"no check completed yet"}},
+		{"status before first check", []string{"api"}, false, "/status", http.StatusServiceUnavailable, []string{`"schema": "skv.health-status/v1"`, `"ready": false`}},
+		{"ready", []string{"api"}, true, "/readyz", http.StatusOK, []string{"ok"}},
+		{"not ready", []string{"api", "gone"}, true, "/readyz", http.StatusServiceUnavailable, []string{"1/2 secrets unhealthy"}},
+		{"status", []string{"api"}, true, "/status", http.StatusOK, []string{`"ready": true`, `"last_success"`, `"provider": "health-counting"`}},
+		{"unknown path", []string{"api"}, true, "/metrics", http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := newTestHealthMonitor(t, tt.aliases...)
+			if tt.check {
+				m.check(context.Background())
+			}
+			code, body := probe(t, m.handler(), tt.path)
+			if code != tt.want {
+				t.Errorf("GET %s = %d, want %d\n%s", tt.path, code, tt.want, body)
+			}
+			assertStringContains(t, body, tt.wantOut)
+			if strings.Contains(body, "topsecret-value") {
+				t.Errorf("GET %s leaks the secret value", tt.path)
+			}
+		})
+	}
+}
+
+func TestHealthMonitorStatus(t *testing.T) {
+	m, p := newTestHealthMonitor(t, "api", "gone")
+	m.check(context.Background())
+	m.check(context.Background())
+
+	// Probes are answered from the last round and never fetch.
+	for range 5 {
+		probe(t, m.handler(), "/readyz")
+		probe(t, m.handler(), "/status")
+	}
+	if p.calls["app/api"] != 2 || p.calls["app/gone"] != 2 {
+		t.Errorf("fetches = %v, want 2 per secret", p.calls)
+	}
+
+	_, body := probe(t, m.handler(), "/status")
+	var st healthStatus
+	if err := json.Unmarshal([]byte(body), &st); err != nil {
+		t.Fatalf("status is not JSON: %v\n%s", err, body)
+	}
+	if st.Healthy != 1 || st.Total != 2 || st.Ready || st.CheckedAt == nil {
+		t.Fatalf("status = %+v", st)
+	}
+	if len(st.Providers) != 1 || st.Providers[0].Status != providerPartial || st.Providers[0].Healthy != 1 {
+		t.Errorf("providers = %+v", st.Providers)
+	}
+	api, gone := st.Secrets[0], st.Secrets[1]
+	if api.Status != healthOK || api.LastSuccess == nil || api.Failures != 0 {
+		t.Errorf("api = %+v", api)
+	}
+	if gone.Status != healthWarning || gone.LastSuccess != nil || gone.Failures != 2 {
+		t.Errorf("gone = %+v", gone)
+	}
+
+	// Rounds that stop completing fail the liveness probe.
+	m.now = func() time.Time { return time.Now().Add(time.Hour) }
+	if code, _ := probe(t, m.handler(), "/healthz"); code != http.StatusServiceUnavailable {
+		t.Errorf("stalled /healthz = %d, want 503", code)
+	}
+}
+
+func TestHealthMonitorServe(t *testing.T) {
+	m, _ := newTestHealthMonitor(t, "api")
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.serve(ctx, ln) }()
+
+	url := "http://" + ln.Addr().String() + "/readyz"
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get(url)
+		if err == nil {
+			body, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("GET /readyz = %d: %s", resp.StatusCode, body)
+			}
+		} else if time.Now().After(deadline) {
+			t.Fatalf("GET /readyz: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("serve = %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("serve did not stop")
+	}
+}
+
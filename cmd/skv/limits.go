@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"skv/internal/config"
+	"skv/internal/provider"
+)
+
+// limiter enforces one configured limit: a cap on fetches in flight and a
+// token bucket for their rate. A throttled fetch pauses the bucket for the
+// Retry-After the backend asked for.
+type limiter struct {
+	name  string
+	limit config.Limit
+	sem   chan struct{} // nil when concurrency is not capped
+
+	mu          sync.Mutex
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+	fetches     int
+	throttled   int
+	waited      time.Duration
+	now         func() time.Time
+}
+
+func newLimiter(name string, l config.Limit) *limiter {
+	lim := &limiter{name: name, limit: l, now: time.Now}
+	if l.Concurrency > 0 {
+		lim.sem = make(chan struct{}, l.Concurrency)
+	}
+	lim.tokens = lim.burst()
+	return lim
+}
+
+// burst returns the bucket size: burst, else the rate, at least 1.
+func (l *limiter) burst() float64 {
+	if l.limit.Burst > 0 {
+		return float64(l.limit.Burst)
+	}
+	return math.Max(1, math.Floor(l.limit.Rate))
+}
+
+// reserve takes a token, or returns how long to wait for one.
+func (l *limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now)
+	}
+	if l.limit.Rate <= 0 {
+		return 0
+	}
+	if !l.last.IsZero() {
+		l.tokens = math.Min(l.burst(), l.tokens+now.Sub(l.last).Seconds()*l.limit.Rate)
+	}
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.limit.Rate * float64(time.Second))
+}
+
+// acquire waits for a token and a concurrency slot.
+func (l *limiter) acquire(ctx context.Context) error {
+	start := l.now()
+	for {
+		wait := l.reserve()
+		if wait <= 0 {
+			break
+		}
+		slog.Debug("waiting for rate limit", "limit", l.name, "wait", wait)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	if l.sem != nil {
+		select {
+		case l.sem <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	l.mu.Lock()
+	l.fetches++
+	l.waited += l.now().Sub(start)
+	l.mu.Unlock()
+	return nil
+}
+
+func (l *limiter) release() {
+	if l.sem != nil {
+		<-l.sem
+	}
+}
+
+// throttle records a throttled fetch and pauses new ones for retryAfter.
+func (l *limiter) throttle(retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.throttled++
+	if until := l.now().Add(retryAfter); retryAfter > 0 && until.After(l.pausedUntil) {
+		l.pausedUntil = until
+		slog.Debug("backend asked to slow down", "limit", l.name, "retry_after", retryAfter)
+	}
+}
+
+// limitState is a snapshot of a limiter for reports.
+type limitState struct {
+	Name        string  `json:"name"`
+	Concurrency int     `json:"concurrency,omitempty"`
+	Rate        float64 `json:"rate,omitempty"`
+	Burst       float64 `json:"burst,omitempty"`
+	Fetches     int     `json:"fetches"`
+	Throttled   int     `json:"throttled"`
+	WaitedMS    int64   `json:"waited_ms"`
+}
+
+func (l *limiter) state() limitState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	st := limitState{Name: l.name, Concurrency: l.limit.Concurrency, Fetches: l.fetches, Throttled: l.throttled, WaitedMS: l.waited.Milliseconds()}
+	if l.limit.Rate > 0 {
+		st.Rate, st.Burst = l.limit.Rate, l.burst()
+	}
+	return st
+}
+
+// String describes the limit and what it did, for reports.
+func (l *limiter) String() string { return l.state().String() }
+
+func (st limitState) String() string {
+	s := st.Name + ":"
+	if st.Concurrency > 0 {
+		s += fmt.Sprintf(" concurrency %d,", st.Concurrency)
+	}
+	if st.Rate > 0 {
+		s += fmt.Sprintf(" rate %g/s (burst %g),", st.Rate, st.Burst)
+	}
+	waited := time.Duration(st.WaitedMS) * time.Millisecond
+	return s + fmt.Sprintf(" %d fetch(es), %d throttled, waited %v", st.Fetches, st.Throttled, waited)
+}
+
+// limiterSet holds the limiters configured for providers and backends.
+// Like breakers, one set is shared by every fetch of a command, or of a
+// whole watch or agent session.
+type limiterSet struct {
+	limits config.LimitsConfig
+
+	mu       sync.Mutex
+	limiters map[string]*limiter // by "provider NAME" or "backend KEY"
+}
+
+func newLimiterSet(cfg *config.Config) *limiterSet {
+	return &limiterSet{limits: cfg.Limits, limiters: map[string]*limiter{}}
+}
+
+// newConfigBreakers returns breakers with the thresholds of cfg.
+func newConfigBreakers(cfg *config.Config) *breakerSet {
+	return newBreakerSet(cfg.Limits.Breaker.Threshold(), cfg.Limits.Breaker.CooldownDuration())
+}
+
+// forSpec returns the limiters that apply to spec: its provider's, then
+// its backend's. A nil set applies no limits.
+func (s *limiterSet) forSpec(spec provider.SecretSpec) []*limiter {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []*limiter
+	add := func(name string, l config.Limit, ok bool) {
+		if !ok {
+			return
+		}
+		lim, found := s.limiters[name]
+		if !found {
+			lim = newLimiter(name, l)
+			s.limiters[name] = lim
+		}
+		out = append(out, lim)
+	}
+	l, ok := s.limits.Providers[spec.Provider]
+	add("provider "+spec.Provider, l, ok)
+	key := backendKey(spec)
+	l, ok = s.limits.Backends[key]
+	add("backend "+key, l, ok)
+	return out
+}
+
+// used returns the limiters that have been applied, by name.
+func (s *limiterSet) used() []*limiter {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]*limiter, 0, len(s.limiters))
+	for _, l := range s.limiters {
+		out = append(out, l)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].name < out[j].name })
+	return out
+}
+
+// limitedProvider applies limiters and then the global concurrency limit
+// to every request sent to a provider, retries included.
+type limitedProvider struct {
+	provider.Provider
+	limiters []*limiter
+	global   chan struct{}
+}
+
+func (p limitedProvider) FetchSecret(ctx context.Context, spec provider.SecretSpec) (string, error) {
+	for i, l := range p.limiters {
+		if err := l.acquire(ctx); err != nil {
+			for _, held := range p.limiters[:i] {
+				held.release()
+			}
+			return "", err
+		}
+	}
+	defer func() {
+		for _, l := range p.limiters {
+			l.release()
+		}
+	}()
+	// The global slot is taken last so fetches waiting on a provider limit
+	// do not hold up other providers.
+	select {
+	case p.global <- struct{}{}:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	val, err := p.Provider.FetchSecret(ctx, spec)
+	<-p.global
+	var te *provider.ThrottledError
+	if errors.As(err, &te) {
+		for _, l := range p.limiters {
+			l.throttle(te.RetryAfter)
+		}
+	}
+	return val, err
+}
+
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"skv/internal/config"
+	"skv/internal/provider"
+)
+
+func TestLimiterTokenBucket(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newLimiter("provider mock", config.Limit{Rate: 2, Burst: 2})
+	l.now = func() time.Time { return now }
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		want    time.Duration
+	}{
+		{"first of burst", 0, 0},
+		{"second of burst", 0, 0},
+		{"bucket empty", 0, 500 * time.Millisecond},
+		{"refilled one token", 500 * time.Millisecond, 0},
+		{"empty again", 100 * time.Millisecond, 400 * time.Millisecond},
+	}
+	for _, s := range steps {
+		now = now.Add(s.advance)
+		if got := l.reserve(); got != s.want {
+			t.Fatalf("%s: reserve() = %v, want %v", s.name, got, s.want)
+		}
+	}
+
+	now = now.Add(time.Hour)
+	l.throttle(5 * time.Second)
+	if got := l.reserve(); got != 5*time.Second {
+		t.Fatalf("after throttle: reserve() = %v, want 5s", got)
+	}
+	if !strings.Contains(l.String(), "1 throttled") {
+		t.Errorf("String() = %q, want throttle count", l.String())
+	}
+}
+
+// gateProvider tracks how many fetches run at once.
+type gateProvider struct {
+	inFlight, peak atomic.Int32
+}
+
+func (p *gateProvider) FetchSecret(context.Context, provider.SecretSpec) (string, error) {
+	n := p.inFlight.Add(1)
+	defer p.inFlight.Add(-1)
+	for {
+		old := p.peak.Load()
+		if n <= old || p.peak.CompareAndSwap(old, n) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	return "v", nil
+}
+
+func TestLimitedProviderConcurrency(t *testing.T) {
+	cfg := &config.Config{Limits: config.LimitsConfig{
+		Providers: map[string]config.Limit{"gate": {Concurrency: 2}},
+	}}
+	set := newLimiterSet(cfg)
+	p := &gateProvider{}
+	lp := limitedProvider{Provider: p, limiters: set.forSpec(provider.SecretSpec{Provider: "gate"}), global: make(chan struct{}, 8)}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := lp.FetchSecret(context.Background(), provider.SecretSpec{Provider: "gate"}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := p.peak.Load(); got != 2 {
+		t.Errorf("peak concurrency = %d, want 2", got)
+	}
+	if used := set.used(); len(used) != 1 || !strings.Contains(used[0].String(), "8 fetch(es)") {
+		t.Errorf("used() = %v", used)
+	}
+	if got := set.forSpec(provider.SecretSpec{Provider: "other"}); len(got) != 0 {
+		t.Errorf("unconfigured provider got limiters %v", got)
+	}
+}
+
+// throttlingProvider throttles the first request, then answers.
+type throttlingProvider struct {
+	retryAfter time.Duration
+	calls      atomic.Int32
+}
+
+func (p *throttlingProvider) FetchSecret(context.Context, provider.SecretSpec) (string, error) {
+	if p.calls.Add(1) == 1 {
+		return "", &provider.ThrottledError{RetryAfter: p.retryAfter, Err: errors.New("slow down")}
+	}
+	return "v", nil
+}
+
+func TestFetchWithRetryThrottled(t *testing.T) {
+	p := &throttlingProvider{retryAfter: 1200 * time.Millisecond}
+	start := time.Now()
+	// Throttled requests are retried even without --retries.
+	v, err := fetchWithRetry(context.Background(), p, provider.SecretSpec{}, 0, 0)
+	if err != nil || v != "v" {
+		t.Fatalf("fetchWithRetry() = %q, %v", v, err)
+	}
+	if took := time.Since(start); took < p.retryAfter {
+		t.Errorf("retried after %v, want at least Retry-After %v", took, p.retryAfter)
+	}
+	if got := p.calls.Load(); got != 2 {
+		t.Errorf("calls = %d, want 2", got)
+	}
+}
+
+func TestResolverBreakerWithoutSources(t *testing.T) {
+	_ = newRootCmd()
+	registerMock("mock")
+	cfg, err := config.Load(writeTestConfig(t, `limits:
+  circuit_breaker:
+    failures: 2
+    cooldown: 1m
+secrets:
+  - alias: a
+    provider: mock
+    name: a
+    region: eu-west-1
+    extras:
+      error: down
+  - alias: b
+    provider: mock
+    name: b
+    region: eu-west-1
+    extras:
+      error: down
+  - alias: c
+    provider: mock
+    name: c
+    region: eu-west-1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newSecretResolver(cfg, 1, 0, 0)
+	for _, alias := range []string{"a", "b"} {
+		if _, err := r.resolve(context.Background(), alias); err == nil || strings.Contains(err.Error(), "circuit open") {
+			t.Fatalf("resolve(%s) = %v, want provider error", alias, err)
+		}
+	}
+	if _, err := r.resolve(context.Background(), "c"); err == nil || !strings.Contains(err.Error(), "circuit open for mock/eu-west-1") {
+		t.Fatalf("resolve(c) = %v, want open circuit", err)
+	}
+}
+
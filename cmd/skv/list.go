@@ -2,7 +2,9 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
@@ -12,22 +14,64 @@ import (
 
 func newListCmd() *cobra.Command {
 	var verbose bool
-	var format string
+	var format, output string
+	var tags, groups, selectors []string
 
 	c := &cobra.Command{
 		Use:   "list",
 		Short: "List configured secret aliases",
 		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := checkOutput(output); err != nil {
+				return err
+			}
+			if output == outputJSON && format != "" {
+				return exitCodeError{code: 2, err: errors.New("--output json cannot be combined with --format")}
+			}
 			cfg, err := config.Load(cfgPath)
 			if err != nil {
 				return exitCodeError{code: 2, err: err}
 			}
+			secrets := cfg.Secrets
+			if len(tags) > 0 || len(groups) > 0 || len(selectors) > 0 {
+				sel := secretSelection{tags: tags, groups: groups, selectors: selectors}
+				aliases, err := sel.resolve(cfg)
+				if err != nil {
+					return err
+				}
+				selected := make(map[string]struct{}, len(aliases))
+				for _, a := range aliases {
+					selected[a] = struct{}{}
+				}
+				secrets = nil
+				for _, s := range cfg.Secrets {
+					if _, ok := selected[s.Alias]; ok {
+						secrets = append(secrets, s)
+					}
+				}
+			}
 			out := cmd.OutOrStdout()
+			if output == outputJSON {
+				rep := listReport{Schema: schemaName("list"), Secrets: make([]listItem, 0, len(secrets))}
+				for _, s := range secrets {
+					rep.Secrets = append(rep.Secrets, listItem{
+						Alias:    s.Alias,
+						Provider: describeProviders(s),
+						Env:      s.ToSpec().EnvName,
+						Tags:     s.Tags,
+						Required: s.IsRequired(),
+					})
+				}
+				return writeJSON(out, rep)
+			}
 			switch format {
 			case "", "text":
-				for _, s := range cfg.Secrets {
+				for _, s := range secrets {
 					if verbose {
-						if _, err := fmt.Fprintf(out, "%s\t%s\t%s\n", s.Alias, s.Provider, s.Env); err != nil {
+						line := fmt.Sprintf("%s\t%s\t%s", s.Alias, s.Provider, s.Env)
+						if len(s.Tags) > 0 {
+							line += "\t" + strings.Join(s.Tags, ",")
+						}
+						if _, err := fmt.Fprintln(out, line); err != nil {
 							return err
 						}
 					} else {
@@ -37,10 +81,13 @@ func newListCmd() *cobra.Command {
 					}
 				}
 			case "json":
-				type item struct{ Alias, Provider, Env string }
-				arr := make([]item, 0, len(cfg.Secrets))
-				for _, s := range cfg.Secrets {
-					arr = append(arr, item{Alias: s.Alias, Provider: s.Provider, Env: s.Env})
+				type item struct {
+					Alias, Provider, Env string
+					Tags                 []string `json:",omitempty"`
+				}
+				arr := make([]item, 0, len(secrets))
+				for _, s := range secrets {
+					arr = append(arr, item{Alias: s.Alias, Provider: s.Provider, Env: s.Env, Tags: s.Tags})
 				}
 				b, _ := json.MarshalIndent(arr, "", "  ")
 				if _, err := out.Write(b); err != nil {
@@ -50,8 +97,8 @@ func newListCmd() *cobra.Command {
 					return err
 				}
 			case "yaml", "yml":
-				arr := make([]map[string]string, 0, len(cfg.Secrets))
-				for _, s := range cfg.Secrets {
+				arr := make([]map[string]string, 0, len(secrets))
+				for _, s := range secrets {
 					arr = append(arr, map[string]string{"alias": s.Alias, "provider": s.Provider, "env": s.Env})
 				}
 				b, _ := yaml.Marshal(arr)
@@ -67,6 +114,24 @@ func newListCmd() *cobra.Command {
 
 	c.Flags().BoolVarP(&verbose, "verbose", "v", false, "Show provider and env mapping")
 	c.Flags().StringVar(&format, "format", "", "Output format: text|json|yaml")
+	addOutputFlag(c.Flags(), &output)
+	c.Flags().StringSliceVar(&tags, "tag", nil, "Only list secrets with this tag (repeatable)")
+	c.Flags().StringSliceVar(&groups, "group", nil, "Only list secrets in this group (repeatable)")
+	c.Flags().StringArrayVar(&selectors, "select", nil, "Only list secrets matching a selector expression (repeatable)")
 	return c
 }
 
+// listReport is the JSON document of skv list --output json.
+type listReport struct {
+	Schema  string     `json:"schema"`
+	Secrets []listItem `json:"secrets"`
+}
+
+type listItem struct {
+	Alias    string   `json:"alias"`
+	Provider string   `json:"provider"`
+	Env      string   `json:"env"`
+	Tags     []string `json:"tags,omitempty"`
+	Required bool     `json:"required"`
+}
+
@@ -21,12 +21,13 @@ var (
 	cfgPath  string
 	logLevel string
 	logFmt   string
+	offline  bool
 )
 
 func main() {
 	root := newRootCmd()
 	if err := root.Execute(); err != nil {
-		os.Exit(1)
+		os.Exit(exitStatus(err))
 	}
 }
 
@@ -63,6 +64,7 @@ func newRootCmd() *cobra.Command {
 	cmd.PersistentFlags().StringVar(&cfgPath, "config", "", "Path to config file (overrides SKV_CONFIG and default $HOME/.skv.yaml)")
 	cmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "Log level: error|warn|info|debug")
 	cmd.PersistentFlags().StringVar(&logFmt, "log-format", "text", "Log format: text|json")
+	cmd.PersistentFlags().BoolVar(&offline, "offline", false, "Serve secrets only from the cache (also SKV_OFFLINE=1)")
 
 	// Register providers
 	provider.Register("aws-secrets-manager", awsprovider.New())
@@ -80,19 +82,24 @@ func newRootCmd() *cobra.Command {
 	// Azure App Configuration (parameter store)
 	provider.Register("azure-appconfig", azureprovider.NewAppConfig())
 	provider.Register("appconfig", azureprovider.NewAppConfig())
-	provider.Register("exec", execprovider.New())
+	provider.Register("exec", execprovider.NewWithRunner(runCommand))
 
 	cmd.AddCommand(newInitCmd())
 	cmd.AddCommand(newGetCmd())
 	cmd.AddCommand(newRunCmd())
+	cmd.AddCommand(newRenderCmd())
+	cmd.AddCommand(newMaterializeCmd())
 	cmd.AddCommand(newListCmd())
 	cmd.AddCommand(newExportCmd())
 	cmd.AddCommand(newValidateCmd())
 	cmd.AddCommand(newHealthCmd())
 	cmd.AddCommand(newWatchCmd())
+	cmd.AddCommand(newAgentCmd())
+	cmd.AddCommand(newCacheCmd())
 	cmd.AddCommand(newDoctorCmd())
 	cmd.AddCommand(newVersionCmd())
 	cmd.AddCommand(newCompletionCmd())
+	usageErrors(cmd)
 
 	return cmd
 }
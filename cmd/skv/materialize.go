@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"skv/internal/config"
+)
+
+// defaultManifest is the manifest file written next to materialized secrets.
+const defaultManifest = ".skv-manifest.json"
+
+func newMaterializeCmd() *cobra.Command {
+	var (
+		sel         secretSelection
+		dir         string
+		nameBy      string
+		modeStr     string
+		uidStr      string
+		gidStr      string
+		manifest    string
+		watch       bool
+		intervalStr string
+		timeoutStr  string
+		concurrency int
+		retries     int
+		retryDelay  string
+	)
+
+	c := &cobra.Command{
+		Use:   "materialize --dir <dir> [selection flags]",
+		Short: "Write secrets to files in a directory",
+		Long: `Write each selected secret to its own file in a directory, for init
+containers, sidecars and systemd ExecStartPre.
+
+Files are written atomically and only when their content changed. Files
+written by an earlier run whose secrets are no longer selected are removed.
+A manifest with the SHA-256 of each file is written to the directory. With
+--watch the files are kept in sync until skv is stopped.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if dir == "" {
+				return exitCodeError{code: 2, err: errors.New("--dir is required")}
+			}
+			if nameBy != "alias" && nameBy != "env" {
+				return exitCodeError{code: 2, err: fmt.Errorf("invalid --name-by %q (use alias or env)", nameBy)}
+			}
+			if !plainFileName(manifest) {
+				return exitCodeError{code: 2, err: fmt.Errorf("invalid --manifest %q: must be a file name", manifest)}
+			}
+			if !watch && cmd.Flags().Changed("interval") {
+				return exitCodeError{code: 2, err: errors.New("--interval requires --watch")}
+			}
+			mode, err := strconv.ParseUint(modeStr, 8, 32)
+			if err != nil || mode > 0o777 {
+				return exitCodeError{code: 2, err: fmt.Errorf("invalid --mode %q (use an octal mode such as 0400)", modeStr)}
+			}
+			uid, gid := -1, -1
+			if uidStr != "" {
+				if uid, err = lookupUID(uidStr); err != nil {
+					return exitCodeError{code: 2, err: fmt.Errorf("invalid --uid %q: %w", uidStr, err)}
+				}
+			}
+			if gidStr != "" {
+				if gid, err = lookupGID(gidStr); err != nil {
+					return exitCodeError{code: 2, err: fmt.Errorf("invalid --gid %q: %w", gidStr, err)}
+				}
+			}
+			timeout := time.Duration(0)
+			if timeoutStr != "" {
+				if timeout, err = time.ParseDuration(timeoutStr); err != nil {
+					return exitCodeError{code: 2, err: fmt.Errorf("invalid --timeout: %w", err)}
+				}
+			}
+			interval, err := time.ParseDuration(intervalStr)
+			if err != nil || interval <= 0 {
+				return exitCodeError{code: 2, err: fmt.Errorf("invalid --interval: %q", intervalStr)}
+			}
+
+			cfg, err := config.Load(cfgPath)
+			if err != nil {
+				return exitCodeError{code: 2, err: err}
+			}
+			aliases, err := sel.resolve(cfg)
+			if err != nil {
+				return err
+			}
+			cache, err := openCache(cfg, watch)
+			if err != nil {
+				return err
+			}
+			m := &materializer{
+				cfg:      cfg,
+				aliases:  aliases,
+				dir:      dir,
+				byEnv:    nameBy == "env",
+				mode:     os.FileMode(mode),
+				uid:      uid,
+				gid:      gid,
+				manifest: manifest,
+				timeout:  timeout,
+				breakers: newConfigBreakers(cfg),
+				limits:   newLimiterSet(cfg),
+				newResolver: func() *secretResolver {
+					r := newSecretResolver(cfg, concurrency, retries, parseRetryDelay(retryDelay))
+					if !watch {
+						// Cached values would hide rotations from --watch.
+						r.agent = newAgentClient(cfg)
+						r.cache = cache
+					}
+					return r
+				},
+			}
+			if err := m.checkNames(); err != nil {
+				return exitCodeError{code: 2, err: err}
+			}
+
+			res, err := m.sync()
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintln(cmd.OutOrStdout(), res.String()); err != nil {
+				return err
+			}
+			if !watch {
+				return nil
+			}
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			m.watch(ctx, interval)
+			return nil
+		},
+	}
+
+	sel.addFlags(c.Flags(), "Materialize")
+	c.Flags().StringVar(&dir, "dir", "", "Directory the secret files are written to (created if missing)")
+	c.Flags().StringVar(&nameBy, "name-by", "alias", "Name files by alias or env")
+	c.Flags().StringVar(&modeStr, "mode", "0400", "File mode of the secret files")
+	c.Flags().StringVar(&uidStr, "uid", "", "Owner of the secret files (user name or numeric ID)")
+	c.Flags().StringVar(&gidStr, "gid", "", "Group of the secret files (group name or numeric ID)")
+	c.Flags().StringVar(&manifest, "manifest", defaultManifest, "Name of the manifest file in --dir")
+	c.Flags().BoolVar(&watch, "watch", false, "Keep the files in sync with the secrets")
+	c.Flags().StringVar(&intervalStr, "interval", "30s", "How often --watch fetches the secrets again")
+	c.Flags().StringVar(&timeoutStr, "timeout", "", "Timeout for fetching secrets per sync (e.g., 5s, 30s)")
+	c.Flags().IntVar(&concurrency, "concurrency", 4, "Number of concurrent provider calls")
+	c.Flags().IntVar(&retries, "retries", 0, "Number of retries on transient errors")
+	c.Flags().StringVar(&retryDelay, "retry-delay", "500ms", "Delay between retries (e.g., 200ms, 1s)")
+	return c
+}
+
+// materializer writes the selected secrets to files in dir.
+type materializer struct {
+	cfg         *config.Config
+	aliases     []string
+	dir         string
+	byEnv       bool
+	mode        os.FileMode
+	uid, gid    int // -1 leaves the owner unchanged
+	manifest    string
+	timeout     time.Duration
+	breakers    *breakerSet
+	limits      *limiterSet
+	newResolver func() *secretResolver
+}
+
+// materializeManifest lists the files written by skv, so that later runs
+// remove only their own files. It holds hashes, never values.
+type materializeManifest struct {
+	UpdatedAt time.Time                `json:"updated_at"`
+	Files     map[string]manifestEntry `json:"files"`
+}
+
+type manifestEntry struct {
+	Alias  string `json:"alias"`
+	Env    string `json:"env,omitempty"`
+	SHA256 string `json:"sha256"`
+}
+
+// syncResult summarizes one sync.
+type syncResult struct {
+	dir                         string
+	written, unchanged, removed []string
+}
+
+func (r syncResult) String() string {
+	return fmt.Sprintf("materialized %d secret(s) to %s (%d written, %d unchanged, %d removed)",
+		len(r.written)+len(r.unchanged), r.dir, len(r.written), len(r.unchanged), len(r.removed))
+}
+
+// fileName returns the file name for alias.
+func (m *materializer) fileName(alias string) string {
+	if m.byEnv {
+		if s, ok := m.cfg.FindByAlias(alias); ok {
+			return s.ToSpec().EnvName
+		}
+	}
+	return alias
+}
+
+// checkNames rejects file names that are not plain or that collide.
+func (m *materializer) checkNames() error {
+	seen := map[string]string{}
+	for _, alias := range m.aliases {
+		name := m.fileName(alias)
+		if !plainFileName(name) || name == m.manifest {
+			return fmt.Errorf("secret %s: %q cannot be used as a file name", alias, name)
+		}
+		if other, ok := seen[name]; ok {
+			return fmt.Errorf("secrets %s and %s would both be written to %s", other, alias, name)
+		}
+		seen[name] = alias
+	}
+	return nil
+}
+
+// plainFileName reports whether name is a single path element.
+func plainFileName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// sync fetches the secrets and brings dir in line with them. Nothing is
+// written unless every selected secret could be fetched; optional secrets
+// that are unavailable keep their existing file.
+func (m *materializer) sync() (syncResult, error) {
+	res := syncResult{dir: m.dir}
+	ctx := context.Background()
+	if m.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.timeout)
+		defer cancel()
+	}
+	resolver := m.newResolver()
+	resolver.breakers, resolver.limits = m.breakers, m.limits
+	values, errs := resolver.resolveAll(ctx, m.aliases)
+	if err := firstResolveError(m.aliases, errs); err != nil {
+		return res, err
+	}
+
+	if err := os.MkdirAll(m.dir, 0o700); err != nil {
+		return res, exitCodeError{code: 5, err: fmt.Errorf("create %s: %w", m.dir, err)}
+	}
+	prev := m.readManifest()
+	next := materializeManifest{UpdatedAt: time.Now().UTC(), Files: map[string]manifestEntry{}}
+	selected := map[string]bool{}
+	for _, alias := range m.aliases {
+		name := m.fileName(alias)
+		selected[name] = true
+		val, ok := values[alias]
+		if !ok {
+			if e, tracked := prev.Files[name]; tracked {
+				next.Files[name] = e
+			}
+			continue
+		}
+		sum := sha256.Sum256([]byte(val))
+		entry := manifestEntry{Alias: alias, SHA256: hex.EncodeToString(sum[:])}
+		if s, ok := m.cfg.FindByAlias(alias); ok {
+			entry.Env = s.ToSpec().EnvName
+		}
+		next.Files[name] = entry
+
+		path := filepath.Join(m.dir, name)
+		if m.upToDate(path, []byte(val)) {
+			res.unchanged = append(res.unchanged, name)
+			continue
+		}
+		if err := writeFileAtomic(path, []byte(val), m.mode, m.uid, m.gid); err != nil {
+			return res, exitCodeError{code: 5, err: err}
+		}
+		res.written = append(res.written, name)
+	}
+
+	// Remove only files this tool wrote earlier, never foreign files.
+	for name := range prev.Files {
+		if selected[name] || !plainFileName(name) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(m.dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return res, exitCodeError{code: 5, err: fmt.Errorf("remove stale secret file: %w", err)}
+		}
+		res.removed = append(res.removed, name)
+	}
+	sort.Strings(res.removed)
+
+	data, err := json.MarshalIndent(next, "", "  ")
+	if err != nil {
+		return res, exitCodeError{code: 5, err: fmt.Errorf("encode manifest: %w", err)}
+	}
+	if err := writeFileAtomic(filepath.Join(m.dir, m.manifest), append(data, '\n'), m.mode, m.uid, m.gid); err != nil {
+		return res, exitCodeError{code: 5, err: err}
+	}
+	return res, nil
+}
+
+// upToDate reports whether path already holds data with the wanted mode.
+func (m *materializer) upToDate(path string, data []byte) bool {
+	fi, err := os.Lstat(path)
+	if err != nil || !fi.Mode().IsRegular() || fi.Mode().Perm() != m.mode {
+		return false
+	}
+	current, err := os.ReadFile(path)
+	return err == nil && bytes.Equal(current, data)
+}
+
+// readManifest returns the manifest of an earlier run, or an empty one.
+func (m *materializer) readManifest() materializeManifest {
+	var mf materializeManifest
+	data, err := os.ReadFile(filepath.Join(m.dir, m.manifest))
+	if err == nil {
+		if err := json.Unmarshal(data, &mf); err != nil {
+			slog.Warn("ignoring unreadable manifest; stale files will not be removed", "error", err)
+		}
+	}
+	if mf.Files == nil {
+		mf.Files = map[string]manifestEntry{}
+	}
+	return mf
+}
+
+// watch syncs every interval until ctx is done. A failed sync keeps the
+// current files.
+func (m *materializer) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		res, err := m.sync()
+		if err != nil {
+			slog.Warn("failed to sync secrets; keeping the current files", "dir", m.dir, "error", err)
+			continue
+		}
+		if len(res.written) > 0 || len(res.removed) > 0 {
+			slog.Info("secret files updated", "dir", m.dir, "written", res.written, "removed", res.removed)
+		}
+	}
+}
+
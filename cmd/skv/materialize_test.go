@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+const materializeConfig = `secrets:
+  - alias: db_password
+    provider: mock
+    name: p
+    env: DB_PASSWORD
+    extras:
+      value: hunter2
+  - alias: api_key
+    provider: mock
+    name: k
+    env: API_KEY
+    extras:
+      value: k3y
+`
+
+// waitForFile waits until path contains want.
+func waitForFile(t *testing.T, path, want string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if data, _ := os.ReadFile(path); strings.Contains(string(data), want) {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	data, _ := os.ReadFile(path)
+	t.Fatalf("%s does not contain %q: %q", filepath.Base(path), want, data)
+}
+
+func readManifest(t *testing.T, dir string) materializeManifest {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, defaultManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mf materializeManifest
+	if err := json.Unmarshal(data, &mf); err != nil {
+		t.Fatal(err)
+	}
+	return mf
+}
+
+func TestMaterialize(t *testing.T) {
+	_ = newRootCmd()
+	registerMock("mock")
+	cfgPath = writeTestConfig(t, materializeConfig)
+	dir := filepath.Join(t.TempDir(), "secrets")
+
+	run := func(args ...string) string {
+		t.Helper()
+		var out strings.Builder
+		c := newMaterializeCmd()
+		c.SetOut(&out)
+		c.SetArgs(append([]string{"--dir", dir}, args...))
+		if err := c.Execute(); err != nil {
+			t.Fatalf("materialize %v: %v", args, err)
+		}
+		return out.String()
+	}
+
+	out := run("--all", "--mode", "0440")
+	assertStringContains(t, out, []string{"materialized 2 secret(s)", "2 written"})
+	for name, want := range map[string]string{"db_password": "hunter2", "api_key": "k3y"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(data) != want {
+			t.Fatalf("%s = %q, %v; want %q", name, data, err, want)
+		}
+		if fi, _ := os.Stat(filepath.Join(dir, name)); runtime.GOOS != "windows" && fi.Mode().Perm() != 0o440 {
+			t.Fatalf("%s mode = %v, want 0440", name, fi.Mode().Perm())
+		}
+	}
+	sum := sha256.Sum256([]byte("hunter2"))
+	if e := readManifest(t, dir).Files["db_password"]; e.SHA256 != hex.EncodeToString(sum[:]) || e.Alias != "db_password" || e.Env != "DB_PASSWORD" {
+		t.Fatalf("unexpected manifest entry %+v", e)
+	}
+	manifest, _ := os.ReadFile(filepath.Join(dir, defaultManifest))
+	if strings.Contains(string(manifest), "hunter2") {
+		t.Fatal("manifest contains a secret value")
+	}
+
+	// Unchanged files are not rewritten; deselected files written by skv are
+	// removed, foreign files are kept.
+	if err := os.WriteFile(filepath.Join(dir, "foreign"), []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	out = run("-s", "db_password", "--mode", "0440")
+	assertStringContains(t, out, []string{"1 unchanged", "1 removed"})
+	if _, err := os.Stat(filepath.Join(dir, "api_key")); !os.IsNotExist(err) {
+		t.Fatalf("api_key was not removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "foreign")); err != nil {
+		t.Fatalf("foreign file removed: %v", err)
+	}
+
+	// Naming by env name replaces the alias-named files.
+	run("--all", "--name-by", "env")
+	for _, name := range []string{"DB_PASSWORD", "API_KEY"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("%s missing: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "db_password")); !os.IsNotExist(err) {
+		t.Fatalf("db_password was not removed: %v", err)
+	}
+	if len(readManifest(t, dir).Files) != 2 {
+		t.Fatalf("unexpected manifest %+v", readManifest(t, dir))
+	}
+}
+
+func TestMaterializeErrors(t *testing.T) {
+	_ = newRootCmd()
+	registerMock("mock")
+	cfgPath = writeTestConfig(t, materializeConfig+`  - alias: broken
+    provider: mock
+    name: b
+    env: API_KEY
+    extras:
+      error: "boom"
+`)
+	tests := []struct {
+		name string
+		args []string
+		code int
+		want string
+	}{
+		{"missing dir", []string{"--all"}, 2, "--dir is required"},
+		{"bad name-by", []string{"--dir", "d", "--all", "--name-by", "path"}, 2, "invalid --name-by"},
+		{"env name collision", []string{"--dir", "d", "--all", "--name-by", "env"}, 2, "would both be written to API_KEY"},
+		{"fetch failure writes nothing", []string{"--dir", "d", "-s", "db_password", "-s", "broken"}, 3, "boom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := t.TempDir()
+			args := append([]string{}, tt.args...)
+			for i, a := range args {
+				if a == "d" {
+					args[i] = filepath.Join(base, "d")
+				}
+			}
+			c := newMaterializeCmd()
+			c.SetArgs(args)
+			err := c.Execute()
+			var ee exitCodeError
+			if !errors.As(err, &ee) || ee.code != tt.code || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("materialize = %v, want code %d with %q", err, tt.code, tt.want)
+			}
+			if _, err := os.Stat(filepath.Join(base, "d", "db_password")); !os.IsNotExist(err) {
+				t.Fatalf("secret written despite error: %v", err)
+			}
+		})
+	}
+}
+
+func TestMaterializeWatch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires cat")
+	}
+	skipIfShort(t)
+	base := t.TempDir()
+	secret := filepath.Join(base, "secret")
+	dir := filepath.Join(base, "out")
+	if err := os.WriteFile(secret, []byte("v1"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_ = newRootCmd()
+	cfgPath = writeTestConfig(t, "secrets:\n  - alias: token\n    provider: exec\n    name: "+secret+"\n    extras:\n      cmd: cat\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := newMaterializeCmd()
+	c.SetContext(ctx)
+	c.SetOut(&strings.Builder{})
+	c.SetArgs([]string{"--dir", dir, "--all", "--watch", "--interval", "50ms"})
+	done := make(chan error, 1)
+	go func() { done <- c.Execute() }()
+
+	waitForFile(t, filepath.Join(dir, "token"), "v1")
+	if err := os.WriteFile(secret, []byte("v2"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	waitForFile(t, filepath.Join(dir, "token"), "v2")
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("materialize --watch: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("materialize --watch did not stop")
+	}
+}
+
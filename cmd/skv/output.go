@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/spf13/pflag"
+)
+
+// Formats for --output.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// jsonSchemaVersion versions the JSON documents written with --output json
+// and watch events. Within a version fields are only added; removing or
+// changing the meaning of one bumps it.
+const jsonSchemaVersion = 1
+
+// schemaName identifies a kind of JSON document, e.g. "skv.health/v1".
+// Every document carries it in its "schema" field.
+func schemaName(kind string) string {
+	return fmt.Sprintf("skv.%s/v%d", kind, jsonSchemaVersion)
+}
+
+// addOutputFlag registers --output.
+func addOutputFlag(fs *pflag.FlagSet, output *string) {
+	fs.StringVar(output, "output", outputText, "Output format: text or json (a versioned JSON document on stdout)")
+}
+
+// checkOutput validates an --output value.
+func checkOutput(output string) error {
+	if output != outputText && output != outputJSON {
+		return exitCodeError{code: 2, err: fmt.Errorf("invalid --output %q (use text or json)", output)}
+	}
+	return nil
+}
+
+// writeJSON writes v as indented JSON followed by a newline.
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return exitCodeError{code: 5, err: fmt.Errorf("write output: %w", err)}
+	}
+	return nil
+}
+
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestOutputJSON(t *testing.T) {
+	_ = newRootCmd()
+	registerMock("mock")
+	old := cfgPath
+	t.Cleanup(func() { cfgPath = old })
+	cfgPath = writeTestConfig(t, `secrets:
+  - alias: ok
+    provider: mock
+    name: ok
+    tags: [db]
+    extras:
+      value: s3cr3t-value
+  - alias: gone
+    provider: mock
+    name: gone
+    extras:
+      not_found: "true"
+`)
+
+	tests := []struct {
+		name     string
+		cmd      func() *cobra.Command
+		args     []string
+		schema   string
+		wantCode int // 0 means success
+		check    func(t *testing.T, doc map[string]any)
+	}{
+		{"health", newHealthCmd, nil, "skv.health/v1", 4, func(t *testing.T, doc map[string]any) {
+			if doc["healthy"] != 1.0 || doc["total"] != 2.0 {
+				t.Errorf("healthy/total = %v/%v, want 1/2", doc["healthy"], doc["total"])
+			}
+			secrets := doc["secrets"].([]any)
+			if s := secrets[0].(map[string]any); s["alias"] != "ok" || s["status"] != healthOK {
+				t.Errorf("secrets[0] = %v", s)
+			}
+			if s := secrets[1].(map[string]any); s["alias"] != "gone" || s["status"] != healthWarning {
+				t.Errorf("secrets[1] = %v", s)
+			}
+		}},
+		{"health of one secret", newHealthCmd, []string{"-s", "ok"}, "skv.health/v1", 0, nil},
+		{"validate", newValidateCmd, []string{"--check-secrets"}, "skv.validate/v1", 0, func(t *testing.T, doc map[string]any) {
+			if doc["valid"] != true || doc["secrets"] != 2.0 {
+				t.Errorf("valid/secrets = %v/%v", doc["valid"], doc["secrets"])
+			}
+			if w := doc["warnings"].([]any); len(w) != 1 || w[0].(map[string]any)["kind"] != issueNotFound {
+				t.Errorf("warnings = %v", w)
+			}
+		}},
+		{"doctor", newDoctorCmd, []string{"--auth"}, "skv.doctor/v1", 0, func(t *testing.T, doc map[string]any) {
+			if doc["ok"] != true || doc["config"].(map[string]any)["loaded"] != true {
+				t.Errorf("ok/config = %v/%v", doc["ok"], doc["config"])
+			}
+			if auth := doc["auth"].([]any); len(auth) != 2 || auth[1].(map[string]any)["status"] != "not_found" {
+				t.Errorf("auth = %v", auth)
+			}
+		}},
+		{"list", newListCmd, []string{"--tag", "db"}, "skv.list/v1", 0, func(t *testing.T, doc map[string]any) {
+			secrets := doc["secrets"].([]any)
+			if len(secrets) != 1 || secrets[0].(map[string]any)["env"] != "OK" {
+				t.Errorf("secrets = %v", secrets)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out, errOut bytes.Buffer
+			c := tt.cmd()
+			c.SilenceErrors, c.SilenceUsage = true, true
+			c.SetOut(&out)
+			c.SetErr(&errOut)
+			c.SetArgs(append(tt.args, "--output", "json"))
+			err := c.Execute()
+			if got := exitStatus(err); got != tt.wantCode {
+				t.Fatalf("exit status = %d (%v), want %d", got, err, tt.wantCode)
+			}
+			var doc map[string]any
+			if err := json.Unmarshal(out.Bytes(), &doc); err != nil {
+				t.Fatalf("stdout is not one JSON document: %v\n%s", err, out.String())
+			}
+			if doc["schema"] != tt.schema {
+				t.Errorf("schema = %v, want %s", doc["schema"], tt.schema)
+			}
+			if strings.Contains(out.String(), "s3cr3t-value") {
+				t.Error("output contains a secret value")
+			}
+			if tt.check != nil {
+				tt.check(t, doc)
+			}
+		})
+	}
+}
+
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package main
+
+import "net"
+
+// peerCredSupported reports whether peerUID can identify the peer.
+const peerCredSupported = false
+
+// peerUID is not available on this platform; the agent relies on the
+// permissions of its socket and directory.
+func peerUID(net.Conn) (int, error) {
+	return -1, errPeerCredUnsupported
+}
+
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// minRedactLen is the shortest value redacted from output; shorter values
+// would match too much unrelated text.
+const minRedactLen = 4
+
+// redactPattern is one byte sequence to hide and what replaces it.
+type redactPattern struct {
+	text        []byte
+	replacement []byte
+}
+
+// redactor replaces secret values, and common encodings of them, in a
+// stream of output.
+type redactor struct {
+	byFirst map[byte][]redactPattern // patterns by first byte, longest first
+	maxLen  int
+	seen    map[string]bool
+}
+
+// newRedactor builds a redactor for values keyed by alias. With byAlias the
+// replacement is "[alias]", otherwise "****".
+func newRedactor(values map[string]string, byAlias bool) *redactor {
+	r := &redactor{byFirst: map[byte][]redactPattern{}, seen: map[string]bool{}}
+	r.add(values, byAlias)
+	return r
+}
+
+// add registers more values. A redactor must not be changed once it is in
+// use; build a new one and hand it to redactedOutput.update instead.
+func (r *redactor) add(values map[string]string, byAlias bool) {
+	aliases := make([]string, 0, len(values))
+	for a := range values {
+		aliases = append(aliases, a)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		replacement := []byte("****")
+		if byAlias {
+			replacement = []byte("[" + alias + "]")
+		}
+		for _, form := range redactForms(values[alias]) {
+			if len(form) < minRedactLen || r.seen[form] {
+				continue
+			}
+			r.seen[form] = true
+			r.byFirst[form[0]] = append(r.byFirst[form[0]], redactPattern{text: []byte(form), replacement: replacement})
+			if len(form) > r.maxLen {
+				r.maxLen = len(form)
+			}
+		}
+	}
+	for b := range r.byFirst {
+		ps := r.byFirst[b]
+		sort.SliceStable(ps, func(i, j int) bool { return len(ps[i].text) > len(ps[j].text) })
+	}
+}
+
+// redactForms returns the value and the encodings in which it commonly
+// appears in logs.
+func redactForms(v string) []string {
+	forms := []string{v, strings.TrimSpace(v)}
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		forms = append(forms, enc.EncodeToString([]byte(v)))
+	}
+	forms = append(forms, url.QueryEscape(v), url.PathEscape(v))
+	if b, err := json.Marshal(v); err == nil {
+		// The JSON string form without quotes, e.g. a PEM with \n escapes.
+		forms = append(forms, string(b[1:len(b)-1]))
+	}
+	return forms
+}
+
+func (r *redactor) matchAt(buf []byte, i int) *redactPattern {
+	for k, p := range r.byFirst[buf[i]] {
+		if bytes.HasPrefix(buf[i:], p.text) {
+			return &r.byFirst[buf[i]][k]
+		}
+	}
+	return nil
+}
+
+// isPartial reports whether tail is a proper prefix of a pattern, i.e. a
+// value that may continue in the next chunk.
+func (r *redactor) isPartial(tail []byte) bool {
+	if len(tail) == 0 || len(tail) >= r.maxLen {
+		return false
+	}
+	for _, p := range r.byFirst[tail[0]] {
+		if len(p.text) > len(tail) && bytes.HasPrefix(p.text, tail) {
+			return true
+		}
+	}
+	return false
+}
+
+// partialSuffix returns the length of the longest suffix of tail that is a
+// proper prefix of a pattern.
+func (r *redactor) partialSuffix(tail []byte) int {
+	n := r.maxLen - 1
+	if n > len(tail) {
+		n = len(tail)
+	}
+	for k := n; k > 0; k-- {
+		if r.isPartial(tail[len(tail)-k:]) {
+			return k
+		}
+	}
+	return 0
+}
+
+// redact replaces every complete match in buf. Unless final, it holds back
+// a trailing partial match and returns it as rest.
+func (r *redactor) redact(buf []byte, final bool) (out, rest []byte) {
+	out = make([]byte, 0, len(buf))
+	last := 0
+	for i := 0; i < len(buf); {
+		if !final && r.isPartial(buf[i:]) {
+			// A longer form, e.g. padded base64, may still complete here.
+			out = append(out, buf[last:i]...)
+			return out, buf[i:]
+		}
+		if m := r.matchAt(buf, i); m != nil {
+			out = append(out, buf[last:i]...)
+			out = append(out, m.replacement...)
+			i += len(m.text)
+			last = i
+			continue
+		}
+		i++
+	}
+	cut := len(buf)
+	if !final {
+		cut -= r.partialSuffix(buf[last:])
+	}
+	out = append(out, buf[last:cut]...)
+	return out, buf[cut:]
+}
+
+// redactWriter streams redacted output to w. Output is written as soon as
+// it cannot be the start of a secret, so lines appear as the child prints
+// them; Flush writes whatever is held back.
+type redactWriter struct {
+	r *redactor
+	w io.Writer
+
+	mu      sync.Mutex
+	pending []byte
+}
+
+func (rw *redactWriter) Write(p []byte) (int, error) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	out, rest := rw.r.redact(append(rw.pending, p...), false)
+	rw.pending = append([]byte(nil), rest...)
+	if _, err := rw.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes any held-back output.
+func (rw *redactWriter) Flush() error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	out, _ := rw.r.redact(rw.pending, true)
+	rw.pending = nil
+	_, err := rw.w.Write(out)
+	return err
+}
+
+// redactedOutput connects a child's stdout or stderr to dst through a
+// redactor. The child writes to the pipe; a goroutine filters it.
+type redactedOutput struct {
+	pw   *os.File
+	rw   *redactWriter
+	done chan error
+}
+
+func newRedactedOutput(r *redactor, dst io.Writer) (*redactedOutput, error) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("create output pipe: %w", err)
+	}
+	rw := &redactWriter{r: r, w: dst}
+	o := &redactedOutput{pw: pw, rw: rw, done: make(chan error, 1)}
+	go func() {
+		_, err := io.Copy(rw, pr)
+		if ferr := rw.Flush(); err == nil {
+			err = ferr
+		}
+		_ = pr.Close()
+		o.done <- err
+	}()
+	return o, nil
+}
+
+// update switches to r, for example after the secrets changed.
+func (o *redactedOutput) update(r *redactor) {
+	o.rw.mu.Lock()
+	defer o.rw.mu.Unlock()
+	o.rw.r = r
+}
+
+// file is the write end handed to the child.
+func (o *redactedOutput) file() *os.File { return o.pw }
+
+// wait closes skv's copy of the write end and waits until everything the
+// child wrote has been filtered.
+func (o *redactedOutput) wait() error {
+	_ = o.pw.Close()
+	return <-o.done
+}
+
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRedactWriter(t *testing.T) {
+	values := map[string]string{
+		"db_password": "hunter2-s3cret",
+		"api_key":     "k/e y+1&2",
+		"short":       "abc",
+		"cert":        "-----BEGIN-----\nMIIB\n-----END-----",
+	}
+	tests := []struct {
+		name    string
+		byAlias bool
+		input   string
+		want    string
+	}{
+		{"plain value", false, "password=hunter2-s3cret\n", "password=****\n"},
+		{"alias replacement", true, "password=hunter2-s3cret\n", "password=[db_password]\n"},
+		{"base64 form", false, "auth=" + base64.StdEncoding.EncodeToString([]byte("hunter2-s3cret")) + "\n", "auth=****\n"},
+		{"url-encoded form", true, "url=https://x?key=k%2Fe+y%2B1%262\n", "url=https://x?key=[api_key]\n"},
+		{"path-encoded form", true, "/keys/k%2Fe%20y+1&2\n", "/keys/[api_key]\n"},
+		{"multi-line value", true, "cert:\n-----BEGIN-----\nMIIB\n-----END-----\ndone\n", "cert:\n[cert]\ndone\n"},
+		{"json-escaped value", true, `{"cert":"-----BEGIN-----\nMIIB\n-----END-----"}`, `{"cert":"[cert]"}`},
+		{"short values are kept", false, "abc abc\n", "abc abc\n"},
+		{"partial match is released", false, "hunter2-s3\n", "hunter2-s3\n"},
+		{"repeated values", false, "hunter2-s3crethunter2-s3cret", "********"},
+	}
+	for _, tt := range tests {
+		r := newRedactor(values, tt.byAlias)
+		t.Run(tt.name, func(t *testing.T) {
+			// Every way of splitting the input into two writes, plus one
+			// byte at a time, must give the same result.
+			for split := 0; split <= len(tt.input); split++ {
+				var out bytes.Buffer
+				rw := &redactWriter{r: r, w: &out}
+				_, _ = rw.Write([]byte(tt.input[:split]))
+				_, _ = rw.Write([]byte(tt.input[split:]))
+				if err := rw.Flush(); err != nil {
+					t.Fatal(err)
+				}
+				if out.String() != tt.want {
+					t.Fatalf("split at %d: got %q, want %q", split, out.String(), tt.want)
+				}
+			}
+			var out bytes.Buffer
+			rw := &redactWriter{r: r, w: &out}
+			for i := 0; i < len(tt.input); i++ {
+				_, _ = rw.Write([]byte{tt.input[i]})
+			}
+			_ = rw.Flush()
+			if out.String() != tt.want {
+				t.Fatalf("byte at a time: got %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactWriterStreamsLines(t *testing.T) {
+	r := newRedactor(map[string]string{"a": "hunter2-s3cret"}, false)
+	var out bytes.Buffer
+	rw := &redactWriter{r: r, w: &out}
+	_, _ = rw.Write([]byte("first line\nsecond hun"))
+	if out.String() != "first line\nsecond " {
+		t.Fatalf("output should be written up to a possible secret, got %q", out.String())
+	}
+}
+
+func TestRunRedactOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	_ = newRootCmd()
+	registerMock("mock")
+	cfgPath = writeTestConfig(t, "secrets:\n  - alias: token\n    provider: mock\n    name: t\n    env: TOKEN\n    extras:\n      value: s3cret-token\n")
+
+	capture := filepath.Join(t.TempDir(), "stdout")
+	f, err := os.Create(capture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = f
+	defer func() { os.Stdout = stdout }()
+
+	c := newRunCmd()
+	c.SetArgs([]string{"--all", "--redact-output", "--redact-style", "alias", "--", "sh", "-c", `echo "token is $TOKEN"; printf '%s' "$TOKEN" | base64`})
+	err = c.Execute()
+	os.Stdout = stdout
+	_ = f.Close()
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	got, _ := os.ReadFile(capture)
+	if strings.Contains(string(got), "s3cret") || !strings.Contains(string(got), "token is [token]\n[token]\n") {
+		t.Fatalf("unexpected output %q", got)
+	}
+}
+
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"skv/internal/config"
+)
+
+func newRenderCmd() *cobra.Command {
+	var (
+		tmplPath    string
+		outPath     string
+		modeStr     string
+		owner       string
+		watch       bool
+		intervalStr string
+		reloadCmd   string
+		timeoutStr  string
+		concurrency int
+		retries     int
+		retryDelay  string
+	)
+
+	c := &cobra.Command{
+		Use:   "render -t <template> [-o <output>]",
+		Short: "Render a config file template with secrets",
+		Long: `Render a Go template with secret values and write the result atomically.
+
+Templates can use {{ secret "alias" }}, {{ secretJSON "alias" "key" }} and
+{{ env "NAME" }}, plus the helpers available to template transforms, such as
+b64enc, json, trim and default. With --watch the template is rendered again
+every --interval and, when the output changes, it is rewritten and
+--reload-cmd is run.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if tmplPath == "" {
+				return exitCodeError{code: 2, err: errors.New("--template is required")}
+			}
+			if outPath == "-" {
+				outPath = ""
+			}
+			if watch && outPath == "" {
+				return exitCodeError{code: 2, err: errors.New("--watch requires --output")}
+			}
+			if !watch && cmd.Flags().Changed("interval") {
+				return exitCodeError{code: 2, err: errors.New("--interval requires --watch")}
+			}
+			mode, err := strconv.ParseUint(modeStr, 8, 32)
+			if err != nil || mode > 0o777 {
+				return exitCodeError{code: 2, err: fmt.Errorf("invalid --mode %q (use an octal mode such as 0640)", modeStr)}
+			}
+			uid, gid, err := parseOwner(owner)
+			if err != nil {
+				return exitCodeError{code: 2, err: err}
+			}
+			timeout := time.Duration(0)
+			if timeoutStr != "" {
+				if timeout, err = time.ParseDuration(timeoutStr); err != nil {
+					return exitCodeError{code: 2, err: fmt.Errorf("invalid --timeout: %w", err)}
+				}
+			}
+			interval, err := time.ParseDuration(intervalStr)
+			if err != nil || interval <= 0 {
+				return exitCodeError{code: 2, err: fmt.Errorf("invalid --interval: %q", intervalStr)}
+			}
+
+			cfg, err := config.Load(cfgPath)
+			if err != nil {
+				return exitCodeError{code: 2, err: err}
+			}
+			src, err := os.ReadFile(tmplPath)
+			if err != nil {
+				return exitCodeError{code: 2, err: fmt.Errorf("read template: %w", err)}
+			}
+			cache, err := openCache(cfg, watch)
+			if err != nil {
+				return err
+			}
+
+			r := &renderer{
+				cfg:      cfg,
+				name:     filepath.Base(tmplPath),
+				src:      string(src),
+				breakers: newConfigBreakers(cfg),
+				limits:   newLimiterSet(cfg),
+				newResolver: func() *secretResolver {
+					r := newSecretResolver(cfg, concurrency, retries, parseRetryDelay(retryDelay))
+					if !watch {
+						// Cached values would hide rotations from --watch.
+						r.agent = newAgentClient(cfg)
+						r.cache = cache
+					}
+					return r
+				},
+				timeout: timeout,
+			}
+			if _, err := r.parse(context.Background(), nil); err != nil {
+				return exitCodeError{code: 2, err: err}
+			}
+
+			out := renderOutput{path: outPath, mode: os.FileMode(mode), uid: uid, gid: gid, w: cmd.OutOrStdout()}
+			if !watch {
+				_, err := r.renderTo(out, nil)
+				return err
+			}
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			return r.watch(ctx, out, interval, reloadCmd)
+		},
+	}
+
+	c.Flags().StringVarP(&tmplPath, "template", "t", "", "Template file to render")
+	c.Flags().StringVarP(&outPath, "output", "o", "", "Output file (default: stdout)")
+	c.Flags().StringVar(&modeStr, "mode", "0600", "File mode of the output file")
+	c.Flags().StringVar(&owner, "owner", "", "Owner of the output file as user[:group] (names or numeric IDs)")
+	c.Flags().BoolVar(&watch, "watch", false, "Keep rendering when secrets change")
+	c.Flags().StringVar(&intervalStr, "interval", "30s", "How often --watch renders the template again")
+	c.Flags().StringVar(&reloadCmd, "reload-cmd", "", "Shell command run after the output file changed")
+	c.Flags().StringVar(&timeoutStr, "timeout", "", "Timeout for fetching secrets per render (e.g., 5s, 30s)")
+	c.Flags().IntVar(&concurrency, "concurrency", 4, "Number of concurrent provider calls")
+	c.Flags().IntVar(&retries, "retries", 0, "Number of retries on transient errors")
+	c.Flags().StringVar(&retryDelay, "retry-delay", "500ms", "Delay between retries (e.g., 200ms, 1s)")
+	return c
+}
+
+// renderer renders one template. Each render fetches the secrets it uses
+// with a fresh resolver, so --watch sees rotated values.
+type renderer struct {
+	cfg         *config.Config
+	name        string
+	src         string
+	breakers    *breakerSet
+	limits      *limiterSet
+	newResolver func() *secretResolver
+	timeout     time.Duration
+}
+
+// renderOutput is where rendered content goes: a file written atomically,
+// or w when path is empty.
+type renderOutput struct {
+	path     string
+	mode     os.FileMode
+	uid, gid int // -1 leaves the owner unchanged
+	w        io.Writer
+}
+
+// parse parses the template with functions bound to resolver. A nil
+// resolver is enough to check the syntax.
+func (r *renderer) parse(ctx context.Context, resolver *secretResolver) (*template.Template, error) {
+	secret := func(alias string) (string, error) {
+		if _, ok := r.cfg.FindByAlias(alias); !ok {
+			return "", exitCodeError{code: 4, err: fmt.Errorf("alias not found: %s", alias)}
+		}
+		return resolver.resolve(ctx, alias)
+	}
+	funcs := config.TemplateFuncs()
+	funcs["secret"] = secret
+	funcs["secretJSON"] = func(alias, key string) (string, error) {
+		v, err := secret(alias)
+		if err != nil {
+			return "", err
+		}
+		out, err := config.JSONValue(v, key)
+		if err != nil {
+			return "", fmt.Errorf("secret %s: %w", alias, err)
+		}
+		return out, nil
+	}
+	funcs["env"] = os.Getenv
+	tpl, err := template.New(r.name).Funcs(funcs).Option("missingkey=error").Parse(r.src)
+	if err != nil {
+		return nil, fmt.Errorf("parse template: %w", err)
+	}
+	return tpl, nil
+}
+
+// render fetches the secrets used by the template and returns the output.
+func (r *renderer) render() ([]byte, error) {
+	ctx := context.Background()
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	resolver := r.newResolver()
+	resolver.breakers, resolver.limits = r.breakers, r.limits
+	tpl, err := r.parse(ctx, resolver)
+	if err != nil {
+		return nil, exitCodeError{code: 2, err: err}
+	}
+	var b bytes.Buffer
+	if err := tpl.Execute(&b, nil); err != nil {
+		var ee exitCodeError
+		if errors.As(err, &ee) {
+			return nil, exitCodeError{code: ee.code, err: fmt.Errorf("render %s: %w", r.name, err)}
+		}
+		return nil, exitCodeError{code: 2, err: fmt.Errorf("render %s: %w", r.name, err)}
+	}
+	return b.Bytes(), nil
+}
+
+// renderTo renders once and writes the result unless it equals previous.
+// It returns the rendered content.
+func (r *renderer) renderTo(out renderOutput, previous []byte) ([]byte, error) {
+	data, err := r.render()
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil && bytes.Equal(data, previous) {
+		return data, nil
+	}
+	if out.path == "" {
+		_, err := out.w.Write(data)
+		return data, err
+	}
+	if err := writeFileAtomic(out.path, data, out.mode, out.uid, out.gid); err != nil {
+		return nil, exitCodeError{code: 5, err: err}
+	}
+	return data, nil
+}
+
+// watch renders every interval until ctx is done. A render that fails
+// keeps the current file; reloadCmd runs after each change.
+func (r *renderer) watch(ctx context.Context, out renderOutput, interval time.Duration, reloadCmd string) error {
+	last, err := r.renderTo(out, nil)
+	if err != nil {
+		return err
+	}
+	slog.Info("rendered template", "output", out.path)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		data, err := r.renderTo(out, last)
+		if err != nil {
+			slog.Warn("failed to render template; keeping the current output", "output", out.path, "error", err)
+			continue
+		}
+		if bytes.Equal(data, last) {
+			continue
+		}
+		last = data
+		slog.Info("secrets changed; rendered template", "output", out.path)
+		if reloadCmd == "" {
+			continue
+		}
+		rc := shellCommand(reloadCmd)
+		rc.Stdout, rc.Stderr = os.Stderr, os.Stderr
+		if err := rc.Run(); err != nil {
+			slog.Warn("reload command failed", "error", err)
+		}
+	}
+}
+
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	_ = newRootCmd()
+	registerMock("mock")
+	cfgPath = writeTestConfig(t, `secrets:
+  - alias: db_password
+    provider: mock
+    name: p
+    extras:
+      value: hunter2
+  - alias: db_creds
+    provider: mock
+    name: c
+    extras:
+      value: '{"user":"app","port":5432}'
+`)
+	t.Setenv("SKV_RENDER_HOST", "db.internal")
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantCode int
+	}{
+		{"secret", `password: {{ secret "db_password" }}`, "password: hunter2", 0},
+		{"secretJSON", `{{ secretJSON "db_creds" "user" }}:{{ secretJSON "db_creds" "port" }}`, "app:5432", 0},
+		{"env", `host: {{ env "SKV_RENDER_HOST" }}`, "host: db.internal", 0},
+		{"helpers", `{{ secret "db_password" | b64enc }}`, "aHVudGVyMg==", 0},
+		{"unknown alias", `{{ secret "nope" }}`, "", 4},
+		{"missing JSON key", `{{ secretJSON "db_creds" "password" }}`, "", 2},
+		{"syntax error", `{{ secret "db_password" `, "", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tmpl := filepath.Join(dir, "app.tmpl")
+			out := filepath.Join(dir, "app.conf")
+			if err := os.WriteFile(tmpl, []byte(tt.template), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			c := newRenderCmd()
+			c.SetArgs([]string{"-t", tmpl, "-o", out, "--mode", "0640"})
+			err := c.Execute()
+			if tt.wantCode != 0 {
+				var ee exitCodeError
+				if !errors.As(err, &ee) || ee.code != tt.wantCode {
+					t.Fatalf("render = %v, want exit code %d", err, tt.wantCode)
+				}
+				if _, err := os.Stat(out); !os.IsNotExist(err) {
+					t.Fatalf("output written despite error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("render: %v", err)
+			}
+			data, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Fatalf("output = %q, want %q", data, tt.want)
+			}
+			if runtime.GOOS != "windows" {
+				if fi, _ := os.Stat(out); fi.Mode().Perm() != 0o640 {
+					t.Fatalf("mode = %v, want 0640", fi.Mode().Perm())
+				}
+			}
+			if leftovers, _ := filepath.Glob(filepath.Join(dir, ".app.conf.tmp-*")); len(leftovers) > 0 {
+				t.Fatalf("temporary files left behind: %v", leftovers)
+			}
+		})
+	}
+}
+
+func TestRenderWatch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	skipIfShort(t)
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret")
+	out := filepath.Join(dir, "app.conf")
+	reloads := filepath.Join(dir, "reloads")
+	if err := os.WriteFile(secret, []byte("v1"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_ = newRootCmd()
+	cfgPath = writeTestConfig(t, "secrets:\n  - alias: token\n    provider: exec\n    name: "+secret+"\n    extras:\n      cmd: cat\n")
+	tmpl := filepath.Join(dir, "app.tmpl")
+	if err := os.WriteFile(tmpl, []byte(`token={{ secret "token" }}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := newRenderCmd()
+	c.SetContext(ctx)
+	c.SetArgs([]string{"-t", tmpl, "-o", out, "--watch", "--interval", "50ms", "--reload-cmd", "echo reload >> " + reloads})
+	done := make(chan error, 1)
+	go func() { done <- c.Execute() }()
+
+	waitForContent := func(path, want string) {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for time.Now().Before(deadline) {
+			if data, _ := os.ReadFile(path); string(data) == want {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		data, _ := os.ReadFile(path)
+		t.Fatalf("%s = %q, want %q", filepath.Base(path), data, want)
+	}
+	waitForContent(out, "token=v1")
+	if err := os.WriteFile(secret, []byte("v2"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	waitForContent(out, "token=v2")
+	waitForContent(reloads, "reload\n")
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("render --watch: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("render --watch did not stop")
+	}
+}
+
+func TestParseOwner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("numeric owners are not used on Windows")
+	}
+	cur, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+	uid, _ := strconv.Atoi(cur.Uid)
+	gid, _ := strconv.Atoi(cur.Gid)
+	tests := []struct {
+		in       string
+		uid, gid int
+		wantErr  string
+	}{
+		{"", -1, -1, ""},
+		{"1000", 1000, -1, ""},
+		{"1000:2000", 1000, 2000, ""},
+		{":2000", -1, 2000, ""},
+		{cur.Username, uid, -1, ""},
+		{cur.Username + ":" + cur.Gid, uid, gid, ""},
+		{"no-such-user-skv", -1, -1, "invalid --owner user"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			uid, gid, err := parseOwner(tt.in)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseOwner(%q) = %v, want %q", tt.in, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || uid != tt.uid || gid != tt.gid {
+				t.Fatalf("parseOwner(%q) = %d, %d, %v; want %d, %d", tt.in, uid, gid, err, tt.uid, tt.gid)
+			}
+		})
+	}
+}
+
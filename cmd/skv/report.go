@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/pflag"
+
+	"skv/internal/config"
+	"skv/internal/provider"
+)
+
+// Report formats for --report.
+const (
+	reportTable = "table"
+	reportJSON  = "json"
+)
+
+// Error classes of a failure report.
+const (
+	classConfig      = "config"
+	classNotFound    = "not_found"
+	classAuth        = "auth"
+	classTimeout     = "timeout"
+	classThrottled   = "throttled"
+	classCircuitOpen = "circuit_open"
+	classTransform   = "transform"
+	classValidation  = "validation"
+	classProvider    = "provider"
+)
+
+// failureFlags holds the flags shared by commands that can keep going
+// after some secrets fail to resolve (run, export).
+type failureFlags struct {
+	keepGoing  bool
+	report     string
+	reportFile string
+	partial    bool
+}
+
+func (f *failureFlags) addFlags(fs *pflag.FlagSet, verb string) {
+	fs.BoolVar(&f.keepGoing, "keep-going", false, "Attempt every selected secret and report all failures, not just the first")
+	fs.StringVar(&f.report, "report", reportTable, "Failure report format with --keep-going: table or json (json implies --keep-going and needs --report-file)")
+	fs.StringVar(&f.reportFile, "report-file", "", "Write the failure report to this file instead of stderr (implies --keep-going)")
+	fs.BoolVar(&f.partial, "partial", false, fmt.Sprintf("%s the secrets that resolved even if others failed (implies --keep-going)", verb))
+}
+
+// check validates the flags. --partial, --report json and --report-file
+// imply --keep-going. A JSON report needs its own file: stderr also carries
+// log messages, and stdout the exported values or the command's output.
+func (f *failureFlags) check() error {
+	switch f.report {
+	case reportTable:
+	case reportJSON:
+		if f.reportFile == "" {
+			return exitCodeError{code: 2, err: errors.New("--report json requires --report-file")}
+		}
+	default:
+		return exitCodeError{code: 2, err: fmt.Errorf("invalid --report %q (use table or json)", f.report)}
+	}
+	if f.partial || f.reportFile != "" {
+		f.keepGoing = true
+	}
+	return nil
+}
+
+// failure describes one alias that could not be resolved.
+type failure struct {
+	Alias    string `json:"alias"`
+	Provider string `json:"provider"`
+	Class    string `json:"class"`
+	Error    string `json:"error"`
+	Hint     string `json:"hint"`
+}
+
+// failureReport lists the failures of one resolution, in alias order.
+type failureReport struct {
+	Selected int       `json:"selected"`
+	Resolved int       `json:"resolved"`
+	Failed   int       `json:"failed"`
+	Partial  bool      `json:"partial"`
+	Failures []failure `json:"failures"`
+}
+
+// newFailureReport builds the report for aliases from the errors of
+// resolveAll. Skipped optional secrets are not failures.
+func newFailureReport(cfg *config.Config, aliases []string, errs map[string]error) *failureReport {
+	rep := &failureReport{Selected: len(aliases), Failures: []failure{}}
+	for _, alias := range aliases {
+		err, ok := errs[alias]
+		if !ok {
+			continue
+		}
+		f := failure{Alias: alias, Error: err.Error()}
+		s, found := cfg.FindByAlias(alias)
+		if found {
+			f.Provider = describeProviders(*s)
+		}
+		f.Class, f.Hint = classifyFailure(s, err)
+		rep.Failures = append(rep.Failures, f)
+	}
+	rep.Failed = len(rep.Failures)
+	rep.Resolved = rep.Selected - rep.Failed
+	return rep
+}
+
+// authMarkers are lowercase fragments of provider errors about credentials
+// or permissions. Providers do not share an error type for these.
+var authMarkers = []string{
+	"accessdenied", "access denied", "unauthorized", "unauthenticated", "forbidden",
+	"permission denied", "permissiondenied", "not authorized", "invalid token",
+	"expiredtoken", "no valid credential", "failed to refresh cached credentials",
+	"status code: 401", "status code: 403", "code: 401", "code: 403",
+}
+
+// classifyFailure returns the error class of a failed alias and a hint on
+// how to fix it. s is nil for aliases that are not configured.
+func classifyFailure(s *config.Secret, err error) (string, string) {
+	var verr *config.ValidationError
+	var terr *provider.ThrottledError
+	var xerr *config.TransformError
+	msg := strings.ToLower(err.Error())
+	switch {
+	case s == nil:
+		return classConfig, "Add the alias to the configuration or fix the selection"
+	case missingProvider(*s) != "":
+		return classConfig, fmt.Sprintf("Provider %s is not available in this build; check the provider name", missingProvider(*s))
+	case errors.As(err, &verr):
+		return classValidation, "Fix the stored value or the secret's validate: rules"
+	case exitCodeOf(err) == 4:
+		return classNotFound, "Check the name, version and region, or give the secret a default or required: false"
+	case errors.Is(err, errCircuitOpen):
+		return classCircuitOpen, "Skipped after repeated failures of the same backend; fix those first"
+	case errors.As(err, &terr):
+		return classThrottled, "Lower --concurrency or set limits for this provider"
+	case errors.Is(err, context.DeadlineExceeded):
+		return classTimeout, "Raise --timeout or the source timeout, or check network access with skv doctor --net"
+	case errors.As(err, &xerr):
+		return classTransform, "Check that the transform matches the format of the stored value"
+	}
+	for _, m := range authMarkers {
+		if strings.Contains(msg, m) {
+			return classAuth, "Check credentials and permissions with skv doctor --auth"
+		}
+	}
+	return classProvider, "Retry with --retries, or check the backend with skv doctor --net"
+}
+
+// write prints the report in format, table or json.
+func (rep *failureReport) write(w io.Writer, format string) error {
+	if format == reportJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rep)
+	}
+	if rep.Failed == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintf(w, "%d of %d secret(s) failed:\n", rep.Failed, rep.Selected); err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "  ALIAS\tPROVIDER\tCLASS\tHINT"); err != nil {
+		return err
+	}
+	for _, f := range rep.Failures {
+		if _, err := fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", f.Alias, f.Provider, f.Class, f.Hint); err != nil {
+			return err
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(w, "Errors:"); err != nil {
+		return err
+	}
+	for _, f := range rep.Failures {
+		if _, err := fmt.Fprintf(w, "  %s: %s\n", f.Alias, f.Error); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collect reports the failures of a resolution when --keep-going is set,
+// to --report-file or else w, and returns the error the command fails with:
+// the first failure in alias order, or only the first invalid value when
+// strict is off. --partial accepts whatever resolved.
+func (f *failureFlags) collect(w io.Writer, cfg *config.Config, aliases []string, errs map[string]error, strict bool) error {
+	first := firstResolveError(aliases, errs)
+	if !strict {
+		first = firstValidationError(aliases, errs)
+	}
+	if !f.keepGoing {
+		return first
+	}
+	rep := newFailureReport(cfg, aliases, errs)
+	rep.Partial = f.partial
+	if err := f.writeReport(w, rep); err != nil {
+		return err
+	}
+	if first == nil || f.partial {
+		return nil
+	}
+	return exitCodeError{code: exitCodeOf(first), err: fmt.Errorf("%d of %d secret(s) failed; first: %w", rep.Failed, rep.Selected, first)}
+}
+
+// writeReport writes rep to --report-file, or to w when none is set.
+func (f *failureFlags) writeReport(w io.Writer, rep *failureReport) error {
+	if f.reportFile == "" {
+		return rep.write(w, f.report)
+	}
+	file, err := os.OpenFile(f.reportFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600) // #nosec G304 - path chosen by the user
+	if err != nil {
+		return exitCodeError{code: 5, err: fmt.Errorf("open --report-file: %w", err)}
+	}
+	if err := rep.write(file, f.report); err != nil {
+		_ = file.Close()
+		return exitCodeError{code: 5, err: fmt.Errorf("write --report-file: %w", err)}
+	}
+	if err := file.Close(); err != nil {
+		return exitCodeError{code: 5, err: fmt.Errorf("write --report-file: %w", err)}
+	}
+	return nil
+}
+
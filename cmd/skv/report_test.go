@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"skv/internal/config"
+	"skv/internal/provider"
+)
+
+const reportTestConfig = `secrets:
+  - alias: ok
+    provider: mock
+    name: ok
+    env: OK
+    extras:
+      value: fine
+  - alias: missing
+    provider: mock
+    name: missing
+    extras:
+      not_found: "true"
+  - alias: denied
+    provider: mock
+    name: denied
+    extras:
+      error: "AccessDeniedException: not allowed"
+  - alias: short
+    provider: mock
+    name: short
+    extras:
+      value: abc
+    validate:
+      min_length: 8
+`
+
+func TestExportKeepGoing(t *testing.T) {
+	_ = newRootCmd()
+	registerMock("mock")
+
+	withTestConfig(t, reportTestConfig, func(_ string) {
+		tests := []struct {
+			name     string
+			args     []string
+			wantCode int // 0: success; else the code of the first failure, "denied"
+			wantOut  string
+			wantErr  []string
+		}{
+			{"first error only", []string{"--all"}, 3, "", nil},
+			{"keep going", []string{"--all", "--keep-going"}, 3, "", []string{
+				"3 of 4 secret(s) failed", "denied", "auth", "missing", "not_found", "short", "validation",
+			}},
+			{"partial", []string{"--all", "--partial", "--format", "env"}, 0, "OK=fine\n", []string{"3 of 4 secret(s) failed"}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				cmd := newExportCmd()
+				cmd.SilenceErrors, cmd.SilenceUsage = true, true
+				var out, errOut bytes.Buffer
+				cmd.SetOut(&out)
+				cmd.SetErr(&errOut)
+				cmd.SetArgs(tt.args)
+				err := cmd.Execute()
+				if tt.wantCode == 0 && err != nil {
+					t.Fatalf("export: %v", err)
+				}
+				if tt.wantCode != 0 && exitCodeOf(err) != tt.wantCode {
+					t.Fatalf("export error = %v (code %d), want code %d", err, exitCodeOf(err), tt.wantCode)
+				}
+				if out.String() != tt.wantOut {
+					t.Errorf("stdout = %q, want %q", out.String(), tt.wantOut)
+				}
+				assertStringContains(t, errOut.String(), tt.wantErr)
+				if len(tt.wantErr) == 0 && errOut.Len() > 0 {
+					t.Errorf("unexpected report: %s", errOut.String())
+				}
+			})
+		}
+	})
+}
+
+func TestRunReportJSON(t *testing.T) {
+	_ = newRootCmd()
+	registerMock("mock")
+
+	withTestConfig(t, reportTestConfig, func(_ string) {
+		tests := []struct {
+			name     string
+			withFile bool // pass --report-file
+			wantCode int
+		}{
+			{"needs a report file", false, 2},
+			{"report file", true, 3},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				file := filepath.Join(t.TempDir(), "report.json")
+				args := []string{"--all", "--report", "json"}
+				if tt.withFile {
+					args = append(args, "--report-file", file)
+				}
+				cmd := newRunCmd()
+				cmd.SilenceErrors, cmd.SilenceUsage = true, true
+				var errOut bytes.Buffer
+				cmd.SetOut(&bytes.Buffer{})
+				cmd.SetErr(&errOut)
+				cmd.SetArgs(append(args, "--", "true"))
+				err := cmd.Execute()
+				if code := exitCodeOf(err); code != tt.wantCode {
+					t.Fatalf("run = %v (code %d), want code %d", err, code, tt.wantCode)
+				}
+				if tt.wantCode == 2 {
+					return
+				}
+				if !strings.Contains(err.Error(), "3 of 4 secret(s) failed") {
+					t.Fatalf("run = %v, want failure of 3 secrets", err)
+				}
+				if errOut.Len() > 0 {
+					t.Errorf("report written to stderr: %s", errOut.String())
+				}
+				data, err := os.ReadFile(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var rep failureReport
+				if err := json.Unmarshal(data, &rep); err != nil {
+					t.Fatalf("report is not JSON: %v\n%s", err, data)
+				}
+				if rep.Selected != 4 || rep.Resolved != 1 || rep.Failed != 3 || len(rep.Failures) != 3 {
+					t.Fatalf("report = %+v", rep)
+				}
+				if f := rep.Failures[0]; f.Alias != "denied" || f.Provider != "mock" || f.Class != classAuth || f.Hint == "" {
+					t.Errorf("first failure = %+v", f)
+				}
+				if strings.Contains(string(data), "abc") {
+					t.Error("report contains a secret value")
+				}
+			})
+		}
+	})
+}
+
+func TestClassifyFailure(t *testing.T) {
+	_ = newRootCmd()
+	registerMock("mock")
+	s := &config.Secret{Alias: "a", Provider: "mock", Name: "a"}
+	tests := []struct {
+		name   string
+		secret *config.Secret
+		err    error
+		want   string
+	}{
+		{"unknown alias", nil, exitCodeError{code: 4, err: errors.New("alias not found: a")}, classConfig},
+		{"unknown provider", &config.Secret{Alias: "a", Provider: "nope"}, exitCodeError{code: 3, err: errors.New("unknown provider: nope")}, classConfig},
+		{"not found", s, exitCodeError{code: 4, err: provider.ErrNotFound}, classNotFound},
+		{"invalid", s, exitCodeError{code: 6, err: fmt.Errorf("a: %w", &config.ValidationError{Rule: "min_length", Reason: "too short"})}, classValidation},
+		{"circuit open", s, exitCodeError{code: 3, err: fmt.Errorf("a: %w for mock", errCircuitOpen)}, classCircuitOpen},
+		{"throttled", s, exitCodeError{code: 3, err: &provider.ThrottledError{Err: errors.New("slow down")}}, classThrottled},
+		{"timeout", s, exitCodeError{code: 3, err: fmt.Errorf("a: %w", context.DeadlineExceeded)}, classTimeout},
+		{"transform", s, exitCodeError{code: 3, err: fmt.Errorf("a: transform error: %w", &config.TransformError{Type: "json", Err: errors.New("invalid JSON")})}, classTransform},
+		{"transform text only", s, exitCodeError{code: 3, err: errors.New("a: transform error: invalid JSON")}, classProvider},
+		{"auth", s, exitCodeError{code: 3, err: errors.New("a: Code: 403. Errors: permission denied")}, classAuth},
+		{"other", s, exitCodeError{code: 3, err: errors.New("a: connection refused")}, classProvider},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			class, hint := classifyFailure(tt.secret, tt.err)
+			if class != tt.want || hint == "" {
+				t.Errorf("classifyFailure() = %q, %q; want class %q with a hint", class, hint, tt.want)
+			}
+		})
+	}
+}
+
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"skv/internal/config"
+	"skv/internal/provider"
+)
+
+// secretResolver fetches and transforms secrets for a single command
+// invocation. Results are memoized per alias so inputs shared by several
+// composite secrets are fetched once, and provider calls are bounded by a
+// concurrency limit. Dependencies are resolved concurrently.
+type secretResolver struct {
+	cfg        *config.Config
+	retries    int
+	retryDelay time.Duration
+	sem        chan struct{}
+	breakers   *breakerSet  // per-backend circuit breakers
+	limits     *limiterSet  // per-provider and per-backend limits
+	agent      *agentClient // serves values from a running agent when set
+	cache      *secretCache // encrypted on-disk cache of fetched values when set
+
+	skipValidation bool // do not apply validate: rules to fetched values
+
+	mu      sync.Mutex
+	results map[string]*resolveResult
+	flights map[string]*fetchFlight // by fetchKey
+}
+
+type resolveResult struct {
+	done     chan struct{}
+	value    string
+	source   string // where the value came from, for reports; never the value
+	attempts []sourceAttempt
+	err      error
+}
+
+// sourceAttempt records one try of a source while resolving an alias.
+type sourceAttempt struct {
+	source   string
+	err      error
+	duration time.Duration
+}
+
+// skippedError marks an optional secret that could not be resolved. It is
+// not reported as a failure by resolveAll.
+type skippedError struct{ err error }
+
+func (e skippedError) Error() string { return e.err.Error() }
+
+func (e skippedError) Unwrap() error { return e.err }
+
+func newSecretResolver(cfg *config.Config, concurrency, retries int, retryDelay time.Duration) *secretResolver {
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+	return &secretResolver{
+		cfg:        cfg,
+		retries:    retries,
+		retryDelay: retryDelay,
+		sem:        make(chan struct{}, concurrency),
+		breakers:   newConfigBreakers(cfg),
+		limits:     newLimiterSet(cfg),
+		results:    map[string]*resolveResult{},
+		flights:    map[string]*fetchFlight{},
+	}
+}
+
+// resolveAll resolves the given aliases concurrently and returns the values
+// and errors keyed by alias. Optional secrets that could not be resolved
+// appear in neither map.
+func (r *secretResolver) resolveAll(ctx context.Context, aliases []string) (map[string]string, map[string]error) {
+	values := make(map[string]string, len(aliases))
+	errs := map[string]error{}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for _, alias := range aliases {
+		alias := alias
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			val, err := r.resolve(ctx, alias)
+			mu.Lock()
+			defer mu.Unlock()
+			var skipped skippedError
+			switch {
+			case errors.As(err, &skipped):
+			case err != nil:
+				errs[alias] = err
+			default:
+				values[alias] = val
+			}
+		}()
+	}
+	wg.Wait()
+	return values, errs
+}
+
+// resolve returns the transformed value for alias. Composite secrets have
+// their inputs resolved first. The dependency graph is checked for cycles
+// when the configuration is loaded, so waiting on a dependency cannot
+// deadlock.
+func (r *secretResolver) resolve(ctx context.Context, alias string) (string, error) {
+	r.mu.Lock()
+	if res, ok := r.results[alias]; ok {
+		r.mu.Unlock()
+		select {
+		case <-res.done:
+			return res.value, res.err
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	res := &resolveResult{done: make(chan struct{})}
+	r.results[alias] = res
+	r.mu.Unlock()
+
+	res.value, res.source, res.err = r.fromAgent(ctx, alias)
+	if errors.Is(res.err, errAgentUnavailable) {
+		res.value, res.source, res.err = r.cached(ctx, alias, &res.attempts)
+	}
+	if res.err == nil {
+		slog.Debug("resolved secret", "alias", alias, "source", res.source)
+	}
+	close(res.done)
+	return res.value, res.err
+}
+
+// fromAgent asks the agent for alias. It returns errAgentUnavailable when
+// no agent is configured or it cannot serve the request. Values the agent
+// returns were validated, so it is skipped when validation is off. The
+// agent fetches live, so it is also skipped offline.
+func (r *secretResolver) fromAgent(ctx context.Context, alias string) (string, string, error) {
+	if r.agent == nil || r.skipValidation || (r.cache != nil && r.cache.offline) {
+		return "", "", errAgentUnavailable
+	}
+	val, source, err := r.agent.get(ctx, alias)
+	if errors.Is(err, errAgentUnavailable) {
+		slog.Debug("fetching directly", "alias", alias, "reason", err)
+	}
+	return val, source, err
+}
+
+// cached resolves alias through the on-disk cache when one is open: a
+// fresh value is served without asking the provider, fetched values are
+// stored, and a stale value stands in when the provider fails. Offline,
+// only the cache is used.
+func (r *secretResolver) cached(ctx context.Context, alias string, attempts *[]sourceAttempt) (string, string, error) {
+	s, ok := r.cfg.FindByAlias(alias)
+	if r.cache == nil || !ok {
+		return r.load(ctx, alias, attempts)
+	}
+	ttl := r.cfg.CacheTTL(s)
+	hit, found := r.cache.get(s, ttl)
+	now := time.Now()
+	if r.cache.offline {
+		if found {
+			if !hit.entry.fresh(now) {
+				slog.Debug("serving expired value offline", "alias", alias, "fetched_at", hit.entry.FetchedAt)
+			}
+			return hit.value, "cache", nil
+		}
+		err := exitCodeError{code: 4, err: fmt.Errorf("%s: not in the cache (offline)", alias)}
+		switch {
+		case s.Default != nil:
+			slog.Warn("using default value", "alias", alias, "error", err)
+			return *s.Default, "default", nil
+		case !s.IsRequired():
+			slog.Warn("optional secret unavailable", "alias", alias, "error", err)
+			return "", "", skippedError{err: err}
+		}
+		return "", "", err
+	}
+	if found && hit.entry.fresh(now) {
+		return hit.value, "cache", nil
+	}
+
+	val, source, err := r.load(ctx, alias, attempts)
+	switch {
+	case err == nil && source != "default":
+		if !r.skipValidation {
+			if perr := r.cache.put(s, ttl, val, source); perr != nil {
+				slog.Warn("cannot cache secret", "alias", alias, "error", perr)
+			}
+		}
+	case err != nil && found && exitCodeOf(err) == 3 && r.cache.usable(hit.entry, now):
+		// Only provider failures fall back; a missing or invalid value is
+		// an answer the stale value must not hide.
+		slog.Warn("provider failed, using cached value", "alias", alias, "fetched_at", hit.entry.FetchedAt.Format(time.RFC3339), "error", err)
+		return hit.value, "cache (stale)", nil
+	}
+	return val, source, err
+}
+
+// source reports where the value of a resolved alias came from: the
+// provider name, "fallback: <source>" or "default". It is empty for
+// aliases that were not resolved.
+func (r *secretResolver) source(alias string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if res, ok := r.results[alias]; ok {
+		select {
+		case <-res.done:
+			return res.source
+		default:
+		}
+	}
+	return ""
+}
+
+// attempts returns the sources tried while resolving alias, in order.
+func (r *secretResolver) attempts(alias string) []sourceAttempt {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if res, ok := r.results[alias]; ok {
+		select {
+		case <-res.done:
+			return res.attempts
+		default:
+		}
+	}
+	return nil
+}
+
+// degraded reports whether alias was resolved, but not from its first source.
+func (r *secretResolver) degraded(alias string) bool {
+	for _, a := range r.attempts(alias) {
+		if a.err != nil {
+			return r.source(alias) != ""
+		}
+	}
+	return r.source(alias) == "default"
+}
+
+// load resolves alias from its primary source (or its ordered sources),
+// then its fallback, then its default value. Optional secrets that cannot
+// be resolved return a skippedError. Every source tried is appended to
+// attempts.
+func (r *secretResolver) load(ctx context.Context, alias string, attempts *[]sourceAttempt) (string, string, error) {
+	s, ok := r.cfg.FindByAlias(alias)
+	if !ok {
+		return "", "", exitCodeError{code: 4, err: fmt.Errorf("alias not found: %s", alias)}
+	}
+
+	var val, source string
+	var err error
+	if len(s.Sources) > 0 {
+		val, source, err = r.fetchSources(ctx, s, attempts)
+	} else {
+		start := time.Now()
+		val, source, err = r.fetchPrimary(ctx, s)
+		*attempts = append(*attempts, sourceAttempt{source: source, err: err, duration: time.Since(start)})
+	}
+	if err != nil && s.Fallback != nil {
+		start := time.Now()
+		fval, fsource, ferr := r.fetchFallback(ctx, s)
+		*attempts = append(*attempts, sourceAttempt{source: fsource, err: ferr, duration: time.Since(start)})
+		if ferr == nil {
+			slog.Debug("primary source failed, using fallback", "alias", alias, "fallback", fsource, "error", err)
+			val, source, err = fval, fsource, nil
+		} else {
+			err = exitCodeError{code: exitCodeOf(err), err: fmt.Errorf("%w; %s: %v", err, fsource, ferr)}
+		}
+	}
+	if err != nil {
+		if s.Default != nil {
+			slog.Warn("using default value", "alias", alias, "error", err)
+			return *s.Default, "default", nil
+		}
+		if !s.IsRequired() {
+			slog.Warn("optional secret unavailable", "alias", alias, "error", err)
+			return "", "", skippedError{err: err}
+		}
+		return "", "", err
+	}
+
+	// Apply transformation if configured
+	transformedVal, err := s.TransformValue(val)
+	if err != nil {
+		return "", "", exitCodeError{code: 3, err: fmt.Errorf("%s: transform error: %w", alias, err)}
+	}
+	if !r.skipValidation {
+		if err := s.CheckValue(transformedVal); err != nil {
+			return "", "", exitCodeError{code: 6, err: fmt.Errorf("%s: %w", alias, err)}
+		}
+	}
+	return transformedVal, source, nil
+}
+
+// fetchPrimary fetches the raw value of s from its own provider, or renders
+// it when s is composite.
+func (r *secretResolver) fetchPrimary(ctx context.Context, s *config.Secret) (string, string, error) {
+	if s.IsComposite() {
+		v, err := r.render(ctx, s)
+		return v, config.CompositeProvider, err
+	}
+	spec := s.ToSpec()
+	if err := r.applyRefs(ctx, s, &spec); err != nil {
+		return "", "", err
+	}
+	v, err := r.fetchSpec(ctx, spec)
+	return v, spec.Provider, err
+}
+
+// fetchSources tries the ordered sources of s until one succeeds. Backends
+// are guarded by circuit breakers so that an outage is skipped quickly once
+// detected, and each attempt honors the source timeout.
+func (r *secretResolver) fetchSources(ctx context.Context, s *config.Secret, attempts *[]sourceAttempt) (string, string, error) {
+	base := s.ToSpec()
+	if err := r.applyRefs(ctx, s, &base); err != nil {
+		return "", base.Provider, err
+	}
+	var lastErr error
+	var msgs []string
+	for i, src := range s.Sources {
+		source := fmt.Sprintf("source %d: %s", i+1, src)
+		start := time.Now()
+		val, err := r.fetchSource(ctx, src, base)
+		*attempts = append(*attempts, sourceAttempt{source: source, err: err, duration: time.Since(start)})
+		if err == nil {
+			return val, source, nil
+		}
+		slog.Debug("source failed", "alias", s.Alias, "source", source, "error", err)
+		lastErr = err
+		msgs = append(msgs, fmt.Sprintf("%s: %v", source, err))
+	}
+	return "", "", exitCodeError{code: exitCodeOf(lastErr), err: fmt.Errorf("%s: all sources failed: %s", s.Alias, strings.Join(msgs, "; "))}
+}
+
+// fetchSource fetches a single entry of a sources list.
+func (r *secretResolver) fetchSource(ctx context.Context, src config.Source, base provider.SecretSpec) (string, error) {
+	if src.Alias != "" {
+		return r.resolve(ctx, src.Alias)
+	}
+	if d := src.TimeoutDuration(); d > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+	return r.fetchSpec(ctx, src.Apply(base))
+}
+
+// backendKey identifies the backend a spec talks to, for circuit breaking
+// and limits. It includes only location fields, never credentials.
+func backendKey(spec provider.SecretSpec) string {
+	parts := []string{spec.Provider}
+	for _, k := range []string{"region", "address", "vault_url", "endpoint", "project", "profile"} {
+		if v := spec.Extras[k]; v != "" {
+			parts = append(parts, v)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// fetchFallback fetches the raw value of s from its fallback source.
+func (r *secretResolver) fetchFallback(ctx context.Context, s *config.Secret) (string, string, error) {
+	source := "fallback: " + s.Fallback.String()
+	if s.Fallback.Alias != "" {
+		v, err := r.resolve(ctx, s.Fallback.Alias)
+		return v, source, err
+	}
+	spec := s.ToSpec()
+	if err := r.applyRefs(ctx, s, &spec); err != nil {
+		return "", source, err
+	}
+	v, err := r.fetchSpec(ctx, s.Fallback.Apply(spec))
+	return v, source, err
+}
+
+// fetchSpec fetches a single spec from its provider, honoring the circuit
+// breaker of its backend, the configured limits and retry settings.
+// Fetches of the same backend object are shared within the resolver.
+func (r *secretResolver) fetchSpec(ctx context.Context, spec provider.SecretSpec) (string, error) {
+	p, ok := provider.Get(spec.Provider)
+	if !ok {
+		return "", exitCodeError{code: 3, err: fmt.Errorf("unknown provider: %s", spec.Provider)}
+	}
+	v, err := r.fetchCoalesced(ctx, p, spec)
+	if err != nil {
+		if errors.Is(err, provider.ErrNotFound) {
+			return "", exitCodeError{code: 4, err: fmt.Errorf("%s: %w", spec.Alias, err)}
+		}
+		return "", exitCodeError{code: 3, err: fmt.Errorf("%s: %w", spec.Alias, err)}
+	}
+	return v, nil
+}
+
+// exitCodeOf returns the exit code carried by err, or 3 when it has none.
+func exitCodeOf(err error) int {
+	var ee exitCodeError
+	if errors.As(err, &ee) {
+		return ee.code
+	}
+	return 3
+}
+
+// applyRefs resolves the aliases referenced by credential fields of s and
+// substitutes their values into the spec extras.
+func (r *secretResolver) applyRefs(ctx context.Context, s *config.Secret, spec *provider.SecretSpec) error {
+	if len(s.Refs) == 0 {
+		return nil
+	}
+	deps := make([]string, 0, len(s.Refs))
+	for _, dep := range s.Refs {
+		deps = append(deps, dep)
+	}
+	values, errs := r.resolveAll(ctx, deps)
+	if err := r.dependencyError(s.Alias, deps, errs); err != nil {
+		return err
+	}
+	for key, dep := range s.Refs {
+		v, ok := values[dep]
+		if !ok {
+			return exitCodeError{code: 4, err: fmt.Errorf("%s: %s reference %s is unavailable", s.Alias, key, dep)}
+		}
+		spec.Extras[key] = v
+	}
+	return nil
+}
+
+// dependencyError wraps the first failed dependency of alias, keeping its exit code.
+func (r *secretResolver) dependencyError(alias string, deps []string, errs map[string]error) error {
+	sort.Strings(deps)
+	for _, dep := range deps {
+		if err, ok := errs[dep]; ok {
+			var ee exitCodeError
+			if errors.As(err, &ee) {
+				return exitCodeError{code: ee.code, err: fmt.Errorf("%s: input %w", alias, ee.err)}
+			}
+			return exitCodeError{code: 3, err: fmt.Errorf("%s: input %s: %w", alias, dep, err)}
+		}
+	}
+	return nil
+}
+
+// render resolves the composite inputs of s concurrently and renders its template.
+func (r *secretResolver) render(ctx context.Context, s *config.Secret) (string, error) {
+	if s.Composite == nil {
+		return "", exitCodeError{code: 2, err: fmt.Errorf("%s: composite block is missing", s.Alias)}
+	}
+	deps := s.Dependencies()
+	values, errs := r.resolveAll(ctx, deps)
+	if err := r.dependencyError(s.Alias, deps, errs); err != nil {
+		return "", err
+	}
+	out, err := s.Composite.Render(s.Alias, values)
+	if err != nil {
+		return "", exitCodeError{code: 3, err: fmt.Errorf("%s: %w", s.Alias, err)}
+	}
+	return out, nil
+}
+
+// firstResolveError returns the error of the first alias, in the given
+// order, that failed to resolve.
+func firstResolveError(aliases []string, errs map[string]error) error {
+	for _, a := range aliases {
+		if err, ok := errs[a]; ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// firstValidationError returns the first error, in alias order, caused by a
+// value failing its validate: rules. Such values are never usable, so
+// callers fail on them even when other fetch errors are tolerated.
+func firstValidationError(aliases []string, errs map[string]error) error {
+	for _, a := range aliases {
+		var verr *config.ValidationError
+		if err, ok := errs[a]; ok && errors.As(err, &verr) {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseRetryDelay parses a --retry-delay value, falling back to 500ms when
+// the value is empty or invalid.
+func parseRetryDelay(s string) time.Duration {
+	d := 500 * time.Millisecond
+	if s != "" {
+		if dd, err := time.ParseDuration(s); err == nil {
+			d = dd
+		}
+	}
+	return d
+}
+
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"skv/internal/config"
+)
+
+func TestResolverFallbackDefaultOptional(t *testing.T) {
+	_ = newRootCmd()
+	registerMock("mock")
+
+	cfgText := `secrets:
+  - alias: replica
+    provider: mock
+    name: replica
+    extras:
+      value: from-replica
+  - alias: via_alias
+    provider: mock
+    name: primary
+    extras:
+      error: region down
+    fallback: replica
+  - alias: via_inline
+    provider: mock
+    name: primary
+    extras:
+      not_found: "true"
+    fallback:
+      region: us-west-2
+      extras:
+        not_found: "false"
+        value: from-us-west-2
+  - alias: with_default
+    provider: mock
+    name: flag
+    extras:
+      not_found: "true"
+    default: "off"
+  - alias: optional
+    provider: mock
+    name: opt
+    extras:
+      not_found: "true"
+    required: false
+  - alias: required
+    provider: mock
+    name: req
+    extras:
+      error: boom
+    fallback: optional
+`
+	cfg, err := config.Load(writeTestConfig(t, cfgText))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	r := newSecretResolver(cfg, 2, 0, 0)
+	aliases := []string{"via_alias", "via_inline", "with_default", "optional", "required"}
+	values, errs := r.resolveAll(context.Background(), aliases)
+
+	want := map[string]struct{ value, source string }{
+		"via_alias":    {"from-replica", "fallback: alias replica"},
+		"via_inline":   {"from-us-west-2", "fallback: us-west-2"},
+		"with_default": {"off", "default"},
+	}
+	for alias, w := range want {
+		if values[alias] != w.value {
+			t.Errorf("%s = %q, want %q", alias, values[alias], w.value)
+		}
+		if got := r.source(alias); got != w.source {
+			t.Errorf("%s source = %q, want %q", alias, got, w.source)
+		}
+	}
+	if _, ok := values["optional"]; ok {
+		t.Errorf("optional secret should be skipped")
+	}
+	if _, ok := errs["optional"]; ok {
+		t.Errorf("optional secret should not be reported as an error: %v", errs["optional"])
+	}
+	var ee exitCodeError
+	if err := errs["required"]; !errors.As(err, &ee) || ee.code != 3 {
+		t.Errorf("required secret with failed fallback: got %v", err)
+	}
+}
+
+func TestResolverSourcesFailover(t *testing.T) {
+	_ = newRootCmd()
+	registerMock("mock")
+
+	cfgText := `secrets:
+  - alias: dr
+    provider: mock
+    name: dr
+    extras:
+      value: from-dr
+  - alias: db
+    provider: mock
+    name: db
+    sources:
+      - region: us-east-1
+        timeout: 20ms
+        extras:
+          delay: 1s
+      - region: us-west-2
+        extras:
+          error: unavailable
+      - dr
+  - alias: down
+    provider: mock
+    name: down
+    sources:
+      - region: eu-west-1
+        extras:
+          error: unavailable
+`
+	cfg, err := config.Load(writeTestConfig(t, cfgText))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	r := newSecretResolver(cfg, 2, 0, 0)
+	val, err := r.resolve(context.Background(), "db")
+	if err != nil || val != "from-dr" {
+		t.Fatalf("resolve(db) = %q, %v", val, err)
+	}
+	if got := r.source("db"); got != "source 3: alias dr" {
+		t.Errorf("source = %q", got)
+	}
+	if !r.degraded("db") {
+		t.Errorf("db should be reported as degraded")
+	}
+	attempts := r.attempts("db")
+	if len(attempts) != 3 || !errors.Is(attempts[0].err, context.DeadlineExceeded) || attempts[1].err == nil {
+		t.Errorf("unexpected attempts: %+v", attempts)
+	}
+	if _, err := r.resolve(context.Background(), "dr"); err != nil || r.degraded("dr") {
+		t.Errorf("dr should resolve from its primary: %v", err)
+	}
+
+	// Repeated failures open the breaker for the backend.
+	shared := newBreakerSet(3, time.Minute)
+	for i := 0; i < 4; i++ {
+		r := newSecretResolver(cfg, 1, 0, 0)
+		r.breakers = shared
+		_, err := r.resolve(context.Background(), "down")
+		if err == nil || !strings.Contains(err.Error(), "all sources failed") {
+			t.Fatalf("resolve(down) = %v", err)
+		}
+		if i == 3 && !strings.Contains(err.Error(), "circuit open for mock/eu-west-1") {
+			t.Errorf("expected open circuit after repeated failures, got %v", err)
+		}
+	}
+}
+
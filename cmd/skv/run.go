@@ -4,18 +4,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"os/exec"
-	"sort"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
 
 	"skv/internal/config"
-	"skv/internal/provider"
 )
 
 // isTerminal checks if the given file descriptor is a terminal
@@ -25,10 +24,8 @@ func isTerminal(fd uintptr) bool {
 
 func newRunCmd() *cobra.Command {
 	var (
-		secretsCSV   string
-		secretsList  []string
-		all          bool
-		allExceptCSV string
+		sel          secretSelection
+		fail         failureFlags
 		dryRun       bool
 		strict       bool
 		mask         bool
@@ -38,6 +35,18 @@ func newRunCmd() *cobra.Command {
 		retryDelay   string
 		requireEnv   []string
 		requireAlias []string
+		asFile       []string
+		fileStore    string
+		processGroup bool
+		graceStr     string
+		execMode     bool
+		redactOutput bool
+		redactStyle  string
+		cleanEnv     bool
+		passEnvs     []string
+		onConflict   string
+		watchMode    bool
+		supervise    superviseFlags
 	)
 
 	strict = true
@@ -59,41 +68,35 @@ func newRunCmd() *cobra.Command {
 				return exitCodeError{code: 2, err: errors.New("no command provided; use skv run -- <cmd> [args]")}
 			}
 
+			if execMode {
+				if err := checkExecFlags(cmd); err != nil {
+					return err
+				}
+			}
+			if redactStyle != "mask" && redactStyle != "alias" {
+				return exitCodeError{code: 2, err: fmt.Errorf("invalid --redact-style %q (use mask or alias)", redactStyle)}
+			}
+			if err := fail.check(); err != nil {
+				return err
+			}
+			if len(passEnvs) > 0 && !cleanEnv {
+				return exitCodeError{code: 2, err: errors.New("--pass-env requires --clean-env")}
+			}
+
 			cfg, err := config.Load(cfgPath)
 			if err != nil {
 				return exitCodeError{code: 2, err: err}
 			}
 
-			excluded := map[string]struct{}{}
-			for _, a := range strings.Split(allExceptCSV, ",") {
-				if t := strings.TrimSpace(a); t != "" {
-					excluded[t] = struct{}{}
-				}
-			}
-			requested := map[string]struct{}{}
-			if all {
-				for _, s := range cfg.Secrets {
-					if _, skip := excluded[s.Alias]; !skip {
-						requested[s.Alias] = struct{}{}
-					}
-				}
-			}
-			if secretsCSV != "" {
-				for _, a := range strings.Split(secretsCSV, ",") {
-					a = strings.TrimSpace(a)
-					if a != "" {
-						requested[a] = struct{}{}
-					}
-				}
+			aliases, err := sel.resolve(cfg)
+			if err != nil {
+				return err
 			}
-			for _, a := range secretsList {
+			requested := make(map[string]struct{}, len(aliases))
+			for _, a := range aliases {
 				requested[a] = struct{}{}
 			}
 
-			if len(requested) == 0 {
-				return exitCodeError{code: 2, err: errors.New("no secrets selected; use --all or --secrets/-s")}
-			}
-
 			timeout := time.Duration(0)
 			if timeoutStr != "" {
 				d, err := time.ParseDuration(timeoutStr)
@@ -102,108 +105,70 @@ func newRunCmd() *cobra.Command {
 				}
 				timeout = d
 			}
-			ctx := context.Background()
-			if timeout > 0 {
-				var cancel context.CancelFunc
-				ctx, cancel = context.WithTimeout(ctx, timeout)
-				defer cancel()
+			grace, err := time.ParseDuration(graceStr)
+			if err != nil || grace < 0 {
+				return exitCodeError{code: 2, err: fmt.Errorf("invalid --grace-period: %q", graceStr)}
 			}
-
-			envAdditions := map[string]string{}
-			if concurrency <= 0 {
-				concurrency = 4
+			watch, err := parseSuperviseOptions(cmd, watchMode, supervise)
+			if err != nil {
+				return exitCodeError{code: 2, err: err}
 			}
-			aliases := make([]string, 0, len(requested))
-			for a := range requested {
-				aliases = append(aliases, a)
+			if watch.onChange == onChangeSignal {
+				// Memfds are sealed, so files that must be rewritten live on tmpfs.
+				switch fileStore {
+				case fileStoreMemfd:
+					return exitCodeError{code: 2, err: errors.New("--on-change signal cannot update memfd secret files; use --file-store tmpfs")}
+				case fileStoreAuto:
+					fileStore = fileStoreTmpfs
+				}
+			}
+			if _, err := newSecretFiles(fileStore); err != nil {
+				return exitCodeError{code: 2, err: err}
 			}
-			sort.Strings(aliases)
-			var wg sync.WaitGroup
-			sem := make(chan struct{}, concurrency)
-			var mu sync.Mutex
-			var firstErr error
-			for _, alias := range aliases {
-				alias := alias
-				wg.Add(1)
-				sem <- struct{}{}
-				go func() {
-					defer wg.Done()
-					defer func() { <-sem }()
-					if firstErr != nil {
-						return
-					}
-					s, ok := cfg.FindByAlias(alias)
-					if !ok {
-						if strict {
-							mu.Lock()
-							if firstErr == nil {
-								firstErr = exitCodeError{code: 4, err: fmt.Errorf("alias not found: %s", alias)}
-							}
-							mu.Unlock()
-						}
-						return
-					}
-					spec := s.ToSpec()
-					p, ok := provider.Get(spec.Provider)
-					if !ok {
-						if strict {
-							mu.Lock()
-							if firstErr == nil {
-								firstErr = exitCodeError{code: 3, err: fmt.Errorf("unknown provider: %s", spec.Provider)}
-							}
-							mu.Unlock()
-						}
-						return
-					}
-					d := 500 * time.Millisecond
-					if retryDelay != "" {
-						if dd, err := time.ParseDuration(retryDelay); err == nil {
-							d = dd
-						}
-					}
-					val, err := fetchWithRetry(ctx, p, spec, retries, d)
-					if err != nil {
-						if strict {
-							mu.Lock()
-							if firstErr == nil {
-								if errors.Is(err, provider.ErrNotFound) {
-									firstErr = exitCodeError{code: 4, err: fmt.Errorf("%s: %w", alias, err)}
-								} else {
-									firstErr = exitCodeError{code: 3, err: fmt.Errorf("%s: %w", alias, err)}
-								}
-							}
-							mu.Unlock()
-						}
-						return
-					}
-
-					// Apply transformation if configured
-					transformedVal, err := s.TransformValue(val)
-					if err != nil {
-						if strict {
-							mu.Lock()
-							if firstErr == nil {
-								firstErr = exitCodeError{code: 3, err: fmt.Errorf("%s: transform error: %w", alias, err)}
-							}
-							mu.Unlock()
-						}
-						return
-					}
-					val = transformedVal
 
-					mu.Lock()
-					envAdditions[spec.EnvName] = val
-					mu.Unlock()
-				}()
+			// Composite secrets pull in their inputs; the resolver fetches
+			// them as needed, but only the selected aliases are injected.
+			// The timeout bounds fetching only; the child is not tied to it.
+			breakers, limits := newConfigBreakers(cfg), newLimiterSet(cfg)
+			cache, err := openCache(cfg, watchMode)
+			if err != nil {
+				return err
+			}
+			fetch := func() (*injection, error) {
+				ctx := context.Background()
+				if timeout > 0 {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, timeout)
+					defer cancel()
+				}
+				resolver := newSecretResolver(cfg, concurrency, retries, parseRetryDelay(retryDelay))
+				resolver.breakers, resolver.limits = breakers, limits
+				if !watchMode {
+					// Cached values would hide rotations from --watch.
+					resolver.agent = newAgentClient(cfg)
+					resolver.cache = cache
+				}
+				values, errs := resolver.resolveAll(ctx, aliases)
+				if err := fail.collect(cmd.ErrOrStderr(), cfg, aliases, errs, strict); err != nil {
+					return nil, err
+				}
+				return newInjection(cfg, resolver, aliases, values, errs, asFile), nil
 			}
-			wg.Wait()
-			if firstErr != nil {
-				return firstErr
+			inj, err := fetch()
+			if err != nil {
+				return err
+			}
+			newPlan := func(inj *injection) (*envPlan, error) {
+				return newEnvPlan(os.Environ(), inj.names(), cleanEnv, passEnvs, onConflict)
+			}
+			plan, err := newPlan(inj)
+			if err != nil {
+				return exitCodeError{code: 2, err: err}
 			}
 
 			// require-env check
 			for _, e := range requireEnv {
-				if _, ok := envAdditions[e]; !ok {
+				if _, ok := inj.additions[e]; !ok {
 					return exitCodeError{code: 4, err: fmt.Errorf("required env missing: %s", e)}
 				}
 			}
@@ -228,64 +193,172 @@ func newRunCmd() *cobra.Command {
 				if _, err := fmt.Fprintln(errw, "[dry-run] with environment additions:"); err != nil {
 					return err
 				}
-				keys := make([]string, 0, len(envAdditions))
-				for k := range envAdditions {
-					keys = append(keys, k)
-				}
-				sort.Strings(keys)
-				for _, k := range keys {
-					shown := envAdditions[k]
-					if mask {
+				for _, k := range inj.names() {
+					if plan.actions[k] == envKept {
+						if _, err := fmt.Fprintf(errw, "  %s kept (already set; source: %s)\n", k, inj.sources[k]); err != nil {
+							return err
+						}
+						continue
+					}
+					shown := inj.additions[k]
+					if name, ok := inj.fileNames[k]; ok {
+						shown = fmt.Sprintf("<file %s>", name)
+					} else if mask {
 						shown = maskValue(shown)
 					}
-					if _, err := fmt.Fprintf(errw, "  %s=%s\n", k, shown); err != nil {
+					note := ""
+					if plan.actions[k] == envOverridden {
+						note = ", overridden"
+					}
+					if _, err := fmt.Fprintf(errw, "  %s=%s (source: %s%s)\n", k, shown, inj.sources[k], note); err != nil {
+						return err
+					}
+				}
+				for _, k := range inj.skipped {
+					if _, err := fmt.Fprintf(errw, "  %s skipped (optional, unavailable)\n", k); err != nil {
+						return err
+					}
+				}
+				if cleanEnv {
+					if _, err := fmt.Fprintf(errw, "[dry-run] dropped from the parent environment (%d):\n", len(plan.dropped)); err != nil {
 						return err
 					}
+					for _, k := range plan.dropped {
+						if _, err := fmt.Fprintf(errw, "  %s\n", k); err != nil {
+							return err
+						}
+					}
 				}
 				return nil
 			}
 
-			// #nosec G204 - the command is intentionally user-provided
-			cexec := exec.CommandContext(ctx, command, commandArgs...)
-			cexec.Stdout = os.Stdout
-			cexec.Stderr = os.Stderr
+			if execMode {
+				if len(inj.files(plan)) > 0 {
+					return exitCodeError{code: 2, err: errors.New("--exec cannot deliver secrets as files; they would never be cleaned up")}
+				}
+				path, err := exec.LookPath(command)
+				if err != nil {
+					return exitCodeError{code: 5, err: err}
+				}
+				env := plan.environ(inj.additions)
+				// On success this does not return: the command replaces skv.
+				return exitCodeError{code: 5, err: fmt.Errorf("exec %s: %w", command, execReplace(path, cmdArgs, env))}
+			}
 
 			// In CI environments or when stdin is not a terminal, use /dev/null to prevent hanging
-			if os.Getenv("CI") != "" || !isTerminal(os.Stdin.Fd()) {
-				devNull, err := os.Open("/dev/null")
-				if err == nil {
-					cexec.Stdin = devNull
+			stdin := os.Stdin
+			interactive := os.Getenv("CI") == "" && isTerminal(os.Stdin.Fd())
+			if !interactive {
+				if devNull, err := os.Open("/dev/null"); err == nil {
+					stdin = devNull
 					defer func() { _ = devNull.Close() }()
-				} else {
-					cexec.Stdin = os.Stdin
 				}
-			} else {
-				cexec.Stdin = os.Stdin
 			}
+			stdout, stderr := io.Writer(os.Stdout), io.Writer(os.Stderr)
 
-			env := os.Environ()
-			for k, v := range envAdditions {
-				env = append(env, fmt.Sprintf("%s=%s", k, v))
+			var outputs []*redactedOutput
+			if redactOutput {
+				r := newRedactor(inj.values(plan), redactStyle == "alias")
+				for _, dst := range []io.Writer{os.Stdout, os.Stderr} {
+					o, err := newRedactedOutput(r, dst)
+					if err != nil {
+						return exitCodeError{code: 5, err: err}
+					}
+					outputs = append(outputs, o)
+				}
+				stdout, stderr = outputs[0].file(), outputs[1].file()
 			}
-			cexec.Env = env
-
-			if err := cexec.Run(); err != nil {
-				var ee *exec.ExitError
-				if errors.As(err, &ee) {
-					if status, ok := exitStatusOf(ee); ok {
-						return exitCodeError{code: status, err: fmt.Errorf("command failed: %w", err)}
+			defer func() {
+				for _, o := range outputs {
+					if werr := o.wait(); werr != nil {
+						slog.Warn("failed to copy command output", "error", werr)
 					}
 				}
+			}()
+
+			newCommand := func() *exec.Cmd {
+				// #nosec G204 - the command is intentionally user-provided
+				cexec := exec.Command(command, commandArgs...)
+				cexec.Stdin, cexec.Stdout, cexec.Stderr = stdin, stdout, stderr
+				return cexec
+			}
+			// Secret files live only as long as the child; cleanup also
+			// runs after a forwarded signal because the child is waited for.
+			environ := func(inj *injection) ([]string, *secretFiles, error) {
+				plan, err := newPlan(inj)
+				if err != nil {
+					return nil, nil, err
+				}
+				files, err := newSecretFiles(fileStore)
+				if err != nil {
+					return nil, nil, err
+				}
+				env, err := inj.environ(plan, files)
+				if err != nil {
+					_ = files.cleanup()
+					return nil, nil, err
+				}
+				return env, files, nil
+			}
+
+			childOpts := childOptions{processGroup: processGroup, gracePeriod: grace, interactive: interactive}
+			var status int
+			if watchMode {
+				watch.child = childOpts
+				redacted := []map[string]string{}
+				sup := &supervisor{
+					opts:    watch,
+					fetch:   fetch,
+					environ: environ,
+					command: newCommand,
+					applied: func(inj *injection) {
+						if len(outputs) == 0 {
+							return
+						}
+						// Keep redacting earlier values: a reloaded child
+						// may still hold them, and output may be in flight.
+						plan, err := newPlan(inj)
+						if err != nil {
+							return
+						}
+						redacted = append(redacted, inj.values(plan))
+						r := newRedactor(nil, redactStyle == "alias")
+						for _, v := range redacted {
+							r.add(v, redactStyle == "alias")
+						}
+						for _, o := range outputs {
+							o.update(r)
+						}
+					},
+				}
+				status, err = sup.run(inj)
+			} else {
+				env, files, eerr := environ(inj)
+				if eerr != nil {
+					return exitCodeError{code: 5, err: eerr}
+				}
+				defer func() {
+					if err := files.cleanup(); err != nil {
+						slog.Warn("failed to clean up secret files", "error", err)
+					}
+				}()
+				cexec := newCommand()
+				cexec.Env = env
+				cexec.ExtraFiles = files.extraFiles()
+				status, err = runChild(cexec, childOpts)
+			}
+			if err != nil {
 				return exitCodeError{code: 5, err: err}
 			}
+			if status != 0 {
+				return exitCodeError{code: status, err: fmt.Errorf("command failed: exit status %d", status)}
+			}
 			return nil
 		},
 	}
 
-	c.Flags().StringVar(&secretsCSV, "secrets", "", "Comma-separated list of aliases")
-	c.Flags().StringSliceVarP(&secretsList, "secret", "s", nil, "Secret alias (repeatable)")
-	c.Flags().BoolVar(&all, "all", false, "Inject all configured secrets")
-	c.Flags().StringVar(&allExceptCSV, "all-except", "", "Comma-separated aliases to exclude when using --all")
+	sel.addFlags(c.Flags(), "Inject")
+	fail.addFlags(c.Flags(), "Run the command with")
 	c.Flags().BoolVar(&dryRun, "dry-run", false, "Print what would be executed and exit")
 	c.Flags().BoolVar(&strict, "strict", true, "Fail if any requested secret cannot be fetched")
 	c.Flags().BoolVar(&mask, "mask", true, "Mask secret values in logs and dry-run output")
@@ -295,19 +368,41 @@ func newRunCmd() *cobra.Command {
 	c.Flags().StringVar(&retryDelay, "retry-delay", "500ms", "Delay between retries (e.g., 200ms, 1s)")
 	c.Flags().StringSliceVar(&requireEnv, "require-env", nil, "Environment variable names that must be present after fetch")
 	c.Flags().StringSliceVar(&requireAlias, "require-alias", nil, "Aliases that must be selected")
+	c.Flags().StringSliceVar(&asFile, "as-file", nil, "Aliases or glob patterns delivered as files; the env var holds the file path")
+	c.Flags().StringVar(&fileStore, "file-store", fileStoreAuto, "Where secret files live: auto, memfd or tmpfs")
+	c.Flags().BoolVar(&processGroup, "process-group", false, "Run the command in its own process group and signal the whole group")
+	c.Flags().StringVar(&graceStr, "grace-period", "10s", "Time the command gets to exit after SIGTERM/SIGINT before SIGKILL (0 waits forever)")
+	c.Flags().BoolVar(&redactOutput, "redact-output", false, "Replace secret values (and their base64/URL-encoded forms) in the command's stdout and stderr")
+	c.Flags().StringVar(&redactStyle, "redact-style", "mask", "Replacement for redacted values: mask (****) or alias ([alias])")
+	c.Flags().BoolVar(&cleanEnv, "clean-env", false, "Start the command with an empty environment plus --pass-env variables and the secrets")
+	c.Flags().StringSliceVar(&passEnvs, "pass-env", nil, "Parent variables (names or glob patterns) kept with --clean-env")
+	c.Flags().StringVar(&onConflict, "on-conflict", conflictOverride, "When a secret's env var is already set: override, keep or error")
+	c.Flags().BoolVar(&watchMode, "watch", false, "Keep the command running and restart or reload it when its secrets change")
+	c.Flags().StringVar(&supervise.interval, "watch-interval", "30s", "How often --watch fetches the secrets again")
+	c.Flags().StringVar(&supervise.debounce, "debounce", "5s", "How long a change must be stable before --watch applies it")
+	c.Flags().StringVar(&supervise.minRestart, "min-restart-interval", "1m", "Minimum time between two restarts or reloads")
+	c.Flags().StringVar(&supervise.onChange, "on-change", onChangeRestart, "What --watch does when secrets change: restart or signal")
+	c.Flags().StringVar(&supervise.reloadSignal, "reload-signal", "HUP", "Signal sent with --on-change signal after secret files are rewritten")
+	c.Flags().StringVar(&supervise.healthCmd, "health-cmd", "", "Shell command that must succeed with the new secrets before they are applied")
+	c.Flags().BoolVar(&execMode, "exec", false, "Replace skv with the command (execve) once secrets are fetched")
+	c.Flags().BoolVar(&execMode, "replace", false, "Alias for --exec")
 	return c
 }
 
-// Utility types and functions
+// execIncompatibleFlags need skv to keep running next to the command.
+var execIncompatibleFlags = []string{"as-file", "file-store", "process-group", "grace-period", "redact-output", "redact-style", "watch"}
 
-type exitCodeError struct {
-	code int
-	err  error
+// checkExecFlags rejects flags that cannot work once skv has been replaced.
+func checkExecFlags(cmd *cobra.Command) error {
+	for _, name := range execIncompatibleFlags {
+		if cmd.Flags().Changed(name) {
+			return exitCodeError{code: 2, err: fmt.Errorf("--exec cannot be combined with --%s", name)}
+		}
+	}
+	return nil
 }
 
-func (e exitCodeError) Error() string { return e.err.Error() }
-
-func (e exitCodeError) Unwrap() error { return e.err }
+// Utility functions
 
 func indexOf(slice []string, val string) int {
 	for i, s := range slice {
@@ -325,14 +420,3 @@ func maskValue(s string) string {
 	return s[:2] + strings.Repeat("*", len(s)-4) + s[len(s)-2:]
 }
 
-// exitStatusOf tries to map an ExitError to a code; returns (code, true) if mapped.
-func exitStatusOf(ee *exec.ExitError) (int, bool) {
-	// Try to extract platform-specific exit status
-	type interfaceWithExitStatus interface{ ExitStatus() int }
-	if x, ok := any(ee.Sys()).(interfaceWithExitStatus); ok {
-		return x.ExitStatus(), true
-	}
-	// Fallback: return generic exit code
-	return 5, true
-}
-
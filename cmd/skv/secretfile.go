@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// Storage backends for secrets delivered as files.
+const (
+	fileStoreAuto  = "auto"
+	fileStoreMemfd = "memfd"
+	fileStoreTmpfs = "tmpfs"
+)
+
+// errMemfdUnsupported is returned by createMemfd on platforms without memfd.
+var errMemfdUnsupported = errors.New("memfd is not supported on this platform")
+
+// secretFiles holds the files created for a child process. With memfd the
+// values never touch a filesystem; the child inherits the descriptors and
+// reads them through /dev/fd. Otherwise they are written to a private 0700
+// directory, preferably on tmpfs, which is removed by cleanup.
+type secretFiles struct {
+	store string
+	dir   string
+	fds   []*os.File // inherited by the child as fd 3, 4, ...
+}
+
+func newSecretFiles(store string) (*secretFiles, error) {
+	switch store {
+	case "", fileStoreAuto:
+		store = fileStoreAuto
+	case fileStoreMemfd, fileStoreTmpfs:
+	default:
+		return nil, fmt.Errorf("invalid file store %q (use auto, memfd or tmpfs)", store)
+	}
+	return &secretFiles{store: store}, nil
+}
+
+// add stores value under name and returns the path the child should read.
+func (f *secretFiles) add(name, value string) (string, error) {
+	name = filepath.Base(name)
+	if f.store != fileStoreTmpfs {
+		fd, err := createMemfd(name, []byte(value))
+		switch {
+		case err == nil:
+			f.fds = append(f.fds, fd)
+			return fmt.Sprintf("/dev/fd/%d", 2+len(f.fds)), nil
+		case f.store == fileStoreMemfd || !errors.Is(err, errMemfdUnsupported):
+			return "", fmt.Errorf("create memfd for %s: %w", name, err)
+		}
+	}
+	if f.dir == "" {
+		dir, err := makePrivateDir()
+		if err != nil {
+			return "", err
+		}
+		f.dir = dir
+	}
+	path := filepath.Join(f.dir, name)
+	// O_EXCL guards against two secrets sharing a file name.
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", fmt.Errorf("create secret file: %w", err)
+	}
+	if _, err := file.WriteString(value); err != nil {
+		_ = file.Close()
+		return "", fmt.Errorf("write secret file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("write secret file: %w", err)
+	}
+	return path, nil
+}
+
+// update atomically replaces the content of a file created by add, so that
+// a child which re-reads the path sees the new value. Memfds are sealed and
+// cannot be updated.
+func (f *secretFiles) update(name, value string) error {
+	if f.dir == "" {
+		return errors.New("update secret file: only tmpfs files can be updated")
+	}
+	path := filepath.Join(f.dir, filepath.Base(name))
+	if _, err := os.Lstat(path); err != nil {
+		return fmt.Errorf("update secret file: %w", err)
+	}
+	tmp, err := os.CreateTemp(f.dir, ".update-")
+	if err != nil {
+		return fmt.Errorf("update secret file: %w", err)
+	}
+	if _, err := tmp.WriteString(value); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("update secret file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("update secret file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("update secret file: %w", err)
+	}
+	return nil
+}
+
+// extraFiles returns the descriptors the child must inherit.
+func (f *secretFiles) extraFiles() []*os.File {
+	return f.fds
+}
+
+// cleanup closes memfds and removes the private directory. It is safe to
+// call more than once.
+func (f *secretFiles) cleanup() error {
+	var errs []error
+	for _, fd := range f.fds {
+		if err := fd.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+			errs = append(errs, err)
+		}
+	}
+	f.fds = nil
+	if f.dir != "" {
+		if err := os.RemoveAll(f.dir); err != nil {
+			errs = append(errs, fmt.Errorf("remove secret directory: %w", err))
+		}
+		f.dir = ""
+	}
+	return errors.Join(errs...)
+}
+
+// makePrivateDir creates the 0700 directory holding secret files in the
+// first memory-backed location available, else in the system temp directory.
+func makePrivateDir() (string, error) {
+	for _, base := range tmpfsDirs() {
+		if base == "" {
+			continue
+		}
+		if dir, err := os.MkdirTemp(base, "skv-"); err == nil {
+			return dir, nil
+		}
+	}
+	slog.Warn("no tmpfs directory available; secret files are written to the temp directory", "dir", os.TempDir())
+	dir, err := os.MkdirTemp("", "skv-")
+	if err != nil {
+		return "", fmt.Errorf("create secret directory: %w", err)
+	}
+	return dir, nil
+}
+
@@ -0,0 +1,40 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// tmpfsDirs lists memory-backed directories, most private first.
+func tmpfsDirs() []string {
+	return []string{os.Getenv("XDG_RUNTIME_DIR"), "/dev/shm"}
+}
+
+// createMemfd returns an anonymous in-memory file holding data. The file is
+// sealed against further writes and is not close-on-exec in the child,
+// because exec.Cmd.ExtraFiles duplicates it.
+func createMemfd(name string, data []byte) (*os.File, error) {
+	fd, err := unix.MemfdCreate("skv-"+name, unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return nil, fmt.Errorf("memfd_create: %w", err)
+	}
+	f := os.NewFile(uintptr(fd), "memfd:skv-"+name)
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("write memfd: %w", err)
+	}
+	if _, err := unix.FcntlInt(f.Fd(), unix.F_ADD_SEALS, unix.F_SEAL_SHRINK|unix.F_SEAL_GROW|unix.F_SEAL_WRITE|unix.F_SEAL_SEAL); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("seal memfd: %w", err)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("rewind memfd: %w", err)
+	}
+	return f, nil
+}
+
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+// tmpfsDirs lists memory-backed directories, most private first.
+func tmpfsDirs() []string {
+	return []string{os.Getenv("XDG_RUNTIME_DIR")}
+}
+
+func createMemfd(_ string, _ []byte) (*os.File, error) {
+	return nil, errMemfdUnsupported
+}
+
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSecretFiles(t *testing.T) {
+	stores := []string{fileStoreTmpfs, fileStoreAuto}
+	if runtime.GOOS == "linux" {
+		stores = append(stores, fileStoreMemfd)
+	}
+	for _, store := range stores {
+		t.Run(store, func(t *testing.T) {
+			files, err := newSecretFiles(store)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path, err := files.add("tls.crt", "cert-data")
+			if err != nil {
+				t.Fatalf("add: %v", err)
+			}
+			if store == fileStoreMemfd && !strings.HasPrefix(path, "/dev/fd/") {
+				t.Errorf("memfd path = %q", path)
+			}
+			if store == fileStoreTmpfs {
+				fi, err := os.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if fi.Mode().Perm() != 0o600 {
+					t.Errorf("file mode = %v, want 0600", fi.Mode().Perm())
+				}
+				di, err := os.Stat(filepath.Dir(path))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if di.Mode().Perm() != 0o700 {
+					t.Errorf("dir mode = %v, want 0700", di.Mode().Perm())
+				}
+				if got, _ := os.ReadFile(path); string(got) != "cert-data" {
+					t.Errorf("content = %q", got)
+				}
+				if _, err := files.add("tls.crt", "other"); err == nil {
+					t.Errorf("duplicate file name should fail")
+				}
+			}
+			if err := files.cleanup(); err != nil {
+				t.Fatalf("cleanup: %v", err)
+			}
+			if store == fileStoreTmpfs {
+				if _, err := os.Stat(filepath.Dir(path)); !os.IsNotExist(err) {
+					t.Errorf("secret directory not removed: %v", err)
+				}
+			}
+		})
+	}
+
+	if _, err := newSecretFiles("disk"); err == nil {
+		t.Errorf("invalid store should fail")
+	}
+}
+
+func TestRunAsFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	_ = newRootCmd()
+	registerMock("mock")
+
+	cfgPath = writeTestConfig(t, `secrets:
+  - alias: tls
+    provider: mock
+    name: tls
+    env: TLS_CERT
+    file: tls.crt
+    extras:
+      value: cert-data
+  - alias: token
+    provider: mock
+    name: token
+    env: TOKEN
+    extras:
+      value: token-data
+`)
+	out := filepath.Join(t.TempDir(), "out")
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"per-secret file mode", nil, "cert-data|token-data"},
+		{"as-file flag", []string{"--as-file", "tok*"}, "cert-data|token-data"},
+		{"tmpfs store", []string{"--file-store", "tmpfs"}, "cert-data|token-data"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := `cat "$TLS_CERT" > "$OUT"; printf '|' >> "$OUT"; ` +
+				`if [ -e "$TOKEN" ]; then cat "$TOKEN" >> "$OUT"; else printf '%s' "$TOKEN" >> "$OUT"; fi; ` +
+				`printf '\n%s' "$TLS_CERT" >> "$OUT"`
+			t.Setenv("OUT", out)
+			c := newRunCmd()
+			c.SetArgs(append(append([]string{"--all"}, tt.args...), "--", "sh", "-c", script))
+			if err := c.Execute(); err != nil {
+				t.Fatalf("run: %v", err)
+			}
+			data, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, path, _ := strings.Cut(string(data), "\n")
+			if got != tt.want {
+				t.Errorf("child saw %q, want %q", got, tt.want)
+			}
+			if strings.HasPrefix(path, "/dev/fd/") {
+				return
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("secret file %s not removed after the child exited", path)
+			}
+		})
+	}
+}
+
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/spf13/pflag"
+
+	"skv/internal/config"
+)
+
+// secretSelection holds the flags shared by commands that operate on a set
+// of aliases (run, export, watch).
+type secretSelection struct {
+	secretsCSV string
+	secrets    []string
+	all        bool
+	allExcept  string
+	tags       []string
+	groups     []string
+	selectors  []string
+}
+
+// addFlags registers the selection flags. verb is used in help text, e.g. "Inject".
+func (sel *secretSelection) addFlags(fs *pflag.FlagSet, verb string) {
+	fs.StringVar(&sel.secretsCSV, "secrets", "", "Comma-separated list of aliases or glob patterns")
+	fs.StringSliceVarP(&sel.secrets, "secret", "s", nil, "Secret alias or glob pattern, e.g. 'db-*' (repeatable)")
+	fs.BoolVar(&sel.all, "all", false, fmt.Sprintf("%s all configured secrets", verb))
+	fs.StringVar(&sel.allExcept, "all-except", "", "Comma-separated aliases or glob patterns to exclude")
+	fs.StringSliceVar(&sel.tags, "tag", nil, "Select secrets with this tag (repeatable)")
+	fs.StringSliceVar(&sel.groups, "group", nil, "Select secrets in this group (repeatable)")
+	fs.StringArrayVar(&sel.selectors, "select", nil, "Selector expression, e.g. 'tag=db,!tag=legacy' (repeatable)")
+}
+
+// empty reports whether no selection flag was given.
+func (sel *secretSelection) empty() bool {
+	return !sel.all && sel.secretsCSV == "" && len(sel.secrets) == 0 &&
+		len(sel.tags) == 0 && len(sel.groups) == 0 && len(sel.selectors) == 0
+}
+
+// resolve returns the sorted aliases selected by the flags. Literal aliases
+// are kept even when they are not configured so that callers can report
+// them as missing; glob patterns only expand to configured aliases.
+func (sel *secretSelection) resolve(cfg *config.Config) ([]string, error) {
+	if sel.empty() {
+		return nil, exitCodeError{code: 2, err: errors.New("no secrets selected; use --all, --secrets/-s, --tag, --group or --select")}
+	}
+
+	requested := map[string]struct{}{}
+	if sel.all {
+		for _, s := range cfg.Secrets {
+			requested[s.Alias] = struct{}{}
+		}
+	}
+	var exprs []string
+	names := append(splitCSV(sel.secretsCSV), sel.secrets...)
+	for _, a := range names {
+		if config.IsPattern(a) {
+			exprs = append(exprs, "alias="+a)
+			continue
+		}
+		requested[a] = struct{}{}
+	}
+	for _, t := range sel.tags {
+		exprs = append(exprs, "tag="+t)
+	}
+	for _, g := range sel.groups {
+		exprs = append(exprs, "group="+g)
+	}
+	exprs = append(exprs, sel.selectors...)
+	if len(exprs) > 0 {
+		matched, err := cfg.Select(exprs...)
+		if err != nil {
+			return nil, exitCodeError{code: 2, err: err}
+		}
+		for _, a := range matched {
+			requested[a] = struct{}{}
+		}
+	}
+
+	excluded := splitCSV(sel.allExcept)
+	aliases := make([]string, 0, len(requested))
+	for a := range requested {
+		if matchesAny(excluded, a) {
+			continue
+		}
+		aliases = append(aliases, a)
+	}
+	if len(aliases) == 0 {
+		return nil, exitCodeError{code: 2, err: errors.New("no secrets matched the selection")}
+	}
+	sort.Strings(aliases)
+	return aliases, nil
+}
+
+// matchesAny reports whether alias equals or glob-matches any of the patterns.
+func matchesAny(patterns []string, alias string) bool {
+	for _, p := range patterns {
+		if p == alias {
+			return true
+		}
+		if ok, _ := path.Match(p, alias); ok {
+			return true
+		}
+	}
+	return false
+}
+
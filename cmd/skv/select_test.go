@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"skv/internal/config"
+)
+
+func TestSecretSelectionResolve(t *testing.T) {
+	cfg := &config.Config{
+		Secrets: []config.Secret{
+			{Alias: "db-main", Tags: []string{"db"}},
+			{Alias: "db-legacy", Tags: []string{"db", "legacy"}},
+			{Alias: "api-key", Tags: []string{"backend"}},
+		},
+		Groups: map[string][]string{"api": {"api-*"}},
+	}
+
+	tests := []struct {
+		name    string
+		sel     secretSelection
+		want    []string
+		wantErr bool
+	}{
+		{name: "nothing selected", sel: secretSelection{}, wantErr: true},
+		{name: "all except glob", sel: secretSelection{all: true, allExcept: "db-*"}, want: []string{"api-key"}},
+		{name: "glob via -s", sel: secretSelection{secrets: []string{"db-*"}}, want: []string{"db-legacy", "db-main"}},
+		{name: "literal unknown alias kept", sel: secretSelection{secretsCSV: "nope"}, want: []string{"nope"}},
+		{name: "tag", sel: secretSelection{tags: []string{"backend"}}, want: []string{"api-key"}},
+		{name: "group", sel: secretSelection{groups: []string{"api"}}, want: []string{"api-key"}},
+		{name: "selector", sel: secretSelection{selectors: []string{"tag=db,!tag=legacy"}}, want: []string{"db-main"}},
+		{name: "unknown group", sel: secretSelection{groups: []string{"nope"}}, wantErr: true},
+		{name: "empty match", sel: secretSelection{tags: []string{"missing"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.sel.resolve(cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
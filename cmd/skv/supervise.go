@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// What run --watch does when the secrets change.
+const (
+	onChangeRestart = "restart"
+	onChangeSignal  = "signal"
+)
+
+// healthTimeout bounds --health-cmd.
+const healthTimeout = 30 * time.Second
+
+// superviseOptions controls run --watch.
+type superviseOptions struct {
+	interval           time.Duration // how often secrets are fetched again
+	debounce           time.Duration // a change must be stable this long before it is applied
+	minRestartInterval time.Duration // minimum time between two applied changes
+	onChange           string        // onChangeRestart or onChangeSignal
+	reloadSignal       os.Signal     // sent with onChangeSignal
+	healthCmd          string        // must succeed with the new secrets before they are applied
+	child              childOptions
+}
+
+// supervisor keeps a child running with the current secrets and restarts
+// or signals it when they change. Secrets that cannot be fetched, or that
+// fail --health-cmd, leave the running child untouched.
+type supervisor struct {
+	opts superviseOptions
+
+	fetch   func() (*injection, error)                       // fetches the secrets again
+	environ func(*injection) ([]string, *secretFiles, error) // builds the child environment
+	command func() *exec.Cmd                                 // a new child command with stdio set
+	applied func(*injection)                                 // called before new secrets are used, even by --health-cmd
+}
+
+// supervisedChild is one running instance of the command.
+type supervisedChild struct {
+	cmd    *exec.Cmd
+	files  *secretFiles
+	exited chan childExit
+}
+
+type childExit struct {
+	code int
+	err  error
+}
+
+func (c *supervisedChild) cleanup() {
+	if err := c.files.cleanup(); err != nil {
+		slog.Warn("failed to clean up secret files", "error", err)
+	}
+}
+
+// start launches the command with the secrets in inj.
+func (s *supervisor) start(inj *injection) (*supervisedChild, error) {
+	env, files, err := s.environ(inj)
+	if err != nil {
+		return nil, err
+	}
+	cmd := s.command()
+	cmd.Env = env
+	cmd.ExtraFiles = files.extraFiles()
+	configureChild(cmd, s.opts.child.processGroup)
+	if err := startChild(cmd); err != nil {
+		_ = files.cleanup()
+		return nil, err
+	}
+	c := &supervisedChild{cmd: cmd, files: files, exited: make(chan childExit, 1)}
+	go func() {
+		code, err := waitChild(cmd)
+		c.exited <- childExit{code, err}
+	}()
+	return c, nil
+}
+
+// healthy runs --health-cmd with the environment the child would get.
+func (s *supervisor) healthy(inj *injection) error {
+	if s.opts.healthCmd == "" {
+		return nil
+	}
+	env, files, err := s.environ(inj)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = files.cleanup() }()
+	tmpl := s.command()
+	hc := shellCommand(s.opts.healthCmd)
+	hc.Env = env
+	hc.ExtraFiles = files.extraFiles()
+	hc.Stdout, hc.Stderr = tmpl.Stderr, tmpl.Stderr
+	// Started like the child so that, as PID 1, its exit status is not
+	// taken by the reaper.
+	if err := startChild(hc); err != nil {
+		return fmt.Errorf("health command: %w", err)
+	}
+	done := make(chan childExit, 1)
+	go func() {
+		code, err := waitChild(hc)
+		done <- childExit{code, err}
+	}()
+	select {
+	case res := <-done:
+		if res.err != nil {
+			return fmt.Errorf("health command: %w", res.err)
+		}
+		if res.code != 0 {
+			return fmt.Errorf("health command: exit status %d", res.code)
+		}
+		return nil
+	case <-time.After(healthTimeout):
+		_ = hc.Process.Kill()
+		<-done
+		return fmt.Errorf("health command: %w", context.DeadlineExceeded)
+	}
+}
+
+// reload rewrites the secret files of c and sends the reload signal.
+// Environment variables of a running process cannot be changed.
+func (s *supervisor) reload(c *supervisedChild, old, fresh *injection) error {
+	var envOnly []string
+	for _, k := range old.changed(fresh) {
+		name, ok := fresh.fileNames[k]
+		if !ok || old.fileNames[k] != name {
+			envOnly = append(envOnly, k)
+			continue
+		}
+		if err := c.files.update(name, fresh.additions[k]); err != nil {
+			return err
+		}
+	}
+	if len(envOnly) > 0 {
+		slog.Warn("changed environment variables take effect only when the command restarts", "env", envOnly)
+	}
+	return signalChild(c.cmd.Process, s.opts.reloadSignal, s.opts.child.processGroup)
+}
+
+// run supervises the command until it exits on its own or after a
+// terminating signal, and returns its exit code like runChild. Secrets are
+// fetched and checked in the background, so a slow provider or
+// --health-cmd never delays forwarding signals or noticing the child exit.
+func (s *supervisor) run(inj *injection) (int, error) {
+	sigs := make(chan os.Signal, 8)
+	signal.Notify(sigs, forwardedSignals...)
+	defer signal.Stop(sigs)
+
+	s.applied(inj)
+	cur, err := s.start(inj)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { cur.cleanup() }()
+
+	ticker := time.NewTicker(s.opts.interval)
+	defer ticker.Stop()
+
+	// Secrets fetched or checked in the background. Buffered, so a result
+	// that arrives after run returned is dropped.
+	type result struct {
+		inj *injection
+		err error
+	}
+	fetched := make(chan result, 1)
+	checked := make(chan result, 1)
+
+	var (
+		pending   *injection // changed secrets waiting for the debounce
+		restartTo *injection // secrets for the next child, set while the current one stops
+		due       <-chan time.Time
+		kill      <-chan time.Time
+		stopping  bool
+		fetching  bool // a refresh is in flight
+		checking  bool // --health-cmd is running for the pending secrets
+		lastApply = time.Now()
+	)
+	for {
+		select {
+		case res := <-cur.exited:
+			if restartTo == nil || stopping {
+				return res.code, res.err
+			}
+			cur.cleanup()
+			kill = nil
+			slog.Info("restarting command with updated secrets")
+			next, err := s.start(restartTo)
+			if err != nil {
+				return 0, err
+			}
+			cur, inj, restartTo = next, restartTo, nil
+		case sig := <-sigs:
+			if sig == os.Interrupt && s.opts.child.interactive && !s.opts.child.processGroup {
+				slog.Debug("child received interrupt from the terminal")
+			} else if err := signalChild(cur.cmd.Process, sig, s.opts.child.processGroup); err != nil && !errors.Is(err, os.ErrProcessDone) {
+				slog.Warn("failed to forward signal", "signal", sig.String(), "error", err)
+			}
+			if terminating(sig) {
+				stopping, pending, due = true, nil, nil
+				if kill == nil && s.opts.child.gracePeriod > 0 {
+					kill = time.After(s.opts.child.gracePeriod)
+				}
+			}
+		case <-kill:
+			slog.Warn("child did not exit within the grace period; killing it", "grace_period", s.opts.child.gracePeriod.String())
+			if err := killChild(cur.cmd.Process, s.opts.child.processGroup); err != nil && !errors.Is(err, os.ErrProcessDone) {
+				slog.Warn("failed to kill child", "error", err)
+			}
+			kill = nil
+		case <-ticker.C:
+			if stopping || restartTo != nil || fetching || checking {
+				continue
+			}
+			fetching = true
+			go func() {
+				fresh, err := s.fetch()
+				fetched <- result{fresh, err}
+			}()
+		case res := <-fetched:
+			fetching = false
+			if stopping || restartTo != nil {
+				continue
+			}
+			if res.err != nil {
+				slog.Warn("failed to refresh secrets; keeping the current ones", "error", res.err)
+				continue
+			}
+			fresh := res.inj
+			changed := inj.changed(fresh)
+			if len(changed) == 0 {
+				pending, due = nil, nil
+				continue
+			}
+			if pending != nil && len(pending.changed(fresh)) == 0 {
+				continue
+			}
+			wait := s.opts.debounce
+			if d := time.Until(lastApply.Add(s.opts.minRestartInterval)); d > wait {
+				wait = d
+			}
+			slog.Info("secrets changed", "env", changed, "apply_in", wait.Round(time.Second).String())
+			pending, due = fresh, time.After(wait)
+		case <-due:
+			fresh := pending
+			pending, due = nil, nil
+			lastApply = time.Now()
+			s.applied(fresh)
+			checking = true
+			go func() {
+				checked <- result{fresh, s.healthy(fresh)}
+			}()
+		case res := <-checked:
+			checking = false
+			if stopping {
+				continue
+			}
+			if res.err != nil {
+				slog.Warn("updated secrets failed the health check; keeping the current ones", "error", res.err)
+				continue
+			}
+			fresh := res.inj
+			if s.opts.onChange == onChangeSignal {
+				if err := s.reload(cur, inj, fresh); err != nil {
+					slog.Warn("failed to reload command", "error", err)
+					continue
+				}
+				slog.Info("sent reload signal to command", "signal", s.opts.reloadSignal.String())
+				inj = fresh
+				continue
+			}
+			restartTo = fresh
+			if err := signalChild(cur.cmd.Process, stopSignal, s.opts.child.processGroup); err != nil && !errors.Is(err, os.ErrProcessDone) {
+				slog.Warn("failed to stop command for restart", "error", err)
+			}
+			if s.opts.child.gracePeriod > 0 {
+				kill = time.After(s.opts.child.gracePeriod)
+			}
+		}
+	}
+}
+
+// superviseFlags are the raw values of the run --watch flags.
+type superviseFlags struct {
+	interval     string
+	debounce     string
+	minRestart   string
+	onChange     string
+	reloadSignal string
+	healthCmd    string
+}
+
+// superviseFlagNames are only valid together with --watch.
+var superviseFlagNames = []string{"watch-interval", "debounce", "min-restart-interval", "on-change", "reload-signal", "health-cmd"}
+
+func parseSuperviseOptions(cmd *cobra.Command, watch bool, f superviseFlags) (superviseOptions, error) {
+	var opts superviseOptions
+	if !watch {
+		for _, name := range superviseFlagNames {
+			if cmd.Flags().Changed(name) {
+				return opts, fmt.Errorf("--%s requires --watch", name)
+			}
+		}
+		return opts, nil
+	}
+	durations := []struct {
+		flag string
+		val  string
+		dst  *time.Duration
+	}{
+		{"watch-interval", f.interval, &opts.interval},
+		{"debounce", f.debounce, &opts.debounce},
+		{"min-restart-interval", f.minRestart, &opts.minRestartInterval},
+	}
+	for _, d := range durations {
+		v, err := time.ParseDuration(d.val)
+		if err != nil || v < 0 {
+			return opts, fmt.Errorf("invalid --%s: %q", d.flag, d.val)
+		}
+		*d.dst = v
+	}
+	if opts.interval <= 0 {
+		return opts, errors.New("--watch-interval must be positive")
+	}
+	switch f.onChange {
+	case onChangeRestart:
+	case onChangeSignal:
+		sig, err := parseSignal(f.reloadSignal)
+		if err != nil {
+			return opts, fmt.Errorf("invalid --reload-signal: %w", err)
+		}
+		opts.reloadSignal = sig
+	default:
+		return opts, fmt.Errorf("invalid --on-change %q (use restart or signal)", f.onChange)
+	}
+	opts.onChange = f.onChange
+	opts.healthCmd = f.healthCmd
+	return opts, nil
+}
+
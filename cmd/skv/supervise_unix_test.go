@@ -0,0 +1,177 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunWatch(t *testing.T) {
+	skipIfShort(t)
+	tests := []struct {
+		name    string
+		flags   []string
+		script  string
+		updates []string // values written to the secret after the child reported the previous one
+		want    string   // final content of the output file
+		code    int
+	}{
+		{
+			name:    "restart with the new environment",
+			script:  `echo "$TOKEN" >> "$0"; [ "$TOKEN" = v2 ] && exit 7; exec sleep 30`,
+			updates: []string{"v2"},
+			want:    "v1\nv2\n",
+			code:    7,
+		},
+		{
+			name:    "health check gates the restart",
+			flags:   []string{"--health-cmd", `test "$TOKEN" != bad`},
+			script:  `echo "$TOKEN" >> "$0"; [ "$TOKEN" = v3 ] && exit 7; exec sleep 30`,
+			updates: []string{"bad", "v3"},
+			want:    "v1\nv3\n",
+			code:    7,
+		},
+		{
+			name:    "signal after rewriting the file",
+			flags:   []string{"--on-change", "signal", "--reload-signal", "SIGUSR1", "--as-file", "token"},
+			script:  `trap 'cat "$TOKEN" >> "$0"; exit 0' USR1; cat "$TOKEN" >> "$0"; while :; do sleep 0.05; done`,
+			updates: []string{"v2"},
+			want:    "v1v2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			secret := filepath.Join(dir, "secret")
+			out := filepath.Join(dir, "out")
+			if err := os.WriteFile(secret, []byte("v1"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_ = newRootCmd()
+			cfgPath = writeTestConfig(t, "secrets:\n  - alias: token\n    provider: exec\n    name: "+secret+"\n    env: TOKEN\n    extras:\n      cmd: cat\n")
+
+			c := newRunCmd()
+			args := []string{"--all", "--watch", "--watch-interval", "50ms", "--debounce", "0s", "--min-restart-interval", "0s", "--grace-period", "2s"}
+			args = append(append(args, tt.flags...), "--", "sh", "-c", tt.script, out)
+			c.SetArgs(args)
+			done := make(chan error, 1)
+			go func() { done <- c.Execute() }()
+
+			seen := "v1"
+			for _, v := range tt.updates {
+				waitForFile(t, out, seen)
+				if err := os.WriteFile(secret, []byte(v), 0o600); err != nil {
+					t.Fatal(err)
+				}
+				if v != "bad" {
+					seen = v
+				} else {
+					time.Sleep(300 * time.Millisecond)
+				}
+			}
+
+			var err error
+			select {
+			case err = <-done:
+			case <-time.After(15 * time.Second):
+				t.Fatal("run --watch did not exit")
+			}
+			var ee exitCodeError
+			switch {
+			case tt.code == 0 && err != nil:
+				t.Fatalf("run: %v", err)
+			case tt.code != 0 && (!errors.As(err, &ee) || ee.code != tt.code):
+				t.Fatalf("run = %v, want exit code %d", err, tt.code)
+			}
+			if data, _ := os.ReadFile(out); string(data) != tt.want {
+				t.Fatalf("output = %q, want %q", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunWatchFlagsRequireWatch(t *testing.T) {
+	_ = newRootCmd()
+	registerMock("mock")
+	cfgPath = writeTestConfig(t, "secrets:\n  - alias: token\n    provider: mock\n    name: t\n    env: TOKEN\n    extras:\n      value: v\n")
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--debounce", "1s"}, "--debounce requires --watch"},
+		{[]string{"--watch", "--on-change", "reload"}, `invalid --on-change "reload"`},
+		{[]string{"--watch", "--on-change", "signal", "--reload-signal", "KILL"}, "invalid --reload-signal"},
+		{[]string{"--watch", "--on-change", "signal", "--file-store", "memfd"}, "--file-store tmpfs"},
+		{[]string{"--watch", "--watch-interval", "0s"}, "--watch-interval must be positive"},
+		{[]string{"--watch", "--exec"}, "--exec cannot be combined with --watch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			c := newRunCmd()
+			c.SetArgs(append(append([]string{"--all"}, tt.args...), "--", "true"))
+			err := c.Execute()
+			var ee exitCodeError
+			if !errors.As(err, &ee) || ee.code != 2 || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("run = %v, want code 2 with %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuperviseSignalDuringRefresh(t *testing.T) {
+	skipIfShort(t)
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	s := &supervisor{
+		opts: superviseOptions{interval: 20 * time.Millisecond, child: childOptions{gracePeriod: 5 * time.Second}},
+		// A provider that hangs must not hold up the signal.
+		fetch: func() (*injection, error) {
+			select {
+			case entered <- struct{}{}:
+			default:
+			}
+			<-release
+			return nil, errors.New("released")
+		},
+		environ: func(*injection) ([]string, *secretFiles, error) { return os.Environ(), &secretFiles{}, nil },
+		command: func() *exec.Cmd { return exec.Command("sh", "-c", `trap 'exit 3' TERM; while :; do sleep 0.05; done`) },
+		applied: func(*injection) {},
+	}
+
+	type exit struct {
+		code int
+		err  error
+	}
+	done := make(chan exit, 1)
+	go func() {
+		code, err := s.run(&injection{})
+		done <- exit{code, err}
+	}()
+	select {
+	case <-entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("refresh did not start")
+	}
+	// Give the child time to install its trap.
+	time.Sleep(200 * time.Millisecond)
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case res := <-done:
+		if res.err != nil || res.code != 3 {
+			t.Fatalf("run() = %d, %v, want 3", res.code, res.err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("SIGTERM was not forwarded while a refresh was in flight")
+	}
+}
+
@@ -4,47 +4,152 @@ import (
 	"context"
 	crand "crypto/rand"
 	"errors"
+	"fmt"
+	"log/slog"
 	"math/big"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"skv/internal/provider"
 )
 
+// Throttled requests are retried at least throttleRetries times, waiting at
+// least throttleBackoff or the Retry-After the backend asked for, capped at
+// maxRetryAfter.
+const (
+	throttleRetries = 3
+	throttleBackoff = time.Second
+	maxRetryAfter   = time.Minute
+)
+
 func fetchWithRetry(ctx context.Context, p provider.Provider, spec provider.SecretSpec, retries int, delay time.Duration) (string, error) {
-	val, err := p.FetchSecret(ctx, spec)
-	if err == nil || retries <= 0 {
-		return val, err
-	}
-	attempts := retries
 	backoff := delay
-	for attempts > 0 {
+	for attempt := 0; ; attempt++ {
+		val, err := p.FetchSecret(ctx, spec)
 		// Do not retry not found
-		if errors.Is(err, provider.ErrNotFound) {
-			return "", err
-		}
-		// jitter +/-20%
-		sleep := backoff
-		maxJitter := backoff / 5
-		if maxJitter > 0 {
-			if n, nErr := crand.Int(crand.Reader, big.NewInt(int64(maxJitter))); nErr == nil {
-				j := time.Duration(n.Int64())
-				sleep = backoff - j/2
-			}
+		if err == nil || errors.Is(err, provider.ErrNotFound) {
+			return val, err
+		}
+		limit, sleep := retries, retryJitter(backoff)
+		var te *provider.ThrottledError
+		if errors.As(err, &te) {
+			limit = max(retries, throttleRetries)
+			sleep = max(sleep, throttleBackoff, min(te.RetryAfter, maxRetryAfter))
+		}
+		if attempt >= limit {
+			return val, err
+		}
+		if te != nil {
+			slog.Debug("throttled, backing off", "alias", spec.Alias, "provider", spec.Provider, "wait", sleep)
 		}
 		select {
 		case <-ctx.Done():
 			return "", ctx.Err()
 		case <-time.After(sleep):
 		}
-		val, err = p.FetchSecret(ctx, spec)
-		if err == nil {
-			return val, nil
-		}
-		attempts--
 		if backoff < 10*time.Second {
 			backoff = backoff * 2
 		}
 	}
-	return "", err
+}
+
+// retryJitter returns d reduced by up to 10%.
+func retryJitter(d time.Duration) time.Duration {
+	maxJitter := d / 5
+	if maxJitter > 0 {
+		if n, err := crand.Int(crand.Reader, big.NewInt(int64(maxJitter))); err == nil {
+			return d - time.Duration(n.Int64())/2
+		}
+	}
+	return d
+}
+
+// writeFileAtomic writes data to a temporary file next to path, applies
+// mode and owner, and renames it over path, so readers never see a partial
+// file.
+func writeFileAtomic(path string, data []byte, mode os.FileMode, uid, gid int) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	name := tmp.Name()
+	fail := func(err error) error {
+		_ = tmp.Close()
+		_ = os.Remove(name)
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		return fail(err)
+	}
+	if uid >= 0 || gid >= 0 {
+		if err := tmp.Chown(uid, gid); err != nil {
+			return fail(err)
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(name)
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	if err := os.Rename(name, path); err != nil {
+		_ = os.Remove(name)
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
+
+// parseOwner parses user[:group], given as names or numeric IDs. Missing
+// parts are returned as -1.
+func parseOwner(s string) (uid, gid int, err error) {
+	uid, gid = -1, -1
+	if s == "" {
+		return uid, gid, nil
+	}
+	name, group, _ := strings.Cut(s, ":")
+	if name != "" {
+		if uid, err = lookupUID(name); err != nil {
+			return -1, -1, fmt.Errorf("invalid --owner user %q: %w", name, err)
+		}
+	}
+	if group != "" {
+		if gid, err = lookupGID(group); err != nil {
+			return -1, -1, fmt.Errorf("invalid --owner group %q: %w", group, err)
+		}
+	}
+	return uid, gid, nil
+}
+
+// lookupUID returns the numeric ID of a user given by name or ID.
+func lookupUID(s string) (int, error) {
+	if id, err := strconv.Atoi(s); err == nil && id >= 0 {
+		return id, nil
+	}
+	u, err := user.Lookup(s)
+	if err != nil {
+		return -1, err
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+// lookupGID returns the numeric ID of a group given by name or ID.
+func lookupGID(s string) (int, error) {
+	if id, err := strconv.Atoi(s); err == nil && id >= 0 {
+		return id, nil
+	}
+	g, err := user.LookupGroup(s)
+	if err != nil {
+		return -1, err
+	}
+	return strconv.Atoi(g.Gid)
 }
 
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 
@@ -15,6 +18,7 @@ func newValidateCmd() *cobra.Command {
 		checkProviders bool
 		checkSecrets   bool
 		verbose        bool
+		output         string
 	)
 
 	cmd := &cobra.Command{
@@ -24,86 +28,146 @@ func newValidateCmd() *cobra.Command {
 and connectivity issues. This command helps ensure your configuration
 is correct before using it in production.`,
 		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := checkOutput(output); err != nil {
+				return err
+			}
+			// JSON replaces the progress text with one document.
+			out := cmd.OutOrStdout()
+			if output == outputJSON {
+				out = io.Discard
+			}
+			rep := validateReport{Schema: schemaName("validate"), Config: getConfigPath(), Issues: []validateIssue{}}
+			finish := func(err error) error {
+				rep.Valid = err == nil
+				if err != nil && len(rep.Issues) == 0 {
+					rep.Issues = append(rep.Issues, validateIssue{Kind: issueConfig, Message: err.Error()})
+				}
+				if output == outputJSON {
+					if werr := writeJSON(cmd.OutOrStdout(), rep); werr != nil {
+						return werr
+					}
+				}
+				return err
+			}
+
 			cfg, err := config.Load(cfgPath)
 			if err != nil {
-				return fmt.Errorf("configuration validation failed: %w", err)
+				return finish(exitCodeError{code: 2, err: fmt.Errorf("configuration validation failed: %w", err)})
 			}
+			rep.Secrets = len(cfg.Secrets)
 
-			fmt.Printf("Configuration loaded successfully from %s\n", getConfigPath())
-			fmt.Printf("Found %d secret(s) configured\n", len(cfg.Secrets))
+			_, _ = fmt.Fprintf(out, "Configuration loaded successfully from %s\n", getConfigPath())
+			_, _ = fmt.Fprintf(out, "Found %d secret(s) configured\n", len(cfg.Secrets))
 
 			if verbose {
-				fmt.Println("\nConfiguration summary:")
+				_, _ = fmt.Fprintln(out, "\nConfiguration summary:")
 				for _, secret := range cfg.Secrets {
 					spec := secret.ToSpec()
-					fmt.Printf("  - %s (%s) -> %s\n", secret.Alias, secret.Provider, spec.EnvName)
+					_, _ = fmt.Fprintf(out, "  - %s (%s) -> %s\n", secret.Alias, secret.Provider, spec.EnvName)
 				}
 			}
 
 			// Check provider registration
 			if checkProviders {
-				fmt.Println("\nChecking provider availability...")
+				_, _ = fmt.Fprintln(out, "\nChecking provider availability...")
 				providerIssues := 0
 				for _, secret := range cfg.Secrets {
-					if _, ok := provider.Get(secret.Provider); !ok {
-						fmt.Printf("ERROR: Provider '%s' not found for secret '%s'\n", secret.Provider, secret.Alias)
+					if secret.IsComposite() {
+						if verbose {
+							_, _ = fmt.Fprintf(out, "Secret '%s' is composed from: %s\n", secret.Alias, strings.Join(secret.Dependencies(), ", "))
+						}
+						continue
+					}
+					if missing := missingProvider(secret); missing != "" {
+						_, _ = fmt.Fprintf(out, "ERROR: Provider '%s' not found for secret '%s'\n", missing, secret.Alias)
+						rep.Issues = append(rep.Issues, validateIssue{Alias: secret.Alias, Kind: issueProvider, Message: fmt.Sprintf("provider %s not found", missing)})
 						providerIssues++
 					} else if verbose {
-						fmt.Printf("Provider '%s' available for secret '%s'\n", secret.Provider, secret.Alias)
+						_, _ = fmt.Fprintf(out, "Provider '%s' available for secret '%s'\n", strings.Join(secret.Providers(), ", "), secret.Alias)
 					}
 				}
 				if providerIssues > 0 {
-					return fmt.Errorf("found %d provider issues", providerIssues)
+					return finish(exitCodeError{code: 2, err: fmt.Errorf("found %d provider issues", providerIssues)})
 				}
-				fmt.Println("All providers are available")
+				_, _ = fmt.Fprintln(out, "All providers are available")
 			}
 
-			// Test secret connectivity (dry-run fetch)
+			// Test secret connectivity (dry-run fetch). Failures are reported
+			// as warnings: credentials may be missing where validate runs.
 			if checkSecrets {
-				fmt.Println("\nTesting secret connectivity...")
+				_, _ = fmt.Fprintln(out, "\nTesting secret connectivity...")
 				secretIssues := 0
+				resolver := newSecretResolver(cfg, 1, 0, 0)
 				for _, secret := range cfg.Secrets {
 					spec := secret.ToSpec()
-					p, ok := provider.Get(spec.Provider)
-					if !ok {
-						fmt.Printf("ERROR: Provider '%s' not available for secret '%s'\n", spec.Provider, secret.Alias)
+					if missing := missingProvider(secret); missing != "" {
+						_, _ = fmt.Fprintf(out, "ERROR: Provider '%s' not available for secret '%s'\n", missing, secret.Alias)
+						rep.Warnings = append(rep.Warnings, validateIssue{Alias: secret.Alias, Kind: issueProvider, Message: fmt.Sprintf("provider %s not available", missing)})
 						secretIssues++
 						continue
 					}
 
 					// Test with a short timeout
 					ctx := cmd.Context()
-					_, err := p.FetchSecret(ctx, spec)
+					_, err := resolver.resolve(ctx, secret.Alias)
 					if err != nil {
-						if err == provider.ErrNotFound {
-							fmt.Printf("WARNING: Secret '%s' not found in provider '%s'\n", secret.Alias, spec.Provider)
+						if errors.Is(err, provider.ErrNotFound) {
+							_, _ = fmt.Fprintf(out, "WARNING: Secret '%s' not found in provider '%s'\n", secret.Alias, spec.Provider)
+							rep.Warnings = append(rep.Warnings, validateIssue{Alias: secret.Alias, Kind: issueNotFound, Message: err.Error()})
 						} else {
-							fmt.Printf("ERROR: Error fetching secret '%s': %v\n", secret.Alias, err)
+							_, _ = fmt.Fprintf(out, "ERROR: Error fetching secret '%s': %v\n", secret.Alias, err)
+							rep.Warnings = append(rep.Warnings, validateIssue{Alias: secret.Alias, Kind: issueFetch, Message: err.Error()})
 						}
 						secretIssues++
 					} else if verbose {
-						fmt.Printf("Secret '%s' accessible\n", secret.Alias)
+						_, _ = fmt.Fprintf(out, "Secret '%s' accessible\n", secret.Alias)
 					}
 				}
 				if secretIssues > 0 {
-					fmt.Printf("\nWARNING: Found %d connectivity issues (this might be expected in some environments)\n", secretIssues)
+					_, _ = fmt.Fprintf(out, "\nWARNING: Found %d connectivity issues (this might be expected in some environments)\n", secretIssues)
 				} else {
-					fmt.Println("All secrets are accessible")
+					_, _ = fmt.Fprintln(out, "All secrets are accessible")
 				}
 			}
 
-			fmt.Println("\nValidation completed successfully!")
-			return nil
+			_, _ = fmt.Fprintln(out, "\nValidation completed successfully!")
+			return finish(nil)
 		},
 	}
 
 	cmd.Flags().BoolVar(&checkProviders, "check-providers", true, "Verify all providers are available")
 	cmd.Flags().BoolVar(&checkSecrets, "check-secrets", false, "Test connectivity to all secrets (requires valid credentials)")
 	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Show detailed validation results")
+	addOutputFlag(cmd.Flags(), &output)
 
 	return cmd
 }
 
+// Kinds of validation issues.
+const (
+	issueConfig   = "config"
+	issueProvider = "provider"
+	issueNotFound = "not_found"
+	issueFetch    = "fetch"
+)
+
+// validateReport is the JSON document of skv validate. Issues make the
+// configuration invalid; warnings come from --check-secrets and do not.
+type validateReport struct {
+	Schema   string          `json:"schema"`
+	Config   string          `json:"config"`
+	Valid    bool            `json:"valid"`
+	Secrets  int             `json:"secrets"`
+	Issues   []validateIssue `json:"issues"`
+	Warnings []validateIssue `json:"warnings,omitempty"`
+}
+
+type validateIssue struct {
+	Alias   string `json:"alias,omitempty"`
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
 func getConfigPath() string {
 	if cfgPath != "" {
 		return cfgPath
@@ -2,11 +2,20 @@ package main
 
 import (
 	"context"
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"math/big"
+	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
+	"sort"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -17,195 +26,528 @@ import (
 
 func newWatchCmd() *cobra.Command {
 	var (
-		secretsCSV   string
-		secretsList  []string
-		all          bool
-		allExceptCSV string
-		interval     string
-		command      string
-		onChangeOnly bool
-		timeoutStr   string
+		sel              secretSelection
+		interval         string
+		onChangeOnly     bool
+		timeoutStr       string
+		fetchTimeout     string
+		jitter           float64
+		maxBackoff       string
+		events           string
+		webhooks         []string
+		webhookSecretEnv string
+		webhookRetries   int
+		hooks            []string
+		shell            bool
+		injectEnv        bool
+		commandTimeout   string
+		onFailure        string
+		commandRetries   int
+		output           string
 	)
 
 	c := &cobra.Command{
-		Use:   "watch [flags] -- <command>",
+		Use:   "watch [flags] [-- <command>]",
 		Short: "Watch secrets for changes and execute command",
 		Long: `Watch configured secrets for changes and execute a command when they change.
 
-The watch command periodically checks secrets and runs the specified command
-when changes are detected. This is useful for restarting services or updating
-configurations when secrets change.`,
-		Args: cobra.MinimumNArgs(1),
-		RunE: func(_ *cobra.Command, args []string) error {
-			command = strings.Join(args, " ")
-			return runWatch(secretsCSV, secretsList, all, allExceptCSV, interval, command, onChangeOnly, timeoutStr)
+Each secret is polled on its own schedule: its watch_interval, else the
+shortest watch.tag_intervals entry of its tags, else --interval. Sources that
+fail are retried with exponential backoff without delaying the others. The
+command runs with SKV_CHANGED set to the comma-separated aliases that changed.
+Only keyed hashes of the values are kept between polls.
+
+The command is run with its arguments exactly as given, or by the shell with
+--shell. It gets the current values of the watched secrets in its environment,
+as with skv run, and its exit status is reported; --on-failure decides
+whether a failed run is ignored, retried or stops watching.
+
+Every change of state (changed, fetch_failed, recovered, deleted) is also an
+event that can be written as JSON lines with --events, posted to --webhook
+URLs and passed to --hook commands. Events never contain secret values.
+--output json is --events - : events on stdout, everything else on stderr.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkOutput(output); err != nil {
+				return err
+			}
+			if output == outputJSON {
+				if events != "" && events != "-" {
+					return exitCodeError{code: 2, err: errors.New("--output json writes events to stdout; it cannot be combined with --events <file>")}
+				}
+				events = "-"
+			}
+			opts, err := parseWatchOptions(interval, timeoutStr, fetchTimeout, maxBackoff, jitter)
+			if err != nil {
+				return exitCodeError{code: 2, err: err}
+			}
+			opts.onChangeOnly = onChangeOnly
+			if len(args) == 0 && events == "" && len(webhooks) == 0 && len(hooks) == 0 {
+				return exitCodeError{code: 2, err: errors.New("a command, --events, --webhook or --hook is required")}
+			}
+			if err := parseFailurePolicy(onFailure); err != nil {
+				return exitCodeError{code: 2, err: err}
+			}
+			var x *watchExecutor
+			if len(args) > 0 {
+				x = &watchExecutor{
+					argv:       args,
+					shell:      shell,
+					injectEnv:  injectEnv,
+					onFailure:  onFailure,
+					retries:    commandRetries,
+					retryDelay: time.Second,
+				}
+				if commandTimeout != "" {
+					if x.timeout, err = time.ParseDuration(commandTimeout); err != nil || x.timeout < 0 {
+						return exitCodeError{code: 2, err: fmt.Errorf("invalid --command-timeout: %q", commandTimeout)}
+					}
+				}
+			}
+			n := &eventNotifier{
+				webhooks:    webhooks,
+				retries:     webhookRetries,
+				retryDelay:  time.Second,
+				client:      &http.Client{Timeout: webhookTimeout},
+				hooks:       hooks,
+				hookTimeout: hookTimeout,
+				log:         os.Stdout,
+			}
+			if len(webhooks) > 0 {
+				secret := os.Getenv(webhookSecretEnv)
+				if secret == "" {
+					return exitCodeError{code: 2, err: fmt.Errorf("--webhook requires a signing secret in $%s", webhookSecretEnv)}
+				}
+				n.webhookSecret = []byte(secret)
+			}
+			switch events {
+			case "":
+			case "-":
+				// Keep stdout a clean JSON-lines stream.
+				n.stream, n.log = os.Stdout, os.Stderr
+			default:
+				f, err := os.OpenFile(events, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600) // #nosec G304 - path chosen by the user
+				if err != nil {
+					return exitCodeError{code: 2, err: fmt.Errorf("open --events file: %w", err)}
+				}
+				defer func() { _ = f.Close() }()
+				n.stream = f
+			}
+			return runWatch(cmd.Context(), &sel, opts, n, x)
 		},
 	}
 
-	c.Flags().StringVar(&secretsCSV, "secrets", "", "Comma-separated list of aliases to watch")
-	c.Flags().StringSliceVarP(&secretsList, "secret", "s", nil, "Secret alias to watch (repeatable)")
-	c.Flags().BoolVar(&all, "all", false, "Watch all configured secrets")
-	c.Flags().StringVar(&allExceptCSV, "all-except", "", "Comma-separated aliases to exclude when using --all")
-	c.Flags().StringVar(&interval, "interval", "30s", "Check interval (e.g., 30s, 5m, 1h)")
+	sel.addFlags(c.Flags(), "Watch")
+	c.Flags().StringVar(&interval, "interval", "30s", "Default check interval (e.g., 30s, 5m, 1h)")
 	c.Flags().BoolVar(&onChangeOnly, "on-change-only", false, "Only execute command when secrets change")
 	c.Flags().StringVar(&timeoutStr, "timeout", "", "Timeout for watch command (e.g., 30s, 5m, 1h)")
+	c.Flags().StringVar(&fetchTimeout, "fetch-timeout", "30s", "Timeout for fetching one secret")
+	c.Flags().Float64Var(&jitter, "jitter", 0.1, "Random spread applied to each interval, as a fraction of it (0 to disable)")
+	c.Flags().StringVar(&maxBackoff, "max-backoff", "5m", "Longest delay between retries of a failing secret")
+	c.Flags().StringVar(&events, "events", "", "Write events as JSON lines to this file, or - for stdout")
+	c.Flags().StringArrayVar(&webhooks, "webhook", nil, "POST each event as JSON to this URL (repeatable)")
+	c.Flags().StringVar(&webhookSecretEnv, "webhook-secret-env", "SKV_WEBHOOK_SECRET", "Environment variable holding the webhook signing secret")
+	c.Flags().IntVar(&webhookRetries, "webhook-retries", 3, "Number of retries for failed webhook deliveries")
+	c.Flags().StringArrayVar(&hooks, "hook", nil, "Shell command run for each event, with the event in SKV_* variables (repeatable)")
+	c.Flags().BoolVar(&shell, "shell", false, "Run the command through the shell (sh -c, or cmd /C on Windows)")
+	c.Flags().BoolVar(&injectEnv, "inject-env", true, "Set the watched secrets in the command's environment")
+	c.Flags().StringVar(&commandTimeout, "command-timeout", "", "Stop the command if a run takes longer (e.g., 30s, 5m)")
+	c.Flags().StringVar(&onFailure, "on-failure", failureContinue, "What to do when the command fails: continue, retry or exit")
+	c.Flags().IntVar(&commandRetries, "command-retries", 3, "Number of retries of a failed run with --on-failure retry")
+	addOutputFlag(c.Flags(), &output)
 
 	return c
 }
 
-func runWatch(secretsCSV string, secretsList []string, all bool, allExceptCSV, intervalStr, command string, onChangeOnly bool, timeoutStr string) error {
+// watchOptions holds the parsed flags of `skv watch`.
+type watchOptions struct {
+	interval     time.Duration
+	timeout      time.Duration
+	fetchTimeout time.Duration
+	maxBackoff   time.Duration
+	jitter       float64
+	onChangeOnly bool
+}
+
+func parseWatchOptions(interval, timeout, fetchTimeout, maxBackoff string, jitter float64) (watchOptions, error) {
+	var (
+		o   watchOptions
+		err error
+	)
+	if o.interval, err = time.ParseDuration(interval); err != nil || o.interval <= 0 {
+		return o, fmt.Errorf("invalid interval: %q", interval)
+	}
+	if timeout != "" {
+		if o.timeout, err = time.ParseDuration(timeout); err != nil {
+			return o, fmt.Errorf("invalid --timeout: %w", err)
+		}
+	}
+	if o.fetchTimeout, err = time.ParseDuration(fetchTimeout); err != nil || o.fetchTimeout < 0 {
+		return o, fmt.Errorf("invalid --fetch-timeout: %q", fetchTimeout)
+	}
+	if o.maxBackoff, err = time.ParseDuration(maxBackoff); err != nil || o.maxBackoff <= 0 {
+		return o, fmt.Errorf("invalid --max-backoff: %q", maxBackoff)
+	}
+	if jitter < 0 || jitter >= 1 {
+		return o, fmt.Errorf("invalid --jitter %v (use a fraction from 0 to below 1)", jitter)
+	}
+	o.jitter = jitter
+	return o, nil
+}
+
+// runWatch watches the selected secrets until ctx is done, the timeout
+// passes or a signal arrives. Progress goes to n.log; x is nil when only
+// events are wanted. With --on-failure exit, a failed run stops watching
+// and is returned.
+func runWatch(ctx context.Context, sel *secretSelection, opts watchOptions, n *eventNotifier, x *watchExecutor) error {
 	cfg, err := config.Load(cfgPath)
 	if err != nil {
 		return exitCodeError{code: 2, err: err}
 	}
 
-	// Parse interval
-	interval, err := time.ParseDuration(intervalStr)
+	// Determine which secrets to watch and how often
+	aliases, err := sel.resolve(cfg)
 	if err != nil {
-		return exitCodeError{code: 2, err: fmt.Errorf("invalid interval: %w", err)}
-	}
-
-	// Determine which secrets to watch
-	excluded := map[string]struct{}{}
-	for _, a := range strings.Split(allExceptCSV, ",") {
-		if t := strings.TrimSpace(a); t != "" {
-			excluded[t] = struct{}{}
-		}
+		return err
 	}
-
-	watchList := map[string]struct{}{}
-	if all {
-		for _, s := range cfg.Secrets {
-			if _, skip := excluded[s.Alias]; !skip {
-				watchList[s.Alias] = struct{}{}
-			}
+	intervals := make(map[string]time.Duration, len(aliases))
+	for _, a := range aliases {
+		s, ok := cfg.FindByAlias(a)
+		if !ok {
+			return exitCodeError{code: 4, err: fmt.Errorf("secret '%s' not found in configuration", a)}
 		}
-	}
-	if secretsCSV != "" {
-		for _, a := range strings.Split(secretsCSV, ",") {
-			a = strings.TrimSpace(a)
-			if a != "" {
-				watchList[a] = struct{}{}
-			}
+		intervals[a] = opts.interval
+		if d, ok := cfg.WatchInterval(s); ok {
+			intervals[a] = d
 		}
 	}
-	for _, a := range secretsList {
-		watchList[a] = struct{}{}
+	engine, err := newWatchEngine(cfg, intervals, opts)
+	if err != nil {
+		return err
 	}
 
-	if len(watchList) == 0 {
-		return exitCodeError{code: 2, err: fmt.Errorf("no secrets selected; use --all or --secrets/-s")}
+	out := n.log
+	engine.out = out
+	_, _ = fmt.Fprintf(out, "Watching %d secret(s) with %v default interval\n", len(aliases), opts.interval)
+	if x != nil {
+		x.cfg, x.aliases, x.breakers, x.limits = cfg, aliases, engine.breakers, engine.limits
+		x.fetchTimeout, x.stdout, x.log = opts.fetchTimeout, out, out
+		if x.shell {
+			_, _ = fmt.Fprintf(out, "Command (shell): %s\n", strings.Join(x.argv, " "))
+		} else {
+			_, _ = fmt.Fprintf(out, "Command: %q\n", x.argv)
+		}
 	}
 
-	fmt.Printf("Watching %d secret(s) with %v interval\n", len(watchList), interval)
-	fmt.Printf("Command: %s\n", command)
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	sigCtx := ctx // not ended by --timeout, so the last events are still delivered
 
 	// Initial execution
-	if !onChangeOnly {
-		fmt.Println("\nInitial execution...")
-		if err := executeCommand(command); err != nil {
-			fmt.Printf("ERROR: Initial command failed: %v\n", err)
+	if x != nil && !opts.onChangeOnly {
+		_, _ = fmt.Fprintln(out, "\nInitial execution...")
+		if err := x.run(ctx, nil); err != nil {
+			return exitCodeError{code: 5, err: err}
 		}
 	}
 
-	// Set up signal handling for graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+		_, _ = fmt.Fprintf(out, "Watch will timeout after %v\n", opts.timeout)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	// Set up timeout if specified
-	var timeoutChan <-chan time.Time
-	if timeoutStr != "" {
-		timeout, err := time.ParseDuration(timeoutStr)
-		if err != nil {
-			return exitCodeError{code: 2, err: fmt.Errorf("invalid --timeout: %w", err)}
+	n.start(sigCtx)
+	defer n.close()
+	engine.emit = func(ev watchEvent) {
+		_, _ = fmt.Fprintf(out, "INFO: %s\n", ev)
+		n.notify(ev)
+	}
+	var failed error // set by the action, read after engine.run waited for it
+	if x != nil {
+		engine.onChange = func(changed []string) {
+			_, _ = fmt.Fprintf(out, "Secrets changed: %s\nExecuting command...\n", strings.Join(changed, ", "))
+			if err := x.run(ctx, changed); err != nil {
+				failed = err
+				cancel()
+			}
 		}
-		timeoutChan = time.After(timeout)
-		fmt.Printf("Watch will timeout after %v\n", timeout)
 	}
 
-	// Track secret values
-	lastValues := make(map[string]string)
+	_, _ = fmt.Fprintf(out, "\nStarting watch loop (Ctrl+C to stop)...\n")
+	engine.run(ctx)
+	switch {
+	case failed != nil:
+		return exitCodeError{code: 5, err: failed}
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		_, _ = fmt.Fprintln(out, "\nWatch timed out")
+	default:
+		_, _ = fmt.Fprintln(out, "\nWatch stopped")
+	}
+	return nil
+}
 
-	// Watch loop
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+// watchSettle is how long the engine collects further changes before it
+// runs the action, so that secrets rotated together trigger it once.
+const watchSettle = time.Second
 
-	fmt.Printf("\nStarting watch loop (Ctrl+C to stop)...\n")
+// watchEngine polls each watched secret on its own schedule, emits an
+// event for each change of state and calls onChange with the aliases whose
+// value changed. It keeps an HMAC of each value under a key generated for
+// this process, never the value itself.
+type watchEngine struct {
+	cfg          *config.Config
+	intervals    map[string]time.Duration // alias -> poll interval
+	jitter       float64
+	maxBackoff   time.Duration
+	fetchTimeout time.Duration
+	settle       time.Duration
+	breakers     *breakerSet
+	limits       *limiterSet
+	key          []byte
+	out          io.Writer // progress messages
+	fetchValue   func(ctx context.Context, alias string) (string, error)
+	emit         func(ev watchEvent)
+	onChange     func(changed []string)
+}
 
+// watchPoll is the outcome of fetching one secret.
+type watchPoll struct {
+	alias string
+	sum   []byte
+	err   error
+}
+
+// watchState is what the engine remembers about one secret.
+type watchState struct {
+	sum     []byte // nil until the first successful fetch
+	failing bool
+	deleted bool
+}
+
+func newWatchEngine(cfg *config.Config, intervals map[string]time.Duration, opts watchOptions) (*watchEngine, error) {
+	key := make([]byte, 32)
+	if _, err := crand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate hash key: %w", err)
+	}
+	e := &watchEngine{
+		cfg:          cfg,
+		intervals:    intervals,
+		jitter:       opts.jitter,
+		maxBackoff:   opts.maxBackoff,
+		fetchTimeout: opts.fetchTimeout,
+		settle:       watchSettle,
+		breakers:     newConfigBreakers(cfg),
+		limits:       newLimiterSet(cfg),
+		key:          key,
+		out:          os.Stdout,
+		emit:         func(watchEvent) {},
+		onChange:     func([]string) {},
+	}
+	e.fetchValue = e.fetch
+	return e, nil
+}
+
+// run polls until ctx is done. The first successful fetch of a secret sets
+// its baseline; later fetches that differ are reported. The action runs in
+// the background and is run again for changes seen meanwhile. run returns
+// after a running action finished.
+func (e *watchEngine) run(ctx context.Context) {
+	polls := make(chan watchPoll)
+	var wg sync.WaitGroup
+	for alias, interval := range e.intervals {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.poll(ctx, alias, interval, polls)
+		}()
+	}
+	defer wg.Wait()
+
+	states := map[string]*watchState{}
+	pending := map[string]bool{}
+	var (
+		settle  <-chan time.Time
+		running chan struct{} // closed when the action finished
+	)
+	start := func() {
+		changed := make([]string, 0, len(pending))
+		for alias := range pending {
+			changed = append(changed, alias)
+		}
+		sort.Strings(changed)
+		pending = map[string]bool{}
+		running = make(chan struct{})
+		go func(done chan struct{}) {
+			defer close(done)
+			e.onChange(changed)
+		}(running)
+	}
 	for {
 		select {
-		case <-sigChan:
-			fmt.Println("\nWatch stopped by user")
-			return nil
-		case <-ticker.C:
-			if err := checkAndExecute(cfg, watchList, lastValues, command, onChangeOnly); err != nil {
-				fmt.Printf("ERROR: Watch error: %v\n", err)
+		case <-ctx.Done():
+			if running != nil {
+				<-running
 			}
-		}
-		// Check timeout outside select if specified
-		if timeoutChan != nil {
-			select {
-			case <-timeoutChan:
-				fmt.Println("\nWatch timed out")
-				return nil
-			default:
+			return
+		case p := <-polls:
+			st := states[p.alias]
+			if st == nil {
+				st = &watchState{}
+				states[p.alias] = st
+			}
+			if !e.observe(st, p) {
+				continue
+			}
+			pending[p.alias] = true
+			if settle == nil {
+				settle = time.After(e.settle)
+			}
+		case <-settle:
+			settle = nil
+			if running == nil {
+				start()
+			}
+		case <-running:
+			running = nil
+			if len(pending) > 0 && settle == nil {
+				start()
 			}
 		}
 	}
 }
 
-func checkAndExecute(cfg *config.Config, watchList map[string]struct{}, lastValues map[string]string, command string, onChangeOnly bool) error {
-	ctx := context.Background()
-	changed := false
-
-	for alias := range watchList {
-		s, ok := cfg.FindByAlias(alias)
-		if !ok {
-			return fmt.Errorf("secret '%s' not found in configuration", alias)
+// observe records p in st, emits the events it implies and reports whether
+// the value changed. Failures are reported once per streak; a value that
+// is no longer found is reported as deleted.
+func (e *watchEngine) observe(st *watchState, p watchPoll) bool {
+	ev := watchEvent{Alias: p.alias, OldVersion: e.version(st.sum), Time: time.Now().UTC()}
+	if s, ok := e.cfg.FindByAlias(p.alias); ok {
+		ev.Provider = s.Provider
+	}
+	if p.err != nil {
+		ev.Error = p.err.Error()
+		switch {
+		case errors.Is(p.err, provider.ErrNotFound) && !st.deleted:
+			st.deleted, st.failing = true, false
+			ev.Type = eventDeleted
+		case !st.failing && !st.deleted:
+			st.failing = true
+			ev.Type = eventFetchFailed
+		default:
+			return false
 		}
+		e.emit(ev)
+		return false
+	}
 
-		spec := s.ToSpec()
-		p, ok := provider.Get(spec.Provider)
-		if !ok {
-			return fmt.Errorf("unknown provider '%s' for secret '%s'", spec.Provider, alias)
+	ev.NewVersion = e.version(p.sum)
+	if st.failing || st.deleted {
+		st.failing, st.deleted = false, false
+		ev.Type = eventRecovered
+		e.emit(ev)
+	}
+	prev := st.sum
+	st.sum = p.sum
+	if prev == nil || hmac.Equal(prev, p.sum) {
+		return false
+	}
+	ev.Type = eventChanged
+	e.emit(ev)
+	return true
+}
+
+// version returns a short identifier of a value hash, or "" for none.
+// Identifiers are only comparable within one process.
+func (e *watchEngine) version(sum []byte) string {
+	if len(sum) == 0 {
+		return ""
+	}
+	return hex.EncodeToString(sum[:6])
+}
+
+// poll fetches alias every interval and sends the outcome to polls. After
+// a failure it waits exponentially longer, up to maxBackoff.
+func (e *watchEngine) poll(ctx context.Context, alias string, interval time.Duration, polls chan<- watchPoll) {
+	wait := time.Duration(0)
+	failures := 0
+	for {
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
 		}
 
-		value, err := p.FetchSecret(ctx, spec)
+		p := watchPoll{alias: alias}
+		value, err := e.fetchValue(ctx, alias)
+		if ctx.Err() != nil {
+			return
+		}
 		if err != nil {
-			return fmt.Errorf("failed to fetch secret '%s': %w", alias, err)
+			failures++
+			wait = e.jittered(e.backoff(interval, failures))
+			_, _ = fmt.Fprintf(e.out, "WARN: failed to fetch secret '%s' (%d consecutive failure(s), retrying in %v): %v\n",
+				alias, failures, wait.Round(time.Millisecond), err)
+			p.err = err
+		} else {
+			failures = 0
+			wait = e.jittered(interval)
+			p.sum = e.sum(value)
 		}
-
-		lastValue, exists := lastValues[alias]
-		if !exists || lastValue != value {
-			if exists {
-				fmt.Printf("INFO: Secret '%s' changed\n", alias)
-			}
-			lastValues[alias] = value
-			changed = true
+		select {
+		case polls <- p:
+		case <-ctx.Done():
+			return
 		}
 	}
+}
 
-	if changed || !onChangeOnly {
-		fmt.Printf("Executing command...\n")
-		if err := executeCommand(command); err != nil {
-			return fmt.Errorf("command execution failed: %w", err)
-		}
+// fetch resolves alias with a fresh resolver, so rotated values are seen.
+func (e *watchEngine) fetch(ctx context.Context, alias string) (string, error) {
+	if e.fetchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.fetchTimeout)
+		defer cancel()
 	}
+	resolver := newSecretResolver(e.cfg, 1, 0, 0)
+	resolver.breakers, resolver.limits = e.breakers, e.limits
+	return resolver.resolve(ctx, alias)
+}
 
-	return nil
+// sum returns the keyed hash of value.
+func (e *watchEngine) sum(value string) []byte {
+	h := hmac.New(sha256.New, e.key)
+	h.Write([]byte(value))
+	return h.Sum(nil)
 }
 
-func executeCommand(command string) error {
-	// Parse command (simple splitting, no complex shell parsing)
-	parts := strings.Fields(command)
-	if len(parts) == 0 {
-		return fmt.Errorf("empty command")
+// backoff returns the delay before the next fetch after failures
+// consecutive failures: interval, doubled per further failure, capped at
+// maxBackoff but never below interval.
+func (e *watchEngine) backoff(interval time.Duration, failures int) time.Duration {
+	limit := max(e.maxBackoff, interval)
+	d := interval
+	for i := 1; i < failures && d < limit; i++ {
+		d *= 2
 	}
+	return min(d, limit)
+}
 
-	cmd := exec.Command(parts[0], parts[1:]...) // #nosec G204 - command parts come from user input, which is expected for watch command
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	return cmd.Run()
+// jittered spreads d by up to ±jitter of its length, so that secrets with
+// the same interval are not fetched in lockstep.
+func (e *watchEngine) jittered(d time.Duration) time.Duration {
+	span := int64(float64(d) * e.jitter)
+	if span <= 0 {
+		return d
+	}
+	n, err := crand.Int(crand.Reader, big.NewInt(2*span+1))
+	if err != nil {
+		return d
+	}
+	return d + time.Duration(n.Int64()-span)
 }
 
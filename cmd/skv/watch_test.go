@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"skv/internal/config"
+)
+
+func TestWatchEngineBackoff(t *testing.T) {
+	e := &watchEngine{maxBackoff: time.Minute}
+	tests := []struct {
+		interval time.Duration
+		failures int
+		want     time.Duration
+	}{
+		{10 * time.Second, 1, 10 * time.Second},
+		{10 * time.Second, 2, 20 * time.Second},
+		{10 * time.Second, 3, 40 * time.Second},
+		{10 * time.Second, 4, time.Minute},
+		{10 * time.Second, 100, time.Minute},
+		{5 * time.Minute, 3, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := e.backoff(tt.interval, tt.failures); got != tt.want {
+			t.Errorf("backoff(%v, %d) = %v, want %v", tt.interval, tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestWatchEngineJitter(t *testing.T) {
+	e := &watchEngine{jitter: 0.2}
+	for range 100 {
+		if d := e.jittered(10 * time.Second); d < 8*time.Second || d > 12*time.Second {
+			t.Fatalf("jittered(10s) = %v, want within 8s..12s", d)
+		}
+	}
+	e.jitter = 0
+	if d := e.jittered(10 * time.Second); d != 10*time.Second {
+		t.Fatalf("jittered without jitter = %v", d)
+	}
+}
+
+func TestParseWatchOptions(t *testing.T) {
+	tests := []struct {
+		name                                     string
+		interval, timeout, fetchTimeout, backoff string
+		jitter                                   float64
+		wantErr                                  bool
+	}{
+		{"defaults", "30s", "", "30s", "5m", 0.1, false},
+		{"zero interval", "0s", "", "30s", "5m", 0.1, true},
+		{"bad timeout", "30s", "soon", "30s", "5m", 0.1, true},
+		{"bad max-backoff", "30s", "", "30s", "0s", 0.1, true},
+		{"jitter too large", "30s", "", "30s", "5m", 1, true},
+		{"negative jitter", "30s", "", "30s", "5m", -0.1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseWatchOptions(tt.interval, tt.timeout, tt.fetchTimeout, tt.backoff, tt.jitter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseWatchOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWatchEngine(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires cat")
+	}
+	skipIfShort(t)
+	dir := t.TempDir()
+	write := func(name, value string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a", "a1")
+	write("b", "b1")
+	_ = newRootCmd()
+	// "broken" never exists, so its source keeps failing.
+	cfgPath = writeTestConfig(t, `secrets:
+  - alias: a
+    provider: exec
+    name: `+filepath.Join(dir, "a")+`
+    extras: {cmd: cat}
+  - alias: b
+    provider: exec
+    name: `+filepath.Join(dir, "b")+`
+    extras: {cmd: cat}
+  - alias: broken
+    provider: exec
+    name: `+filepath.Join(dir, "broken")+`
+    extras: {cmd: cat}
+`)
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intervals := map[string]time.Duration{"a": 20 * time.Millisecond, "b": 20 * time.Millisecond, "broken": 20 * time.Millisecond}
+	e, err := newWatchEngine(cfg, intervals, watchOptions{maxBackoff: time.Second, fetchTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.settle = 100 * time.Millisecond
+	changes := make(chan []string, 10)
+	e.onChange = func(changed []string) { changes <- changed }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.run(ctx)
+	}()
+	next := func() []string {
+		t.Helper()
+		select {
+		case c := <-changes:
+			return c
+		case <-time.After(10 * time.Second):
+			t.Fatal("no change reported")
+			return nil
+		}
+	}
+
+	// Let every secret get its baseline before changing values.
+	time.Sleep(200 * time.Millisecond)
+	select {
+	case c := <-changes:
+		t.Fatalf("change reported without a change: %v", c)
+	default:
+	}
+	write("a", "a2")
+	if got := next(); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Fatalf("changed = %v, want [a]", got)
+	}
+	write("a", "a3")
+	write("b", "b2")
+	if got := next(); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Fatalf("changed = %v, want [a b]", got)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("engine did not stop")
+	}
+}
+
+func TestWatchFlags(t *testing.T) {
+	_ = newRootCmd()
+	registerMock("mock")
+	cfgPath = writeTestConfig(t, "secrets:\n  - alias: token\n    provider: mock\n    name: t\n    extras:\n      value: v\n")
+	t.Setenv("SKV_WEBHOOK_SECRET", "")
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--all"}, "a command, --events, --webhook or --hook is required"},
+		{[]string{"--all", "--webhook", "http://127.0.0.1:1/hook"}, "signing secret in $SKV_WEBHOOK_SECRET"},
+		{[]string{"--all", "--jitter", "2", "--", "true"}, "invalid --jitter"},
+		{[]string{"--all", "--on-failure", "ignore", "--", "true"}, `invalid --on-failure "ignore"`},
+		{[]string{"--all", "--command-timeout", "soon", "--", "true"}, "invalid --command-timeout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			c := newWatchCmd()
+			c.SetArgs(tt.args)
+			err := c.Execute()
+			var ee exitCodeError
+			if !errors.As(err, &ee) || ee.code != 2 || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("watch = %v, want code 2 with %q", err, tt.want)
+			}
+		})
+	}
+}
+
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	skvversion "skv/internal/version"
+)
+
+// Watch event types.
+const (
+	eventChanged     = "changed"
+	eventFetchFailed = "fetch_failed"
+	eventRecovered   = "recovered"
+	eventDeleted     = "deleted"
+)
+
+// watchEvent describes a change in the state of a watched secret. It never
+// carries values; versions are short keyed hashes.
+type watchEvent struct {
+	Schema     string    `json:"schema"`
+	Type       string    `json:"type"`
+	Alias      string    `json:"alias"`
+	Provider   string    `json:"provider,omitempty"`
+	OldVersion string    `json:"old_version,omitempty"`
+	NewVersion string    `json:"new_version,omitempty"`
+	Time       time.Time `json:"time"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// String returns a one-line description for progress output.
+func (ev watchEvent) String() string {
+	switch ev.Type {
+	case eventChanged:
+		return fmt.Sprintf("Secret '%s' changed", ev.Alias)
+	case eventFetchFailed:
+		return fmt.Sprintf("Secret '%s' could not be fetched: %s", ev.Alias, ev.Error)
+	case eventRecovered:
+		return fmt.Sprintf("Secret '%s' can be fetched again", ev.Alias)
+	case eventDeleted:
+		return fmt.Sprintf("Secret '%s' no longer exists", ev.Alias)
+	}
+	return fmt.Sprintf("Secret '%s': %s", ev.Alias, ev.Type)
+}
+
+// environ returns the event as SKV_* variables for hook commands.
+func (ev watchEvent) environ() []string {
+	data, _ := json.Marshal(ev)
+	return []string{
+		"SKV_EVENT=" + ev.Type,
+		"SKV_ALIAS=" + ev.Alias,
+		"SKV_PROVIDER=" + ev.Provider,
+		"SKV_OLD_VERSION=" + ev.OldVersion,
+		"SKV_NEW_VERSION=" + ev.NewVersion,
+		"SKV_EVENT_TIME=" + ev.Time.Format(time.RFC3339),
+		"SKV_ERROR=" + ev.Error,
+		"SKV_EVENT_JSON=" + string(data),
+	}
+}
+
+// webhookTimeout bounds each webhook delivery attempt.
+const webhookTimeout = 10 * time.Second
+
+// hookTimeout bounds each hook command, so that a hung hook does not hold
+// up later events or shutdown.
+const hookTimeout = 30 * time.Second
+
+// eventQueueSize bounds the events waiting for delivery; further events are
+// dropped with a warning rather than delaying the watch loop.
+const eventQueueSize = 256
+
+// eventNotifier delivers watch events, in order and in the background, to a
+// JSON-lines stream, webhooks and hook commands.
+type eventNotifier struct {
+	stream        io.Writer // JSON lines; nil disables
+	webhooks      []string
+	webhookSecret []byte
+	retries       int
+	retryDelay    time.Duration
+	client        *http.Client
+	hooks         []string
+	hookTimeout   time.Duration // a hook running longer is stopped; 0 means none
+	log           io.Writer     // warnings and hook output
+
+	queue chan watchEvent
+	done  chan struct{}
+}
+
+// start begins delivering queued events. Once ctx is done, webhook
+// deliveries are no longer retried, so shutting down does not wait for
+// their backoff; each attempt is still made, bounded by webhookTimeout.
+func (n *eventNotifier) start(ctx context.Context) {
+	n.queue = make(chan watchEvent, eventQueueSize)
+	n.done = make(chan struct{})
+	go func() {
+		defer close(n.done)
+		for ev := range n.queue {
+			n.deliver(ctx, ev)
+		}
+	}()
+}
+
+// notify queues ev for delivery.
+func (n *eventNotifier) notify(ev watchEvent) {
+	select {
+	case n.queue <- ev:
+	default:
+		_, _ = fmt.Fprintf(n.log, "WARN: event queue full; dropped %s event for '%s'\n", ev.Type, ev.Alias)
+	}
+}
+
+// close delivers the queued events and stops.
+func (n *eventNotifier) close() {
+	close(n.queue)
+	<-n.done
+}
+
+func (n *eventNotifier) deliver(ctx context.Context, ev watchEvent) {
+	ev.Schema = schemaName("watch-event")
+	body, err := json.Marshal(ev)
+	if err != nil {
+		_, _ = fmt.Fprintf(n.log, "WARN: encode event: %v\n", err)
+		return
+	}
+	if n.stream != nil {
+		if _, err := n.stream.Write(append(body, '\n')); err != nil {
+			_, _ = fmt.Fprintf(n.log, "WARN: write event: %v\n", err)
+		}
+	}
+	for _, url := range n.webhooks {
+		if err := n.post(ctx, url, ev.Type, body); err != nil {
+			_, _ = fmt.Fprintf(n.log, "WARN: webhook %s: %v\n", url, err)
+		}
+	}
+	for _, hook := range n.hooks {
+		c := shellCommand(hook)
+		c.Env = append(os.Environ(), ev.environ()...)
+		c.Stdout, c.Stderr = n.log, n.log
+		// Hooks run on shutdown too, so only the timeout stops them.
+		_, err := runGroup(context.Background(), c, n.hookTimeout)
+		switch {
+		case errors.Is(err, errTimedOut):
+			_, _ = fmt.Fprintf(n.log, "WARN: hook %q killed: %v\n", hook, err)
+		case err != nil:
+			_, _ = fmt.Fprintf(n.log, "WARN: hook %q failed: %v\n", hook, err)
+		}
+	}
+}
+
+// post sends body to url, signed with the webhook secret. Network errors,
+// 429 and 5xx answers are retried with doubling delays until ctx is done.
+func (n *eventNotifier) post(ctx context.Context, url, eventType string, body []byte) error {
+	delay := n.retryDelay
+	var err error
+	for attempt := 0; attempt <= n.retries; attempt++ {
+		if attempt > 0 {
+			t := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return fmt.Errorf("%w (gave up after %d attempt(s))", err, attempt)
+			case <-t.C:
+			}
+			delay *= 2
+		}
+		var retry bool
+		if retry, err = n.postOnce(url, eventType, body); err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+// webhookSignature returns the HMAC-SHA256 of "<timestamp>.<body>" keyed
+// with secret. Signing the timestamp lets receivers reject replayed
+// deliveries.
+func webhookSignature(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// postOnce makes one delivery attempt. It does not stop on shutdown, so
+// the events of the last round are still delivered.
+func (n *eventNotifier) postOnce(url, eventType string, body []byte) (retry bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "skv/"+skvversion.Version)
+	req.Header.Set("X-Skv-Event", eventType)
+	req.Header.Set("X-Skv-Timestamp", timestamp)
+	req.Header.Set("X-Skv-Signature", webhookSignature(n.webhookSecret, timestamp, body))
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("unexpected status %s", strings.TrimSpace(resp.Status))
+}
+
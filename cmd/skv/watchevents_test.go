@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"skv/internal/config"
+	"skv/internal/provider"
+)
+
+func TestWatchEngineObserve(t *testing.T) {
+	cfg := &config.Config{Secrets: []config.Secret{{Alias: "db", Provider: "aws"}}}
+	e, err := newWatchEngine(cfg, nil, watchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []watchEvent
+	e.emit = func(ev watchEvent) { got = append(got, ev) }
+
+	v1, v2 := e.sum("v1"), e.sum("v2")
+	boom := errors.New("timeout")
+	gone := provider.ErrNotFound
+	tests := []struct {
+		name    string
+		polls   []watchPoll
+		events  []string
+		changed []bool
+	}{
+		{"baseline", []watchPoll{{sum: v1}}, nil, []bool{false}},
+		{"unchanged", []watchPoll{{sum: v1}, {sum: v1}}, nil, []bool{false, false}},
+		{"changed", []watchPoll{{sum: v1}, {sum: v2}}, []string{eventChanged}, []bool{false, true}},
+		{"failures reported once", []watchPoll{{sum: v1}, {err: boom}, {err: boom}, {sum: v1}},
+			[]string{eventFetchFailed, eventRecovered}, []bool{false, false, false, false}},
+		{"recovered with a new value", []watchPoll{{sum: v1}, {err: boom}, {sum: v2}},
+			[]string{eventFetchFailed, eventRecovered, eventChanged}, []bool{false, false, true}},
+		{"deleted and recreated", []watchPoll{{sum: v1}, {err: gone}, {err: gone}, {sum: v2}},
+			[]string{eventDeleted, eventRecovered, eventChanged}, []bool{false, false, false, true}},
+		{"failing, then deleted", []watchPoll{{err: boom}, {err: gone}}, []string{eventFetchFailed, eventDeleted}, []bool{false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			st := &watchState{}
+			for i, p := range tt.polls {
+				p.alias = "db"
+				if changed := e.observe(st, p); changed != tt.changed[i] {
+					t.Fatalf("poll %d: changed = %v, want %v", i, changed, tt.changed[i])
+				}
+			}
+			var types []string
+			for _, ev := range got {
+				types = append(types, ev.Type)
+				if ev.Alias != "db" || ev.Provider != "aws" || ev.Time.IsZero() {
+					t.Fatalf("incomplete event %+v", ev)
+				}
+			}
+			if strings.Join(types, ",") != strings.Join(tt.events, ",") {
+				t.Fatalf("events = %v, want %v", types, tt.events)
+			}
+		})
+	}
+
+	got = nil
+	st := &watchState{}
+	e.observe(st, watchPoll{alias: "db", sum: v1})
+	e.observe(st, watchPoll{alias: "db", sum: v2})
+	if ev := got[0]; ev.OldVersion != e.version(v1) || ev.NewVersion != e.version(v2) || ev.OldVersion == ev.NewVersion {
+		t.Fatalf("unexpected versions in %+v", ev)
+	}
+}
+
+func TestEventNotifierWebhook(t *testing.T) {
+	var calls atomic.Int32
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		ts := r.Header.Get("X-Skv-Timestamp")
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write([]byte(ts + "."))
+		mac.Write(body)
+		sent, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil || time.Since(time.Unix(sent, 0)) > time.Minute ||
+			r.Header.Get("X-Skv-Signature") != "sha256="+hex.EncodeToString(mac.Sum(nil)) || r.Header.Get("X-Skv-Event") != eventChanged {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	var stream strings.Builder
+	n := &eventNotifier{
+		stream:        &stream,
+		webhooks:      []string{srv.URL},
+		webhookSecret: []byte("s3cret"),
+		retries:       2,
+		retryDelay:    10 * time.Millisecond,
+		client:        srv.Client(),
+		log:           io.Discard,
+	}
+	n.start(context.Background())
+	n.notify(watchEvent{Type: eventChanged, Alias: "db", Provider: "aws", OldVersion: "a", NewVersion: "b", Time: time.Now()})
+	n.close()
+
+	select {
+	case body := <-bodies:
+		var ev watchEvent
+		if err := json.Unmarshal(body, &ev); err != nil || ev.Alias != "db" || ev.NewVersion != "b" {
+			t.Fatalf("unexpected webhook body %s: %v", body, err)
+		}
+	default:
+		t.Fatalf("webhook not delivered after %d call(s)", calls.Load())
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("webhook called %d times, want 2", calls.Load())
+	}
+	var ev watchEvent
+	if err := json.Unmarshal([]byte(stream.String()), &ev); err != nil || ev.Type != eventChanged || ev.Schema != "skv.watch-event/v1" || !strings.HasSuffix(stream.String(), "}\n") {
+		t.Fatalf("unexpected stream %q: %v", stream.String(), err)
+	}
+}
+
+func TestEventNotifierStopsRetrying(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	var log strings.Builder
+	n := &eventNotifier{
+		webhooks:      []string{srv.URL},
+		webhookSecret: []byte("s3cret"),
+		retries:       5,
+		retryDelay:    time.Hour,
+		client:        srv.Client(),
+		log:           &log,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	n.start(ctx)
+	n.notify(watchEvent{Type: eventChanged, Alias: "db", Time: time.Now()})
+	for calls.Load() == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		n.close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close waited for the webhook backoff")
+	}
+	if calls.Load() != 1 || !strings.Contains(log.String(), "gave up after 1 attempt(s)") {
+		t.Errorf("calls = %d, log = %q", calls.Load(), log.String())
+	}
+}
+
+func TestEventNotifierDeliversAfterShutdown(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { calls.Add(1) }))
+	defer srv.Close()
+
+	var log strings.Builder
+	n := &eventNotifier{
+		webhooks:      []string{srv.URL},
+		webhookSecret: []byte("s3cret"),
+		retries:       2,
+		retryDelay:    time.Hour,
+		client:        srv.Client(),
+		log:           &log,
+	}
+	// Events of the last round are queued after SIGINT/SIGTERM.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	n.start(ctx)
+	n.notify(watchEvent{Type: eventDeleted, Alias: "db", Time: time.Now()})
+	n.close()
+	if calls.Load() != 1 || log.Len() != 0 {
+		t.Fatalf("calls = %d, log = %q; want one delivery", calls.Load(), log.String())
+	}
+}
+
+func TestEventNotifierHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	out := filepath.Join(t.TempDir(), "hook")
+	n := &eventNotifier{hooks: []string{`echo "$SKV_EVENT $SKV_ALIAS $SKV_OLD_VERSION>$SKV_NEW_VERSION" >> ` + out}, log: io.Discard}
+	n.start(context.Background())
+	n.notify(watchEvent{Type: eventChanged, Alias: "db", OldVersion: "a", NewVersion: "b", Time: time.Now()})
+	n.notify(watchEvent{Type: eventDeleted, Alias: "api", OldVersion: "c", Time: time.Now()})
+	n.close()
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "changed db a>b\ndeleted api c>\n"; string(data) != want {
+		t.Fatalf("hook output = %q, want %q", data, want)
+	}
+}
+
+func TestEventNotifierHookTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	out := filepath.Join(t.TempDir(), "hook")
+	var log strings.Builder
+	n := &eventNotifier{
+		hooks:       []string{`[ "$SKV_ALIAS" = hung ] && exec sleep 30; echo "$SKV_ALIAS" >> ` + out},
+		hookTimeout: 100 * time.Millisecond,
+		log:         &log,
+	}
+	n.start(context.Background())
+	n.notify(watchEvent{Type: eventChanged, Alias: "hung", Time: time.Now()})
+	n.notify(watchEvent{Type: eventChanged, Alias: "db", Time: time.Now()})
+	start := time.Now()
+	n.close()
+	if took := time.Since(start); took > 5*time.Second {
+		t.Fatalf("close took %v", took)
+	}
+	if data, _ := os.ReadFile(out); string(data) != "db\n" {
+		t.Fatalf("hook output = %q, want %q", data, "db\n")
+	}
+	assertStringContains(t, log.String(), []string{`hook "`, "killed: timed out after 100ms"})
+}
+
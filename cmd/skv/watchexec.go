@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"skv/internal/config"
+)
+
+// Failure policies for the command run by `skv watch`.
+const (
+	failureContinue = "continue"
+	failureRetry    = "retry"
+	failureExit     = "exit"
+)
+
+// watchKillDelay is how long a command that timed out or is stopped by
+// shutdown has to exit after the stop signal before it is killed.
+const watchKillDelay = 10 * time.Second
+
+// watchExecutor runs the command of `skv watch`, by default with the
+// current values of the watched secrets in its environment. Values are
+// fetched for each run and dropped when it ends.
+type watchExecutor struct {
+	cfg          *config.Config
+	aliases      []string
+	argv         []string // with shell, joined into one script
+	shell        bool
+	injectEnv    bool
+	timeout      time.Duration // per run; 0 means none
+	fetchTimeout time.Duration
+	breakers     *breakerSet
+	limits       *limiterSet
+	onFailure    string
+	retries      int
+	retryDelay   time.Duration
+	stdout       io.Writer
+	log          io.Writer
+}
+
+// run runs the command once and applies the failure policy. It returns an
+// error only when the policy is exit and the command failed.
+func (x *watchExecutor) run(ctx context.Context, changed []string) error {
+	delay := x.retryDelay
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		status, err := x.execute(ctx, changed)
+		took := time.Since(start).Round(time.Millisecond)
+		if err == nil {
+			_, _ = fmt.Fprintf(x.log, "Command exited with status %d in %v\n", status, took)
+			return nil
+		}
+		if errors.Is(err, errWatchStopped) {
+			_, _ = fmt.Fprintf(x.log, "Command stopped after %v: watch is shutting down\n", took)
+			return nil
+		}
+		_, _ = fmt.Fprintf(x.log, "ERROR: command failed after %v: %v\n", took, err)
+		switch {
+		case x.onFailure == failureExit:
+			return fmt.Errorf("command failed: %w", err)
+		case x.onFailure != failureRetry || attempt >= x.retries:
+			return nil
+		}
+		_, _ = fmt.Fprintf(x.log, "Retrying command in %v (%d/%d)...\n", delay, attempt+1, x.retries)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// errWatchStopped is returned by execute when the watch ends while the
+// command runs.
+var errWatchStopped = errors.New("stopped because the watch ended")
+
+// errTimedOut is returned by runGroup when the command outlived its timeout.
+var errTimedOut = errors.New("timed out")
+
+// execute runs the command once with SKV_CHANGED set to the changed aliases
+// and returns its exit status. A run is an error when the secrets cannot be
+// fetched, the command cannot be started, it exits non-zero or times out.
+// When ctx is done the command is stopped and errWatchStopped returned.
+func (x *watchExecutor) execute(ctx context.Context, changed []string) (int, error) {
+	env := os.Environ()
+	c := x.command()
+	if x.injectEnv {
+		var (
+			files *secretFiles
+			err   error
+		)
+		env, files, err = x.environ()
+		if err != nil {
+			return -1, err
+		}
+		defer func() { _ = files.cleanup() }()
+		c.ExtraFiles = files.extraFiles()
+	}
+	c.Env = append(env, "SKV_CHANGED="+strings.Join(changed, ","))
+	c.Stdout = x.stdout
+	c.Stderr = os.Stderr
+
+	return runGroup(ctx, c, x.timeout)
+}
+
+// runGroup runs c in its own process group, so that stopping it also stops
+// what it started, and returns its exit status. When timeout (0 means none)
+// passes or ctx is done first, the group is sent the stop signal and killed
+// if it has not exited after watchKillDelay; the error then says why.
+func runGroup(ctx context.Context, c *exec.Cmd, timeout time.Duration) (int, error) {
+	configureChild(c, true)
+	if err := c.Start(); err != nil {
+		return -1, err
+	}
+	done := make(chan error, 1)
+	go func() { done <- c.Wait() }()
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	var err error
+	select {
+	case err := <-done:
+		return c.ProcessState.ExitCode(), err
+	case <-expired:
+		err = fmt.Errorf("%w after %v", errTimedOut, timeout)
+	case <-ctx.Done():
+		err = errWatchStopped
+	}
+	_ = signalChild(c.Process, stopSignal, true)
+	select {
+	case <-done:
+	case <-time.After(watchKillDelay):
+		_ = killChild(c.Process, true)
+		<-done
+	}
+	return c.ProcessState.ExitCode(), err
+}
+
+// command builds the command: argv as given, or joined and run by the
+// shell.
+func (x *watchExecutor) command() *exec.Cmd {
+	if x.shell {
+		return shellCommand(strings.Join(x.argv, " "))
+	}
+	// #nosec G204 - the command is intentionally user-provided
+	return exec.Command(x.argv[0], x.argv[1:]...)
+}
+
+// environ fetches the watched secrets and builds the environment the way
+// `skv run` does: secrets override inherited variables and those configured
+// with file: are delivered as files.
+func (x *watchExecutor) environ() ([]string, *secretFiles, error) {
+	ctx := context.Background()
+	if x.fetchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, x.fetchTimeout)
+		defer cancel()
+	}
+	resolver := newSecretResolver(x.cfg, 4, 0, 0)
+	resolver.breakers, resolver.limits = x.breakers, x.limits
+	values, errs := resolver.resolveAll(ctx, x.aliases)
+	if err := firstResolveError(x.aliases, errs); err != nil {
+		return nil, nil, fmt.Errorf("fetch secrets for the command: %w", err)
+	}
+	inj := newInjection(x.cfg, resolver, x.aliases, values, errs, nil)
+	plan, err := newEnvPlan(os.Environ(), inj.names(), false, nil, conflictOverride)
+	if err != nil {
+		return nil, nil, err
+	}
+	files, err := newSecretFiles(fileStoreAuto)
+	if err != nil {
+		return nil, nil, err
+	}
+	env, err := inj.environ(plan, files)
+	if err != nil {
+		_ = files.cleanup()
+		return nil, nil, err
+	}
+	return env, files, nil
+}
+
+// parseFailurePolicy checks an --on-failure value.
+func parseFailurePolicy(s string) error {
+	switch s {
+	case failureContinue, failureRetry, failureExit:
+		return nil
+	}
+	return errors.New(`invalid --on-failure "` + s + `" (use continue, retry or exit)`)
+}
+
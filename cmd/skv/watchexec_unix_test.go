@@ -0,0 +1,148 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"skv/internal/config"
+)
+
+func newTestExecutor(t *testing.T, argv ...string) *watchExecutor {
+	t.Helper()
+	_ = newRootCmd()
+	registerMock("mock")
+	cfgPath = writeTestConfig(t, "secrets:\n  - alias: token\n    provider: mock\n    name: t\n    env: TOKEN\n    extras:\n      value: s3cret\n")
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &watchExecutor{
+		cfg:        cfg,
+		aliases:    []string{"token"},
+		argv:       argv,
+		injectEnv:  true,
+		breakers:   newBreakerSet(3, 30*time.Second),
+		onFailure:  failureContinue,
+		retryDelay: time.Millisecond,
+		stdout:     &strings.Builder{},
+		log:        io.Discard,
+	}
+}
+
+func TestWatchExecutorExecute(t *testing.T) {
+	tests := []struct {
+		name      string
+		argv      []string
+		shell     bool
+		noInject  bool
+		timeout   time.Duration
+		want      string
+		status    int
+		wantError string
+	}{
+		{name: "argv is preserved", argv: []string{"printf", "%s|", "a b", "c"}, want: "a b|c|"},
+		{name: "shell mode", argv: []string{`echo "$TOKEN" | tr a-z A-Z`}, shell: true, want: "S3CRET\n"},
+		{name: "secrets and changed aliases in env", argv: []string{"sh", "-c", `echo "$TOKEN $SKV_CHANGED"`}, want: "s3cret token\n"},
+		{name: "without env injection", argv: []string{"sh", "-c", `echo "[$TOKEN]"`}, noInject: true, want: "[]\n"},
+		{name: "exit status", argv: []string{"sh", "-c", "exit 3"}, status: 3, wantError: "exit status 3"},
+		{name: "timeout", argv: []string{"sleep", "5"}, timeout: 100 * time.Millisecond, status: -1, wantError: "timed out after 100ms"},
+		{name: "missing command", argv: []string{"/nonexistent/skv-command"}, status: -1, wantError: "no such file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x := newTestExecutor(t, tt.argv...)
+			x.shell, x.injectEnv, x.timeout = tt.shell, !tt.noInject, tt.timeout
+			t.Setenv("TOKEN", "")
+			status, err := x.execute(context.Background(), []string{"token"})
+			if status != tt.status {
+				t.Fatalf("status = %d, want %d (err %v)", status, tt.status, err)
+			}
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("err = %v, want %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := x.stdout.(*strings.Builder).String(); got != tt.want {
+				t.Fatalf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchExecutorStopsWithWatch(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	// The background sleep is in the command's process group and must be
+	// stopped with it.
+	x := newTestExecutor(t, "sh", "-c", `sleep 30 & echo $! > "$0"; wait`, pidFile)
+	x.onFailure = failureExit
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for {
+			if data, err := os.ReadFile(pidFile); err == nil && strings.HasSuffix(string(data), "\n") {
+				cancel()
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	start := time.Now()
+	if err := x.run(ctx, nil); err != nil {
+		t.Fatalf("run() = %v, want nil when the watch ends", err)
+	}
+	if took := time.Since(start); took > 5*time.Second {
+		t.Fatalf("run() took %v", took)
+	}
+	data, _ := os.ReadFile(pidFile)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); syscall.Kill(pid, 0) == nil; time.Sleep(20 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			_ = syscall.Kill(pid, syscall.SIGKILL)
+			t.Fatal("background process of the command is still running")
+		}
+	}
+}
+
+func TestWatchExecutorFailurePolicy(t *testing.T) {
+	tests := []struct {
+		policy  string
+		runs    int
+		wantErr bool
+	}{
+		{failureContinue, 1, false},
+		{failureRetry, 3, false},
+		{failureExit, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			runs := filepath.Join(t.TempDir(), "runs")
+			x := newTestExecutor(t, "sh", "-c", `echo run >> "$0"; exit 1`, runs)
+			x.onFailure, x.retries = tt.policy, 2
+			err := x.run(context.Background(), nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("run() = %v, wantErr %v", err, tt.wantErr)
+			}
+			data, _ := os.ReadFile(runs)
+			if n := strings.Count(string(data), "run"); n != tt.runs {
+				t.Fatalf("command ran %d times, want %d", n, tt.runs)
+			}
+		})
+	}
+}
+
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Key sources for the on-disk cache.
+const (
+	CacheKeyAuto       = "auto"
+	CacheKeyKeyring    = "keyring"
+	CacheKeyPassphrase = "passphrase"
+)
+
+// DefaultCacheTTL is how long a cached value is served without asking the
+// provider when neither cache.ttl nor the secret's cache_ttl is set.
+const DefaultCacheTTL = time.Hour
+
+// CacheConfig holds settings for the encrypted on-disk cache of fetched
+// values. The cache is off unless Enabled is set.
+type CacheConfig struct {
+	Enabled  bool   `yaml:"enabled"`   // Cache fetched values on disk
+	Dir      string `yaml:"dir"`       // Cache directory (default: the user cache directory + /skv)
+	TTL      string `yaml:"ttl"`       // How long values are served from the cache (default 1h)
+	MaxStale string `yaml:"max_stale"` // Oldest value served when a provider fails (default: no limit)
+	Key      string `yaml:"key"`       // Encryption key source: auto|keyring|passphrase (default auto)
+}
+
+func (c CacheConfig) validate() error {
+	if c.TTL != "" {
+		if d, err := time.ParseDuration(c.TTL); err != nil || d < 0 {
+			return fmt.Errorf("cache.ttl: invalid duration %q", c.TTL)
+		}
+	}
+	if c.MaxStale != "" {
+		if d, err := time.ParseDuration(c.MaxStale); err != nil || d <= 0 {
+			return fmt.Errorf("cache.max_stale: invalid duration %q", c.MaxStale)
+		}
+	}
+	switch c.Key {
+	case "", CacheKeyAuto, CacheKeyKeyring, CacheKeyPassphrase:
+	default:
+		return fmt.Errorf("cache.key: unknown key source %q (use auto, keyring or passphrase)", c.Key)
+	}
+	return nil
+}
+
+// MaxStaleDuration returns cache.max_stale, or 0 when stale values are
+// served regardless of age.
+func (c CacheConfig) MaxStaleDuration() time.Duration {
+	d, _ := time.ParseDuration(c.MaxStale)
+	return d
+}
+
+// CacheTTL returns how long a cached value of s is fresh: its own
+// cache_ttl, else cache.ttl, else DefaultCacheTTL. A TTL of 0 means the
+// provider is always asked and the cache only serves when it fails.
+func (c *Config) CacheTTL(s *Secret) time.Duration {
+	for _, v := range []string{s.CacheTTL, c.Cache.TTL} {
+		if v == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return DefaultCacheTTL
+}
+
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCacheTTL(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "test-config.yaml")
+	t.Setenv("SKV_TEST_CACHE_DIR", "/tmp/skv-cache")
+	cfgText := `
+cache:
+  enabled: true
+  dir: "{{ SKV_TEST_CACHE_DIR }}"
+  ttl: 10m
+  max_stale: 24h
+secrets:
+  - alias: own
+    provider: aws
+    name: own
+    cache_ttl: 1m
+  - alias: never
+    provider: aws
+    name: never
+    cache_ttl: 0s
+  - alias: plain
+    provider: aws
+    name: plain
+`
+	if err := os.WriteFile(configFile, []byte(cfgText), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(configFile)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Cache.Dir != "/tmp/skv-cache" {
+		t.Errorf("Cache.Dir = %q, want interpolated /tmp/skv-cache", cfg.Cache.Dir)
+	}
+	if got := cfg.Cache.MaxStaleDuration(); got != 24*time.Hour {
+		t.Errorf("MaxStaleDuration() = %v, want 24h", got)
+	}
+	tests := []struct {
+		alias string
+		want  time.Duration
+	}{
+		{"own", time.Minute},
+		{"never", 0},
+		{"plain", 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		s, _ := cfg.FindByAlias(tt.alias)
+		if got := cfg.CacheTTL(s); got != tt.want {
+			t.Errorf("CacheTTL(%s) = %v, want %v", tt.alias, got, tt.want)
+		}
+	}
+	if got := (&Config{}).CacheTTL(&Secret{}); got != DefaultCacheTTL {
+		t.Errorf("CacheTTL() without settings = %v, want %v", got, DefaultCacheTTL)
+	}
+
+	invalid := []struct {
+		name, cfg, want string
+	}{
+		{"secret ttl", "secrets:\n  - alias: a\n    provider: aws\n    name: a\n    cache_ttl: -1m\n", "invalid cache_ttl"},
+		{"ttl", "cache:\n  ttl: later\nsecrets:\n  - alias: a\n    provider: aws\n    name: a\n", "cache.ttl"},
+		{"max stale", "cache:\n  max_stale: 0s\nsecrets:\n  - alias: a\n    provider: aws\n    name: a\n", "cache.max_stale"},
+		{"key source", "cache:\n  key: vault\nsecrets:\n  - alias: a\n    provider: aws\n    name: a\n", "cache.key"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(configFile, []byte(tt.cfg), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Load(configFile); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Load() = %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
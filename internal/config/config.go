@@ -2,12 +2,17 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"text/template"
+	"time"
 
 	"gopkg.in/yaml.v3"
 	"skv/internal/provider"
@@ -15,8 +20,15 @@ import (
 
 // Config is the top-level configuration.
 type Config struct {
-	Defaults Defaults `yaml:"defaults"` // Global default parameters
-	Secrets  []Secret `yaml:"secrets"`  // List of secrets to manage
+	Defaults Defaults            `yaml:"defaults"` // Global default parameters
+	Secrets  []Secret            `yaml:"secrets"`  // List of secrets to manage
+	Groups   map[string][]string `yaml:"groups"`   // Named sets of aliases, globs or selector expressions
+	Watch    WatchConfig         `yaml:"watch"`    // Settings for skv watch
+	Cache    CacheConfig         `yaml:"cache"`    // Encrypted on-disk cache of fetched values
+	Limits   LimitsConfig        `yaml:"limits"`   // Per-provider and per-backend limits and circuit breakers
+
+	Path   string `yaml:"-"` // Absolute path the configuration was loaded from
+	Digest string `yaml:"-"` // Hex SHA-256 of the configuration file
 }
 
 // Defaults holds global default parameters merged into each secret unless overridden.
@@ -25,31 +37,312 @@ type Defaults struct {
 	Address string            `yaml:"address"` // Default server address (e.g., Vault URL)
 	Token   string            `yaml:"token"`   // Default authentication token
 	Extras  map[string]string `yaml:"extras"`  // Provider-specific defaults
+	Refs    map[string]string `yaml:"-"`       // Extras key -> alias supplying its value (from {ref: alias})
 }
 
-// Transform represents a transformation to apply to a secret value.
-type Transform struct {
-	Type     string            `yaml:"type"`     // Transform type: "template", "mask", "prefix", "suffix"
-	Template string            `yaml:"template"` // Template string with {{ .value }} placeholder
-	Prefix   string            `yaml:"prefix"`   // Prefix to add
-	Suffix   string            `yaml:"suffix"`   // Suffix to add
-	Options  map[string]string `yaml:"options"`  // Additional transform options
+// CompositeProvider is the provider name used by secrets built from other secrets.
+const CompositeProvider = "composite"
+
+// Composite renders a secret value from the values of other secrets.
+type Composite struct {
+	Template string            `yaml:"template"` // text/template rendered with the inputs, e.g. {{ .user }}
+	Inputs   map[string]string `yaml:"inputs"`   // Template key -> alias of the secret supplying it
 }
 
 // Secret represents a single secret to fetch and where to place it.
 type Secret struct {
-	Alias     string            `yaml:"alias"`     // Human-readable identifier
-	Provider  string            `yaml:"provider"`  // Provider type (aws, gcp, etc.)
-	Name      string            `yaml:"name"`      // Provider-specific secret path/name
-	Env       string            `yaml:"env"`       // Environment variable name
-	Region    string            `yaml:"region"`    // Provider region (AWS, GCP zones, etc.)
-	Address   string            `yaml:"address"`   // Provider address (Vault URL, etc.)
-	Token     string            `yaml:"token"`     // Authentication token
-	Path      string            `yaml:"path"`      // Secret path (for Vault-like providers)
-	Version   *int              `yaml:"version"`   // Secret version (if supported)
-	Metadata  map[string]string `yaml:"metadata"`  // Additional metadata
-	Extras    map[string]string `yaml:"extras"`    // Provider-specific options
-	Transform *Transform        `yaml:"transform"` // Optional value transformation
+	Alias         string            `yaml:"alias"`          // Human-readable identifier
+	Provider      string            `yaml:"provider"`       // Provider type (aws, gcp, etc.)
+	Name          string            `yaml:"name"`           // Provider-specific secret path/name
+	Env           string            `yaml:"env"`            // Environment variable name
+	Region        string            `yaml:"region"`         // Provider region (AWS, GCP zones, etc.)
+	Address       string            `yaml:"address"`        // Provider address (Vault URL, etc.)
+	Token         string            `yaml:"token"`          // Authentication token
+	Path          string            `yaml:"path"`           // Secret path (for Vault-like providers)
+	Version       *int              `yaml:"version"`        // Secret version (if supported)
+	Tags          []string          `yaml:"tags"`           // Labels used by --tag and --select
+	Metadata      map[string]string `yaml:"metadata"`       // Additional metadata
+	Extras        map[string]string `yaml:"extras"`         // Provider-specific options
+	Transform     *Transform        `yaml:"transform"`      // Optional value transformation
+	Validation    *Validation       `yaml:"validate"`       // Rules the value must satisfy before use
+	Composite     *Composite        `yaml:"composite"`      // Optional value rendered from other secrets
+	Required      *bool             `yaml:"required"`       // Whether a missing value is an error (default true)
+	Default       *string           `yaml:"default"`        // Value used when every source fails
+	Fallback      *Source           `yaml:"fallback"`       // Alias or provider tried when the primary source fails
+	Sources       []Source          `yaml:"sources"`        // Ordered sources replacing the primary, tried in sequence
+	File          *File             `yaml:"file"`           // Deliver the value to `skv run` as a file instead of in the env var
+	WatchInterval string            `yaml:"watch_interval"` // How often `skv watch` polls this secret (e.g., 1m)
+	CacheTTL      string            `yaml:"cache_ttl"`      // How long a cached value is served without asking the provider
+	Refs          map[string]string `yaml:"-"`              // Extras key -> alias supplying its value (from {ref: alias})
+}
+
+// File asks `skv run` to write the value to a private file and set the env
+// var to its path. Written as "true" it uses the alias as the file name; a
+// string value sets the file name.
+type File struct {
+	Enabled bool   `yaml:"enabled"` // Whether file mode is on
+	Name    string `yaml:"name"`    // File name, e.g. "tls.crt"; defaults to the alias
+}
+
+// UnmarshalYAML accepts a boolean, a file name or a mapping.
+func (f *File) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		var enabled bool
+		if node.Tag == "!!bool" && node.Decode(&enabled) == nil {
+			f.Enabled = enabled
+			return nil
+		}
+		f.Enabled, f.Name = true, node.Value
+		return nil
+	}
+	type plain File
+	p := plain{Enabled: true}
+	if err := node.Decode(&p); err != nil {
+		return err
+	}
+	*f = File(p)
+	return nil
+}
+
+// AsFile reports whether the secret is delivered as a file by `skv run`.
+func (s Secret) AsFile() bool {
+	return s.File != nil && s.File.Enabled
+}
+
+// FileName returns the name of the file holding the value in file mode.
+func (s Secret) FileName() string {
+	if s.File != nil && s.File.Name != "" {
+		return s.File.Name
+	}
+	return s.Alias
+}
+
+// Source is an alternative location for a secret value. It either names
+// another alias or overrides parts of the owning secret's provider spec,
+// e.g. a replica region. Written as a plain string it names an alias.
+type Source struct {
+	Alias    string            `yaml:"alias"`    // Another secret supplying the value
+	Provider string            `yaml:"provider"` // Provider override
+	Name     string            `yaml:"name"`     // Name override
+	Region   string            `yaml:"region"`   // Region override
+	Address  string            `yaml:"address"`  // Address override
+	Extras   map[string]string `yaml:"extras"`   // Extras merged over the secret's extras
+	Timeout  string            `yaml:"timeout"`  // Per-attempt timeout (e.g., 2s); empty means none
+}
+
+// UnmarshalYAML accepts either an alias string or a mapping.
+func (src *Source) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		src.Alias = node.Value
+		return nil
+	}
+	type plain Source
+	return node.Decode((*plain)(src))
+}
+
+// Apply returns spec with the source overrides applied. It is not meaningful
+// for alias sources.
+func (src Source) Apply(spec provider.SecretSpec) provider.SecretSpec {
+	extras := make(map[string]string, len(spec.Extras)+len(src.Extras)+2)
+	for k, v := range spec.Extras {
+		extras[k] = v
+	}
+	if src.Provider != "" {
+		spec.Provider = src.Provider
+	}
+	if src.Name != "" {
+		spec.Name = src.Name
+	}
+	if src.Region != "" {
+		extras["region"] = src.Region
+	}
+	if src.Address != "" {
+		extras["address"] = src.Address
+	}
+	for k, v := range src.Extras {
+		extras[k] = v
+	}
+	spec.Extras = extras
+	return spec
+}
+
+// String describes the source for logs and reports without exposing values.
+func (src Source) String() string {
+	if src.Alias != "" {
+		return "alias " + src.Alias
+	}
+	parts := []string{}
+	if src.Provider != "" {
+		parts = append(parts, src.Provider)
+	}
+	if src.Name != "" {
+		parts = append(parts, src.Name)
+	}
+	if src.Region != "" {
+		parts = append(parts, src.Region)
+	}
+	if src.Address != "" {
+		parts = append(parts, src.Address)
+	}
+	if len(parts) == 0 {
+		return "override"
+	}
+	return strings.Join(parts, " ")
+}
+
+func (src *Source) interpolate() {
+	src.Alias = interpolateEnv(src.Alias)
+	src.Provider = interpolateEnv(src.Provider)
+	src.Name = interpolateEnv(src.Name)
+	src.Region = interpolateEnv(src.Region)
+	src.Address = interpolateEnv(src.Address)
+	for k, v := range src.Extras {
+		src.Extras[k] = interpolateEnv(v)
+	}
+}
+
+// TimeoutDuration returns the parsed per-attempt timeout, or 0 when unset.
+func (src Source) TimeoutDuration() time.Duration {
+	d, _ := time.ParseDuration(src.Timeout)
+	return d
+}
+
+func (src Source) validate(alias string) error {
+	if src.Timeout != "" {
+		if d, err := time.ParseDuration(src.Timeout); err != nil || d < 0 {
+			return fmt.Errorf("alias %s: invalid source timeout %q", alias, src.Timeout)
+		}
+	}
+	if src.Alias != "" {
+		if src.Provider != "" || src.Name != "" || src.Region != "" || src.Address != "" || len(src.Extras) > 0 {
+			return fmt.Errorf("alias %s: a source cannot set both alias and provider fields", alias)
+		}
+		return nil
+	}
+	if src.Provider == "" && src.Name == "" && src.Region == "" && src.Address == "" && len(src.Extras) == 0 {
+		return fmt.Errorf("alias %s: source is empty", alias)
+	}
+	if containsMissingEnvToken(src.Provider, src.Name, src.Region, src.Address) {
+		return fmt.Errorf("missing environment variable in source configuration for alias %s", alias)
+	}
+	return nil
+}
+
+// Providers returns the sorted provider names this secret fetches from
+// directly: its own provider and those of inline sources and fallback.
+// Composite secrets and alias sources contribute nothing.
+func (s Secret) Providers() []string {
+	if s.IsComposite() {
+		return nil
+	}
+	seen := map[string]struct{}{}
+	base := s.ToSpec()
+	if len(s.Sources) == 0 && s.Provider != "" {
+		seen[s.Provider] = struct{}{}
+	}
+	srcs := append([]Source{}, s.Sources...)
+	if s.Fallback != nil {
+		srcs = append(srcs, *s.Fallback)
+	}
+	for _, src := range srcs {
+		if src.Alias != "" {
+			continue
+		}
+		if p := src.Apply(base).Provider; p != "" {
+			seen[p] = struct{}{}
+		}
+	}
+	out := make([]string, 0, len(seen))
+	for p := range seen {
+		out = append(out, p)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// IsRequired reports whether a missing value for this secret is an error.
+func (s Secret) IsRequired() bool {
+	return s.Required == nil || *s.Required
+}
+
+// UnmarshalYAML decodes a secret, accepting {ref: alias} in place of the
+// token or any extras value.
+func (s *Secret) UnmarshalYAML(node *yaml.Node) error {
+	refs, err := extractRefs(node)
+	if err != nil {
+		return err
+	}
+	type plain Secret
+	if err := node.Decode((*plain)(s)); err != nil {
+		return err
+	}
+	s.Refs = refs
+	return nil
+}
+
+// UnmarshalYAML decodes defaults, accepting {ref: alias} in place of the
+// token or any extras value.
+func (d *Defaults) UnmarshalYAML(node *yaml.Node) error {
+	refs, err := extractRefs(node)
+	if err != nil {
+		return err
+	}
+	type plain Defaults
+	if err := node.Decode((*plain)(d)); err != nil {
+		return err
+	}
+	d.Refs = refs
+	return nil
+}
+
+// extractRefs collects {ref: alias} values from the token field and the
+// extras map of a mapping node, replacing them with empty scalars so the
+// regular decoding into string fields succeeds. Keys are the extras keys
+// the values end up under in a provider.SecretSpec.
+func extractRefs(node *yaml.Node) (map[string]string, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	var refs map[string]string
+	take := func(key string, val *yaml.Node) error {
+		if val.Kind != yaml.MappingNode {
+			return nil
+		}
+		var r struct {
+			Ref string `yaml:"ref"`
+		}
+		if err := val.Decode(&r); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		if strings.TrimSpace(r.Ref) == "" {
+			return fmt.Errorf("%s: expected a string or {ref: alias}", key)
+		}
+		if refs == nil {
+			refs = map[string]string{}
+		}
+		refs[key] = strings.TrimSpace(r.Ref)
+		*val = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: ""}
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, val := node.Content[i].Value, node.Content[i+1]
+		switch key {
+		case "token":
+			if err := take(key, val); err != nil {
+				return nil, err
+			}
+		case "extras":
+			if val.Kind != yaml.MappingNode {
+				continue
+			}
+			for j := 0; j+1 < len(val.Content); j += 2 {
+				if err := take(val.Content[j].Value, val.Content[j+1]); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return refs, nil
 }
 
 // Load reads the configuration from file, applying env interpolation and validation.
@@ -69,6 +362,11 @@ func Load(overridePath string) (*Config, error) {
 	if err := yaml.Unmarshal(b, &cfg); err != nil {
 		return nil, fmt.Errorf("parse config: %w", err)
 	}
+	if cfg.Path, err = filepath.Abs(path); err != nil {
+		cfg.Path = path
+	}
+	sum := sha256.Sum256(b)
+	cfg.Digest = hex.EncodeToString(sum[:])
 
 	// Interpolate environment variables in defaults
 	cfg.Defaults.Region = interpolateEnv(cfg.Defaults.Region)
@@ -80,6 +378,8 @@ func Load(overridePath string) (*Config, error) {
 		}
 	}
 
+	cfg.Cache.Dir = interpolateEnv(cfg.Cache.Dir)
+
 	// Interpolate environment variables in all string fields.
 	for i := range cfg.Secrets {
 		s := &cfg.Secrets[i]
@@ -91,6 +391,15 @@ func Load(overridePath string) (*Config, error) {
 		s.Address = interpolateEnv(s.Address)
 		s.Token = interpolateEnv(s.Token)
 		s.Path = interpolateEnv(s.Path)
+		if s.Composite != nil && s.Provider == "" {
+			s.Provider = CompositeProvider
+		}
+		if s.Fallback != nil {
+			s.Fallback.interpolate()
+		}
+		for j := range s.Sources {
+			s.Sources[j].interpolate()
+		}
 		// Metadata values
 		if s.Metadata != nil {
 			for k, v := range s.Metadata {
@@ -105,6 +414,8 @@ func Load(overridePath string) (*Config, error) {
 		}
 	}
 
+	cfg.mergeDefaultRefs()
+
 	// After interpolation, merge defaults into secrets
 	for i := range cfg.Secrets {
 		s := &cfg.Secrets[i]
@@ -114,7 +425,7 @@ func Load(overridePath string) (*Config, error) {
 		if s.Address == "" && cfg.Defaults.Address != "" {
 			s.Address = cfg.Defaults.Address
 		}
-		if s.Token == "" && cfg.Defaults.Token != "" {
+		if s.Token == "" && cfg.Defaults.Token != "" && s.Refs["token"] == "" {
 			s.Token = cfg.Defaults.Token
 		}
 		if cfg.Defaults.Extras != nil {
@@ -123,7 +434,9 @@ func Load(overridePath string) (*Config, error) {
 			}
 			for k, v := range cfg.Defaults.Extras {
 				if _, exists := s.Extras[k]; !exists {
-					s.Extras[k] = v
+					if _, isRef := s.Refs[k]; !isRef {
+						s.Extras[k] = v
+					}
 				}
 			}
 		}
@@ -135,6 +448,55 @@ func Load(overridePath string) (*Config, error) {
 	return &cfg, nil
 }
 
+// mergeDefaultRefs copies references from defaults into secrets that do not
+// set the field themselves. A default reference is not inherited by the
+// secret it points to, nor by anything that secret depends on, since that
+// would make the credential depend on itself.
+func (c *Config) mergeDefaultRefs() {
+	if len(c.Defaults.Refs) == 0 {
+		return
+	}
+	excluded := map[string]map[string]struct{}{}
+	for key, target := range c.Defaults.Refs {
+		skip := map[string]struct{}{}
+		var walk func(alias string)
+		walk = func(alias string) {
+			if _, seen := skip[alias]; seen {
+				return
+			}
+			skip[alias] = struct{}{}
+			if s, ok := c.FindByAlias(alias); ok {
+				for _, dep := range s.Dependencies() {
+					walk(dep)
+				}
+			}
+		}
+		walk(target)
+		excluded[key] = skip
+	}
+	for i := range c.Secrets {
+		s := &c.Secrets[i]
+		for key, target := range c.Defaults.Refs {
+			if _, skip := excluded[key][s.Alias]; skip {
+				continue
+			}
+			if _, own := s.Refs[key]; own {
+				continue
+			}
+			if key == "token" && s.Token != "" {
+				continue
+			}
+			if _, set := s.Extras[key]; set {
+				continue
+			}
+			if s.Refs == nil {
+				s.Refs = map[string]string{}
+			}
+			s.Refs[key] = target
+		}
+	}
+}
+
 func locateConfigPath(overridePath string) string {
 	if overridePath != "" {
 		return overridePath
@@ -171,12 +533,50 @@ func (c *Config) validate() error {
 			return fmt.Errorf("duplicate alias: %s", s.Alias)
 		}
 		aliases[s.Alias] = struct{}{}
-		if s.Provider == "" {
+		if len(s.Sources) > 0 {
+			if err := s.validateSources(); err != nil {
+				return err
+			}
+		} else if s.Provider == "" {
 			return fmt.Errorf("provider is required for alias %s", s.Alias)
-		}
-		if s.Name == "" {
+		} else if s.IsComposite() {
+			if err := s.validateComposite(); err != nil {
+				return err
+			}
+		} else if s.Name == "" {
 			return fmt.Errorf("name is required for alias %s", s.Alias)
 		}
+		if s.Fallback != nil {
+			if err := s.Fallback.validate(s.Alias); err != nil {
+				return err
+			}
+			if s.IsComposite() && s.Fallback.Alias == "" {
+				return fmt.Errorf("alias %s: composite secrets can only fall back to another alias", s.Alias)
+			}
+		}
+		if s.Transform != nil {
+			if err := s.Transform.Validate(); err != nil {
+				return fmt.Errorf("alias %s: %w", s.Alias, err)
+			}
+		}
+		if s.Validation != nil {
+			if err := s.Validation.validate(); err != nil {
+				return fmt.Errorf("alias %s: %w", s.Alias, err)
+			}
+		}
+		if s.WatchInterval != "" {
+			if d, err := time.ParseDuration(s.WatchInterval); err != nil || d <= 0 {
+				return fmt.Errorf("alias %s: invalid watch_interval %q", s.Alias, s.WatchInterval)
+			}
+		}
+		if s.CacheTTL != "" {
+			if d, err := time.ParseDuration(s.CacheTTL); err != nil || d < 0 {
+				return fmt.Errorf("alias %s: invalid cache_ttl %q", s.Alias, s.CacheTTL)
+			}
+		}
+		if s.File != nil && s.File.Name != "" && (filepath.Base(s.File.Name) != s.File.Name || strings.HasPrefix(s.File.Name, ".")) {
+			return fmt.Errorf("alias %s: file name %q must be a plain file name", s.Alias, s.File.Name)
+		}
 		// Fail fast if interpolation left missing env tokens
 		if containsMissingEnvToken(s.Alias, s.Provider, s.Name, s.Env, s.Region, s.Address, s.Token, s.Path) {
 			return fmt.Errorf("missing environment variable in configuration for alias %s", s.Alias)
@@ -185,9 +585,144 @@ func (c *Config) validate() error {
 		// decoupled from runtime registrations. Unknown providers will be
 		// handled at command execution time.
 	}
+	for _, s := range c.Secrets {
+		for _, dep := range s.Dependencies() {
+			if _, ok := aliases[dep]; !ok {
+				return fmt.Errorf("alias %s depends on unknown alias %s", s.Alias, dep)
+			}
+		}
+	}
+	all := make([]string, 0, len(c.Secrets))
+	for _, s := range c.Secrets {
+		all = append(all, s.Alias)
+	}
+	if _, err := c.Expand(all); err != nil {
+		return err
+	}
+	if err := c.Watch.validate(); err != nil {
+		return err
+	}
+	if err := c.Cache.validate(); err != nil {
+		return err
+	}
+	if err := c.Limits.validate(); err != nil {
+		return err
+	}
+	return c.validateGroups()
+}
+
+func (s Secret) validateSources() error {
+	if s.IsComposite() {
+		return fmt.Errorf("alias %s: composite secrets cannot define sources", s.Alias)
+	}
+	base := s.ToSpec()
+	for i, src := range s.Sources {
+		if err := src.validate(s.Alias); err != nil {
+			return err
+		}
+		if src.Alias != "" {
+			continue
+		}
+		spec := src.Apply(base)
+		if spec.Provider == "" || spec.Name == "" {
+			return fmt.Errorf("alias %s: source %d needs a provider and name (set them on the secret or the source)", s.Alias, i+1)
+		}
+	}
 	return nil
 }
 
+func (s Secret) validateComposite() error {
+	if s.Provider != CompositeProvider {
+		return fmt.Errorf("alias %s: composite secrets must use provider %q", s.Alias, CompositeProvider)
+	}
+	if s.Composite == nil {
+		return fmt.Errorf("alias %s: provider %q requires a composite block", s.Alias, CompositeProvider)
+	}
+	if strings.TrimSpace(s.Composite.Template) == "" {
+		return fmt.Errorf("alias %s: composite.template is required", s.Alias)
+	}
+	if len(s.Composite.Inputs) == 0 {
+		return fmt.Errorf("alias %s: composite.inputs is empty", s.Alias)
+	}
+	if _, err := s.Composite.parse(s.Alias); err != nil {
+		return fmt.Errorf("alias %s: composite.template: %w", s.Alias, err)
+	}
+	return nil
+}
+
+// IsComposite reports whether the secret is rendered from other secrets
+// instead of being fetched from a provider.
+func (s Secret) IsComposite() bool {
+	return s.Composite != nil || s.Provider == CompositeProvider
+}
+
+// Dependencies returns the sorted, de-duplicated aliases this secret needs
+// to be resolved before its own value can be produced.
+func (s Secret) Dependencies() []string {
+	seen := map[string]struct{}{}
+	if s.Composite != nil {
+		for _, a := range s.Composite.Inputs {
+			seen[a] = struct{}{}
+		}
+	}
+	for _, a := range s.Refs {
+		seen[a] = struct{}{}
+	}
+	if s.Fallback != nil && s.Fallback.Alias != "" {
+		seen[s.Fallback.Alias] = struct{}{}
+	}
+	for _, src := range s.Sources {
+		if src.Alias != "" {
+			seen[src.Alias] = struct{}{}
+		}
+	}
+	deps := make([]string, 0, len(seen))
+	for a := range seen {
+		deps = append(deps, a)
+	}
+	sort.Strings(deps)
+	return deps
+}
+
+// Expand returns the given aliases together with all of their transitive
+// dependencies, ordered so that every alias appears after the aliases it
+// depends on. Unknown aliases are kept as-is so callers can report them.
+// An error is returned when the dependency graph contains a cycle.
+func (c *Config) Expand(aliases []string) ([]string, error) {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[string]int{}
+	var order []string
+	var visit func(alias string, path []string) error
+	visit = func(alias string, path []string) error {
+		switch state[alias] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("dependency cycle: %s", strings.Join(append(path, alias), " -> "))
+		}
+		state[alias] = visiting
+		if s, ok := c.FindByAlias(alias); ok {
+			for _, dep := range s.Dependencies() {
+				if err := visit(dep, append(path, alias)); err != nil {
+					return err
+				}
+			}
+		}
+		state[alias] = visited
+		order = append(order, alias)
+		return nil
+	}
+	for _, a := range aliases {
+		if err := visit(a, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
 // FindByAlias returns the secret with the given alias, or nil if not found.
 func (c *Config) FindByAlias(alias string) (*Secret, bool) {
 	for i := range c.Secrets {
@@ -301,45 +836,29 @@ func containsMissingEnvToken(values ...string) bool {
 	return false
 }
 
-// TransformValue applies the specified transformation to a secret value.
-func (s *Secret) TransformValue(value string) (string, error) {
-	if s.Transform == nil {
-		return value, nil
+// Render executes the composite template. values maps each input alias to its
+// resolved value; the template sees them under their input keys.
+func (c *Composite) Render(alias string, values map[string]string) (string, error) {
+	tpl, err := c.parse(alias)
+	if err != nil {
+		return "", err
 	}
-
-	switch s.Transform.Type {
-	case "template":
-		return s.applyTemplate(value)
-	case "mask":
-		return s.applyMask(value)
-	case "prefix":
-		return s.Transform.Prefix + value, nil
-	case "suffix":
-		return value + s.Transform.Suffix, nil
-	default:
-		return value, fmt.Errorf("unknown transform type: %s", s.Transform.Type)
+	data := make(map[string]string, len(c.Inputs))
+	for key, dep := range c.Inputs {
+		v, ok := values[dep]
+		if !ok {
+			return "", fmt.Errorf("composite input %s (%s) was not resolved", key, dep)
+		}
+		data[key] = v
 	}
-}
-
-func (s *Secret) applyTemplate(value string) (string, error) {
-	if s.Transform.Template == "" {
-		return value, nil
+	var b strings.Builder
+	if err := tpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("render composite: %w", err)
 	}
-
-	// Simple template replacement: replace {{ .value }} with the actual value
-	template := s.Transform.Template
-	result := strings.ReplaceAll(template, "{{ .value }}", value)
-	result = strings.ReplaceAll(result, "{{.value}}", value)
-
-	return result, nil
+	return b.String(), nil
 }
 
-func (s *Secret) applyMask(value string) (string, error) {
-	if len(value) <= 4 {
-		return strings.Repeat("*", len(value)), nil
-	}
-
-	// Show first 2 and last 2 characters
-	return value[:2] + strings.Repeat("*", len(value)-4) + value[len(value)-2:], nil
+func (c *Composite) parse(alias string) (*template.Template, error) {
+	return template.New(alias).Option("missingkey=error").Parse(c.Template)
 }
 
@@ -3,8 +3,10 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoad(t *testing.T) {
@@ -374,3 +376,447 @@ defaults:
 	})
 }
 
+func TestCompositeSecrets(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      string
+		errContains string
+	}{
+		{
+			name: "valid composite",
+			config: `
+secrets:
+  - alias: db_user
+    provider: mock
+    name: user
+  - alias: db_pass
+    provider: mock
+    name: pass
+  - alias: db_url
+    env: DATABASE_URL
+    composite:
+      template: "postgres://{{ .user }}:{{ .pass }}@localhost/db"
+      inputs:
+        user: db_user
+        pass: db_pass
+`,
+		},
+		{
+			name: "unknown input alias",
+			config: `
+secrets:
+  - alias: db_url
+    composite:
+      template: "{{ .user }}"
+      inputs:
+        user: missing
+`,
+			errContains: "depends on unknown alias missing",
+		},
+		{
+			name: "dependency cycle",
+			config: `
+secrets:
+  - alias: a
+    composite:
+      template: "{{ .b }}"
+      inputs:
+        b: b
+  - alias: b
+    composite:
+      template: "{{ .a }}"
+      inputs:
+        a: a
+`,
+			errContains: "dependency cycle",
+		},
+		{
+			name: "invalid template",
+			config: `
+secrets:
+  - alias: x
+    provider: mock
+    name: x
+  - alias: y
+    composite:
+      template: "{{ .x "
+      inputs:
+        x: x
+`,
+			errContains: "composite.template",
+		},
+		{
+			name: "composite provider without block",
+			config: `
+secrets:
+  - alias: y
+    provider: composite
+    name: y
+`,
+			errContains: "requires a composite block",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := filepath.Join(t.TempDir(), "test-config.yaml")
+			if err := os.WriteFile(configFile, []byte(tt.config), 0600); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := Load(configFile)
+			if tt.errContains == "" {
+				if err != nil {
+					t.Fatalf("Load() error = %v", err)
+				}
+				s, _ := cfg.FindByAlias("db_url")
+				if s.Provider != CompositeProvider {
+					t.Errorf("provider = %q, want %q", s.Provider, CompositeProvider)
+				}
+				order, err := cfg.Expand([]string{"db_url"})
+				if err != nil {
+					t.Fatalf("Expand() error = %v", err)
+				}
+				if want := []string{"db_pass", "db_user", "db_url"}; !reflect.DeepEqual(order, want) {
+					t.Errorf("Expand() = %v, want %v", order, want)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+				t.Fatalf("Load() error = %v, want it to contain %q", err, tt.errContains)
+			}
+		})
+	}
+}
+
+func TestCompositeRender(t *testing.T) {
+	c := &Composite{
+		Template: "{{ .user }}:{{ .pass }}",
+		Inputs:   map[string]string{"user": "db_user", "pass": "db_pass"},
+	}
+	got, err := c.Render("db_url", map[string]string{"db_user": "u", "db_pass": "p"})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if got != "u:p" {
+		t.Errorf("Render() = %q, want %q", got, "u:p")
+	}
+	if _, err := c.Render("db_url", map[string]string{"db_user": "u"}); err == nil {
+		t.Error("Render() expected error for unresolved input")
+	}
+}
+
+func TestSecretRefs(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "test-config.yaml")
+	cfgText := `
+defaults:
+  token: {ref: vault_token}
+secrets:
+  - alias: vault_token
+    provider: aws
+    name: ci/vault-token
+  - alias: approle_secret
+    provider: aws
+    name: ci/approle
+  - alias: app_db
+    provider: vault
+    name: kv/data/app/db
+    extras:
+      secret_id: {ref: approle_secret}
+      mount: kv
+  - alias: plain
+    provider: vault
+    name: kv/data/app/plain
+    token: literal
+`
+	if err := os.WriteFile(configFile, []byte(cfgText), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(configFile)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tok, _ := cfg.FindByAlias("vault_token")
+	if len(tok.Refs) != 0 {
+		t.Errorf("referenced secret must not inherit its own default ref: %v", tok.Refs)
+	}
+	db, _ := cfg.FindByAlias("app_db")
+	want := map[string]string{"token": "vault_token", "secret_id": "approle_secret"}
+	if !reflect.DeepEqual(db.Refs, want) {
+		t.Errorf("Refs = %v, want %v", db.Refs, want)
+	}
+	if db.Extras["mount"] != "kv" {
+		t.Errorf("plain extras lost: %v", db.Extras)
+	}
+	if got := db.Dependencies(); !reflect.DeepEqual(got, []string{"approle_secret", "vault_token"}) {
+		t.Errorf("Dependencies() = %v", got)
+	}
+	plain, _ := cfg.FindByAlias("plain")
+	if plain.Token != "literal" || len(plain.Refs) != 0 {
+		t.Errorf("explicit token should win over default ref: token=%q refs=%v", plain.Token, plain.Refs)
+	}
+}
+
+func TestSecretRefsInvalid(t *testing.T) {
+	tests := map[string]string{
+		"empty ref": `
+secrets:
+  - alias: a
+    provider: vault
+    name: x
+    token: {ref: ""}
+`,
+		"self ref": `
+secrets:
+  - alias: a
+    provider: vault
+    name: x
+    token: {ref: a}
+`,
+	}
+	for name, cfgText := range tests {
+		t.Run(name, func(t *testing.T) {
+			configFile := filepath.Join(t.TempDir(), "test-config.yaml")
+			if err := os.WriteFile(configFile, []byte(cfgText), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Load(configFile); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestFallbackAndDefaults(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "test-config.yaml")
+	cfgText := `
+secrets:
+  - alias: db_west
+    provider: aws
+    name: app/db
+    region: us-west-2
+  - alias: db
+    provider: aws
+    name: app/db
+    region: us-east-1
+    fallback: db_west
+  - alias: api
+    provider: aws
+    name: app/api
+    region: us-east-1
+    fallback:
+      region: us-west-2
+  - alias: flag
+    provider: appconfig
+    name: app:flag
+    required: false
+    default: "off"
+`
+	if err := os.WriteFile(configFile, []byte(cfgText), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(configFile)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	db, _ := cfg.FindByAlias("db")
+	if db.Fallback == nil || db.Fallback.Alias != "db_west" {
+		t.Fatalf("scalar fallback not parsed: %+v", db.Fallback)
+	}
+	if got := db.Dependencies(); !reflect.DeepEqual(got, []string{"db_west"}) {
+		t.Errorf("Dependencies() = %v", got)
+	}
+	api, _ := cfg.FindByAlias("api")
+	spec := api.Fallback.Apply(api.ToSpec())
+	if spec.Extras["region"] != "us-west-2" || spec.Name != "app/api" || spec.Provider != "aws" {
+		t.Errorf("Apply() = %+v", spec)
+	}
+	if api.ToSpec().Extras["region"] != "us-east-1" {
+		t.Errorf("Apply() must not modify the original spec")
+	}
+	flag, _ := cfg.FindByAlias("flag")
+	if flag.IsRequired() || flag.Default == nil || *flag.Default != "off" {
+		t.Errorf("required/default not parsed: %+v", flag)
+	}
+	if !db.IsRequired() {
+		t.Errorf("secrets are required by default")
+	}
+
+	bad := `
+secrets:
+  - alias: a
+    provider: aws
+    name: x
+    fallback:
+      alias: b
+      region: us-west-2
+  - alias: b
+    provider: aws
+    name: y
+`
+	if err := os.WriteFile(configFile, []byte(bad), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(configFile); err == nil || !strings.Contains(err.Error(), "both alias and provider") {
+		t.Fatalf("expected mixed source error, got %v", err)
+	}
+}
+
+func TestSources(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "test-config.yaml")
+	cfgText := `
+secrets:
+  - alias: db_dr
+    provider: vault
+    name: kv/data/db
+  - alias: db
+    name: app/db
+    sources:
+      - provider: aws
+        region: us-east-1
+        timeout: 2s
+      - provider: aws
+        region: us-west-2
+      - db_dr
+`
+	if err := os.WriteFile(configFile, []byte(cfgText), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(configFile)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	db, _ := cfg.FindByAlias("db")
+	if len(db.Sources) != 3 || db.Sources[2].Alias != "db_dr" {
+		t.Fatalf("sources not parsed: %+v", db.Sources)
+	}
+	if got := db.Sources[0].TimeoutDuration(); got != 2*time.Second {
+		t.Errorf("TimeoutDuration() = %v", got)
+	}
+	if got := db.Dependencies(); !reflect.DeepEqual(got, []string{"db_dr"}) {
+		t.Errorf("Dependencies() = %v", got)
+	}
+	if got := db.Providers(); !reflect.DeepEqual(got, []string{"aws"}) {
+		t.Errorf("Providers() = %v", got)
+	}
+
+	tests := []struct {
+		name    string
+		secret  string
+		wantErr string
+	}{
+		{
+			name:    "source without provider",
+			secret:  "name: x\n    sources:\n      - region: us-east-1",
+			wantErr: "needs a provider and name",
+		},
+		{
+			name:    "invalid timeout",
+			secret:  "provider: aws\n    name: x\n    sources:\n      - timeout: soon",
+			wantErr: "timeout",
+		},
+		{
+			name:    "composite with sources",
+			secret:  "composite:\n      template: x\n    sources:\n      - provider: aws",
+			wantErr: "cannot define sources",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := "secrets:\n  - alias: a\n    " + tt.secret + "\n"
+			if err := os.WriteFile(configFile, []byte(text), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Load(configFile); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestFileOption(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "test-config.yaml")
+	cfgText := `
+secrets:
+  - alias: a
+    provider: aws
+    name: a
+    file: true
+  - alias: b
+    provider: aws
+    name: b
+    file: {name: b.json}
+  - alias: c
+    provider: aws
+    name: c
+    file: false
+  - alias: d
+    provider: aws
+    name: d
+    file: tls.crt
+`
+	if err := os.WriteFile(configFile, []byte(cfgText), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(configFile)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	tests := []struct {
+		alias  string
+		asFile bool
+		name   string
+	}{
+		{"a", true, "a"},
+		{"b", true, "b.json"},
+		{"c", false, "c"},
+		{"d", true, "tls.crt"},
+	}
+	for _, tt := range tests {
+		s, _ := cfg.FindByAlias(tt.alias)
+		if s.AsFile() != tt.asFile || s.FileName() != tt.name {
+			t.Errorf("%s: AsFile() = %v, FileName() = %q", tt.alias, s.AsFile(), s.FileName())
+		}
+	}
+
+	bad := "secrets:\n  - alias: a\n    provider: aws\n    name: a\n    file: ../escape\n"
+	if err := os.WriteFile(configFile, []byte(bad), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(configFile); err == nil || !strings.Contains(err.Error(), "plain file name") {
+		t.Fatalf("expected file name error, got %v", err)
+	}
+}
+
+func TestLoadPathAndDigest(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "a.yaml")
+	other := filepath.Join(dir, "b.yaml")
+	cfgText := "secrets:\n  - alias: a\n    provider: aws\n    name: a\n"
+	for _, f := range []string{configFile, other} {
+		if err := os.WriteFile(f, []byte(cfgText), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, err := Load(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Load(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filepath.IsAbs(a.Path) || a.Path != configFile {
+		t.Errorf("Path = %q, want %q", a.Path, configFile)
+	}
+	if len(a.Digest) != 64 || a.Digest != b.Digest {
+		t.Errorf("digests of identical files differ: %q, %q", a.Digest, b.Digest)
+	}
+	if err := os.WriteFile(other, []byte(cfgText+"    region: eu-west-1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = Load(other); err != nil || b.Digest == a.Digest {
+		t.Errorf("digest did not change with the content: %v", err)
+	}
+}
+
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Circuit breaker defaults.
+const (
+	DefaultBreakerFailures = 3
+	DefaultBreakerCooldown = 30 * time.Second
+)
+
+// LimitsConfig caps how hard skv hits each backend.
+type LimitsConfig struct {
+	Providers map[string]Limit `yaml:"providers"`       // By provider name as written in secrets, e.g. aws-ssm
+	Backends  map[string]Limit `yaml:"backends"`        // By backend: provider plus region, address, etc., e.g. vault/https://vault:8200
+	Breaker   BreakerConfig    `yaml:"circuit_breaker"` // Fail fast after repeated errors
+}
+
+// Limit bounds the fetches sent to a provider or backend.
+type Limit struct {
+	Concurrency int     `yaml:"concurrency"` // Fetches in flight at once (0: no cap)
+	Rate        float64 `yaml:"rate"`        // Fetches per second, as a token bucket (0: unlimited)
+	Burst       int     `yaml:"burst"`       // Fetches allowed back to back before rate applies (default: rate, at least 1)
+}
+
+// BreakerConfig configures the per-backend circuit breakers.
+type BreakerConfig struct {
+	Failures int    `yaml:"failures"` // Consecutive failures that open the breaker (default 3)
+	Cooldown string `yaml:"cooldown"` // How long an open breaker fails fast before a trial (default 30s)
+}
+
+func (l LimitsConfig) validate() error {
+	for kind, limits := range map[string]map[string]Limit{"providers": l.Providers, "backends": l.Backends} {
+		for name, lim := range limits {
+			if lim.Concurrency < 0 || lim.Rate < 0 || lim.Burst < 0 {
+				return fmt.Errorf("limits.%s.%s: concurrency, rate and burst must not be negative", kind, name)
+			}
+		}
+	}
+	if l.Breaker.Failures < 0 {
+		return errors.New("limits.circuit_breaker.failures must not be negative")
+	}
+	if l.Breaker.Cooldown != "" {
+		if d, err := time.ParseDuration(l.Breaker.Cooldown); err != nil || d <= 0 {
+			return fmt.Errorf("limits.circuit_breaker.cooldown: invalid duration %q", l.Breaker.Cooldown)
+		}
+	}
+	return nil
+}
+
+// Threshold returns the consecutive failures that open a breaker.
+func (b BreakerConfig) Threshold() int {
+	if b.Failures > 0 {
+		return b.Failures
+	}
+	return DefaultBreakerFailures
+}
+
+// CooldownDuration returns how long an open breaker fails fast.
+func (b BreakerConfig) CooldownDuration() time.Duration {
+	if d, err := time.ParseDuration(b.Cooldown); err == nil && d > 0 {
+		return d
+	}
+	return DefaultBreakerCooldown
+}
+
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLimits(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "test-config.yaml")
+	cfgText := `
+limits:
+  providers:
+    aws-ssm:
+      concurrency: 4
+      rate: 10
+  backends:
+    vault/https://vault:8200:
+      rate: 2.5
+      burst: 5
+  circuit_breaker:
+    failures: 5
+    cooldown: 1m
+secrets:
+  - alias: a
+    provider: aws-ssm
+    name: a
+`
+	if err := os.WriteFile(configFile, []byte(cfgText), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(configFile)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := cfg.Limits.Providers["aws-ssm"]; got != (Limit{Concurrency: 4, Rate: 10}) {
+		t.Errorf("providers.aws-ssm = %+v", got)
+	}
+	if got := cfg.Limits.Backends["vault/https://vault:8200"]; got != (Limit{Rate: 2.5, Burst: 5}) {
+		t.Errorf("backends.vault = %+v", got)
+	}
+	if got := cfg.Limits.Breaker.Threshold(); got != 5 {
+		t.Errorf("Threshold() = %d, want 5", got)
+	}
+	if got := cfg.Limits.Breaker.CooldownDuration(); got != time.Minute {
+		t.Errorf("CooldownDuration() = %v, want 1m", got)
+	}
+	if got := (BreakerConfig{}).Threshold(); got != DefaultBreakerFailures {
+		t.Errorf("default Threshold() = %d, want %d", got, DefaultBreakerFailures)
+	}
+	if got := (BreakerConfig{}).CooldownDuration(); got != DefaultBreakerCooldown {
+		t.Errorf("default CooldownDuration() = %v, want %v", got, DefaultBreakerCooldown)
+	}
+
+	invalid := []struct {
+		name, cfg, want string
+	}{
+		{"negative rate", "limits:\n  providers:\n    aws:\n      rate: -1\nsecrets:\n  - alias: a\n    provider: aws\n    name: a\n", "limits.providers.aws"},
+		{"negative concurrency", "limits:\n  backends:\n    aws/eu-west-1:\n      concurrency: -2\nsecrets:\n  - alias: a\n    provider: aws\n    name: a\n", "limits.backends.aws/eu-west-1"},
+		{"negative failures", "limits:\n  circuit_breaker:\n    failures: -1\nsecrets:\n  - alias: a\n    provider: aws\n    name: a\n", "failures"},
+		{"cooldown", "limits:\n  circuit_breaker:\n    cooldown: soon\nsecrets:\n  - alias: a\n    provider: aws\n    name: a\n", "cooldown"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(configFile, []byte(tt.cfg), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Load(configFile); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Load() = %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// selectorTerm is a single condition of a selector expression.
+type selectorTerm struct {
+	negate bool
+	field  string // "alias", "tag", "group" or "provider"
+	value  string
+}
+
+// parseSelector parses a comma-separated selector expression such as
+// "tag=db,!tag=legacy". All terms must match (logical AND). A term without
+// a field is treated as an alias glob pattern.
+func parseSelector(expr string) ([]selectorTerm, error) {
+	var terms []selectorTerm
+	for _, raw := range strings.Split(expr, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		t := selectorTerm{field: "alias"}
+		if strings.HasPrefix(raw, "!") {
+			t.negate = true
+			raw = strings.TrimSpace(raw[1:])
+		}
+		if k, v, ok := strings.Cut(raw, "="); ok {
+			t.field = strings.ToLower(strings.TrimSpace(k))
+			t.value = strings.TrimSpace(v)
+		} else {
+			t.value = raw
+		}
+		switch t.field {
+		case "alias", "tag", "group", "provider":
+		default:
+			return nil, fmt.Errorf("invalid selector %q: unknown field %q (use alias, tag, group or provider)", expr, t.field)
+		}
+		if t.value == "" {
+			return nil, fmt.Errorf("invalid selector %q: empty value", expr)
+		}
+		if _, err := path.Match(t.value, ""); err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %w", expr, err)
+		}
+		terms = append(terms, t)
+	}
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("invalid selector %q: no terms", expr)
+	}
+	return terms, nil
+}
+
+// IsPattern reports whether an alias contains glob metacharacters.
+func IsPattern(alias string) bool {
+	return strings.ContainsAny(alias, "*?[")
+}
+
+// HasTag reports whether the secret carries the given tag.
+func (s Secret) HasTag(tag string) bool {
+	for _, t := range s.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Config) matchTerm(s Secret, t selectorTerm) bool {
+	var ok bool
+	switch t.field {
+	case "alias":
+		ok, _ = path.Match(t.value, s.Alias)
+	case "tag":
+		for _, tag := range s.Tags {
+			if m, _ := path.Match(t.value, tag); m {
+				ok = true
+				break
+			}
+		}
+	case "provider":
+		ok, _ = path.Match(t.value, s.Provider)
+	case "group":
+		ok = c.inGroup(s, t.value)
+	}
+	return ok != t.negate
+}
+
+// inGroup reports whether the secret matches any member of the named group.
+// Group members are selector expressions; they cannot reference other groups.
+func (c *Config) inGroup(s Secret, group string) bool {
+	for _, member := range c.Groups[group] {
+		terms, err := parseSelector(member)
+		if err != nil {
+			continue
+		}
+		if c.matchAll(s, terms) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Config) matchAll(s Secret, terms []selectorTerm) bool {
+	for _, t := range terms {
+		if !c.matchTerm(s, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// Select returns the aliases, in configuration order, matching at least one
+// of the selector expressions. Each expression is a comma-separated list of
+// terms that must all match:
+//
+//	tag=db           secrets tagged "db"
+//	!tag=legacy      secrets not tagged "legacy"
+//	group=api        secrets in the "api" group
+//	provider=aws     secrets using the aws provider
+//	db-*             aliases matching a glob (same as alias=db-*)
+func (c *Config) Select(exprs ...string) ([]string, error) {
+	parsed := make([][]selectorTerm, 0, len(exprs))
+	for _, e := range exprs {
+		terms, err := parseSelector(e)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range terms {
+			if t.field == "group" {
+				if _, ok := c.Groups[t.value]; !ok {
+					return nil, fmt.Errorf("unknown group: %s", t.value)
+				}
+			}
+		}
+		parsed = append(parsed, terms)
+	}
+	var out []string
+	for _, s := range c.Secrets {
+		for _, terms := range parsed {
+			if c.matchAll(s, terms) {
+				out = append(out, s.Alias)
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+func (c *Config) validateGroups() error {
+	for name, members := range c.Groups {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("group name is empty")
+		}
+		for _, m := range members {
+			terms, err := parseSelector(m)
+			if err != nil {
+				return fmt.Errorf("group %s: %w", name, err)
+			}
+			for _, t := range terms {
+				if t.field == "group" {
+					return fmt.Errorf("group %s: groups cannot reference other groups", name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSelect(t *testing.T) {
+	cfg := &Config{
+		Secrets: []Secret{
+			{Alias: "db-main", Provider: "aws", Tags: []string{"db", "backend"}},
+			{Alias: "db-legacy", Provider: "aws", Tags: []string{"db", "legacy"}},
+			{Alias: "api-key", Provider: "vault", Tags: []string{"backend"}},
+			{Alias: "flag", Provider: "azure-appconfig"},
+		},
+		Groups: map[string][]string{
+			"api": {"api-*", "tag=db,!tag=legacy"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		exprs   []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "tag", exprs: []string{"tag=db"}, want: []string{"db-main", "db-legacy"}},
+		{name: "tag and not tag", exprs: []string{"tag=db,!tag=legacy"}, want: []string{"db-main"}},
+		{name: "alias glob", exprs: []string{"db-*"}, want: []string{"db-main", "db-legacy"}},
+		{name: "provider", exprs: []string{"provider=vault"}, want: []string{"api-key"}},
+		{name: "group", exprs: []string{"group=api"}, want: []string{"db-main", "api-key"}},
+		{name: "union of expressions", exprs: []string{"flag", "provider=vault"}, want: []string{"api-key", "flag"}},
+		{name: "no match", exprs: []string{"tag=missing"}, want: nil},
+		{name: "unknown group", exprs: []string{"group=nope"}, wantErr: true},
+		{name: "unknown field", exprs: []string{"color=red"}, wantErr: true},
+		{name: "bad glob", exprs: []string{"db-["}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cfg.Select(tt.exprs...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Select() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Select() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateGroups(t *testing.T) {
+	cfg := &Config{Groups: map[string][]string{"a": {"group=b"}}}
+	if err := cfg.validateGroups(); err == nil {
+		t.Fatal("expected nested group reference to be rejected")
+	}
+	cfg = &Config{Groups: map[string][]string{"a": {"tag="}}}
+	if err := cfg.validateGroups(); err == nil {
+		t.Fatal("expected empty selector value to be rejected")
+	}
+}
+
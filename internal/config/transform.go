@@ -0,0 +1,426 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Transform represents a transformation to apply to a secret value. It is
+// either a single step (Type and its parameters) or, when written as a YAML
+// list, an ordered pipeline of Steps.
+type Transform struct {
+	Type     string            `yaml:"type"`     // Transform type, see transformTypes
+	Template string            `yaml:"template"` // text/template with {{ .value }} and helper functions
+	Prefix   string            `yaml:"prefix"`   // Prefix to add
+	Suffix   string            `yaml:"suffix"`   // Suffix to add
+	Options  map[string]string `yaml:"options"`  // Step parameters, e.g. pattern/replace for regex_replace
+	Steps    []Transform       `yaml:"-"`        // Pipeline steps, applied in order
+}
+
+// transformTypes lists the supported step types and the options they require.
+var transformTypes = map[string][]string{
+	"template":      nil,
+	"mask":          nil,
+	"prefix":        nil,
+	"suffix":        nil,
+	"base64_encode": nil,
+	"base64_decode": nil,
+	"hex_encode":    nil,
+	"hex_decode":    nil,
+	"trim":          nil,
+	"upper":         nil,
+	"lower":         nil,
+	"regex_replace": {"pattern"},
+	"json":          {"path"},
+	"urlencode":     nil,
+}
+
+// UnmarshalYAML accepts a single transform mapping or a list of steps. A step
+// may be a bare type name ("- trim") and keys other than the named fields are
+// collected into Options, so "- {type: json, path: .password}" works.
+func (t *Transform) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.SequenceNode:
+		t.Steps = make([]Transform, 0, len(node.Content))
+		for _, n := range node.Content {
+			var step Transform
+			if err := step.decodeStep(n); err != nil {
+				return err
+			}
+			t.Steps = append(t.Steps, step)
+		}
+		return nil
+	default:
+		return t.decodeStep(node)
+	}
+}
+
+func (t *Transform) decodeStep(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		t.Type = node.Value
+		return nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: transform must be a mapping, a type name or a list of steps", node.Line)
+	}
+	type plain Transform
+	if err := node.Decode((*plain)(t)); err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, val := node.Content[i].Value, node.Content[i+1]
+		switch key {
+		case "type", "template", "prefix", "suffix", "options":
+			continue
+		}
+		if val.Kind != yaml.ScalarNode {
+			return fmt.Errorf("line %d: transform option %s must be a scalar", val.Line, key)
+		}
+		if t.Options == nil {
+			t.Options = map[string]string{}
+		}
+		t.Options[key] = val.Value
+	}
+	return nil
+}
+
+// pipeline returns the steps to apply, treating a single transform as a
+// one-step pipeline.
+func (t *Transform) pipeline() []Transform {
+	if len(t.Steps) > 0 {
+		return t.Steps
+	}
+	return []Transform{*t}
+}
+
+// Validate checks every step without applying it: types, required options,
+// regular expressions and templates.
+func (t *Transform) Validate() error {
+	for i, step := range t.pipeline() {
+		if err := step.validateStep(); err != nil {
+			return t.stepError(i, step, err)
+		}
+	}
+	return nil
+}
+
+func (t *Transform) validateStep() error {
+	required, ok := transformTypes[t.Type]
+	if !ok {
+		return fmt.Errorf("unknown transform type: %s", t.Type)
+	}
+	for _, opt := range required {
+		if t.Options[opt] == "" {
+			return fmt.Errorf("option %q is required", opt)
+		}
+	}
+	switch t.Type {
+	case "regex_replace":
+		if _, err := regexp.Compile(t.Options["pattern"]); err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+	case "template":
+		if _, err := t.parseTemplate(); err != nil {
+			return err
+		}
+	case "base64_encode", "base64_decode":
+		if _, err := base64Encoding(t.Options["encoding"]); err != nil {
+			return err
+		}
+	case "json":
+		if _, err := splitJSONPath(t.Options["path"]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Apply runs the transform on value. Errors name the failing step; they never
+// include the value.
+func (t *Transform) Apply(value string) (string, error) {
+	var err error
+	for i, step := range t.pipeline() {
+		value, err = step.applyStep(value)
+		if err != nil {
+			return "", t.stepError(i, step, err)
+		}
+	}
+	return value, nil
+}
+
+// TransformError reports the transform step that failed. It never includes
+// the value.
+type TransformError struct {
+	Step int    // 1-based position in the pipeline; 0 for a single transform
+	Type string // step type, e.g. json
+	Err  error
+}
+
+func (e *TransformError) Error() string {
+	if e.Step == 0 {
+		return fmt.Sprintf("transform %s: %v", e.Type, e.Err)
+	}
+	return fmt.Sprintf("transform step %d (%s): %v", e.Step, e.Type, e.Err)
+}
+
+func (e *TransformError) Unwrap() error { return e.Err }
+
+func (t *Transform) stepError(i int, step Transform, err error) error {
+	if len(t.Steps) == 0 {
+		return &TransformError{Type: step.Type, Err: err}
+	}
+	return &TransformError{Step: i + 1, Type: step.Type, Err: err}
+}
+
+func (t *Transform) applyStep(value string) (string, error) {
+	switch t.Type {
+	case "template":
+		return t.applyTemplate(value)
+	case "mask":
+		return applyMask(value), nil
+	case "prefix":
+		return t.Prefix + value, nil
+	case "suffix":
+		return value + t.Suffix, nil
+	case "base64_encode":
+		enc, err := base64Encoding(t.Options["encoding"])
+		if err != nil {
+			return "", err
+		}
+		return enc.EncodeToString([]byte(value)), nil
+	case "base64_decode":
+		enc, err := base64Encoding(t.Options["encoding"])
+		if err != nil {
+			return "", err
+		}
+		b, err := enc.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return "", fmt.Errorf("invalid base64 input")
+		}
+		return string(b), nil
+	case "hex_encode":
+		return hex.EncodeToString([]byte(value)), nil
+	case "hex_decode":
+		b, err := hex.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return "", fmt.Errorf("invalid hex input")
+		}
+		return string(b), nil
+	case "trim":
+		if cutset, ok := t.Options["cutset"]; ok {
+			return strings.Trim(value, cutset), nil
+		}
+		return strings.TrimSpace(value), nil
+	case "upper":
+		return strings.ToUpper(value), nil
+	case "lower":
+		return strings.ToLower(value), nil
+	case "regex_replace":
+		re, err := regexp.Compile(t.Options["pattern"])
+		if err != nil {
+			return "", fmt.Errorf("invalid pattern: %w", err)
+		}
+		return re.ReplaceAllString(value, t.Options["replace"]), nil
+	case "json":
+		return jsonExtract(value, t.Options["path"])
+	case "urlencode":
+		if t.Options["mode"] == "path" {
+			return url.PathEscape(value), nil
+		}
+		return url.QueryEscape(value), nil
+	default:
+		return "", fmt.Errorf("unknown transform type: %s", t.Type)
+	}
+}
+
+func (t *Transform) parseTemplate() (*template.Template, error) {
+	tpl, err := template.New("transform").Funcs(transformFuncs).Option("missingkey=error").Parse(t.Template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return tpl, nil
+}
+
+func (t *Transform) applyTemplate(value string) (string, error) {
+	if t.Template == "" {
+		return value, nil
+	}
+	tpl, err := t.parseTemplate()
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tpl.Execute(&b, map[string]string{"value": value}); err != nil {
+		return "", fmt.Errorf("template execution failed: %w", err)
+	}
+	return b.String(), nil
+}
+
+// transformFuncs are the helpers available to template steps.
+var transformFuncs = template.FuncMap{
+	"b64enc": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"b64dec": func(s string) (string, error) {
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+		if err != nil {
+			return "", fmt.Errorf("invalid base64 input")
+		}
+		return string(b), nil
+	},
+	"hexenc": func(s string) string { return hex.EncodeToString([]byte(s)) },
+	"hexdec": func(s string) (string, error) {
+		b, err := hex.DecodeString(strings.TrimSpace(s))
+		if err != nil {
+			return "", fmt.Errorf("invalid hex input")
+		}
+		return string(b), nil
+	},
+	"sha256": func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	},
+	"trim":       strings.TrimSpace,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"regexReplace": func(pattern, repl, s string) (string, error) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return "", err
+		}
+		return re.ReplaceAllString(s, repl), nil
+	},
+	"split":     func(sep, s string) []string { return strings.Split(s, sep) },
+	"join":      func(sep string, parts []string) string { return strings.Join(parts, sep) },
+	"json":      func(path, s string) (string, error) { return jsonExtract(s, path) },
+	"urlencode": url.QueryEscape,
+	"quote":     strconv.Quote,
+	"default": func(def, s string) string {
+		if s == "" {
+			return def
+		}
+		return s
+	},
+}
+
+func base64Encoding(name string) (*base64.Encoding, error) {
+	switch name {
+	case "", "std":
+		return base64.StdEncoding, nil
+	case "url":
+		return base64.URLEncoding, nil
+	case "raw":
+		return base64.RawStdEncoding, nil
+	case "raw_url":
+		return base64.RawURLEncoding, nil
+	default:
+		return nil, fmt.Errorf("unknown base64 encoding %q (use std, url, raw or raw_url)", name)
+	}
+}
+
+// splitJSONPath splits a path such as ".data.items[0].key" or "data.items.0.key"
+// into its segments.
+func splitJSONPath(path string) ([]string, error) {
+	p := strings.TrimPrefix(strings.TrimSpace(path), ".")
+	p = strings.ReplaceAll(p, "[", ".")
+	p = strings.ReplaceAll(p, "]", "")
+	if p == "" {
+		return nil, fmt.Errorf("empty JSON path")
+	}
+	parts := strings.Split(p, ".")
+	for _, part := range parts {
+		if part == "" {
+			return nil, fmt.Errorf("invalid JSON path %q", path)
+		}
+	}
+	return parts, nil
+}
+
+// jsonExtract returns the value at path in the JSON document s. Strings are
+// returned as-is; other values are returned as JSON.
+func jsonExtract(s, path string) (string, error) {
+	parts, err := splitJSONPath(path)
+	if err != nil {
+		return "", err
+	}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var cur any
+	if err := dec.Decode(&cur); err != nil {
+		return "", fmt.Errorf("input is not valid JSON")
+	}
+	for i, part := range parts {
+		switch v := cur.(type) {
+		case map[string]any:
+			next, ok := v[part]
+			if !ok {
+				return "", fmt.Errorf("JSON path %s: key %q not found", path, part)
+			}
+			cur = next
+		case []any:
+			idx, err := strconv.Atoi(part)
+			if err != nil || idx < 0 || idx >= len(v) {
+				return "", fmt.Errorf("JSON path %s: index %q out of range", path, part)
+			}
+			cur = v[idx]
+		default:
+			return "", fmt.Errorf("JSON path %s: %q is not an object or array", path, strings.Join(parts[:i], "."))
+		}
+	}
+	if str, ok := cur.(string); ok {
+		return str, nil
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(cur); err != nil {
+		return "", fmt.Errorf("encode JSON value: %w", err)
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// JSONValue returns the value at path in the JSON document s, as used by
+// the json transform.
+func JSONValue(s, path string) (string, error) {
+	return jsonExtract(s, path)
+}
+
+// TemplateFuncs returns a copy of the helpers available to template
+// transforms, for other templates that should offer the same functions.
+func TemplateFuncs() template.FuncMap {
+	funcs := make(template.FuncMap, len(transformFuncs))
+	for k, v := range transformFuncs {
+		funcs[k] = v
+	}
+	return funcs
+}
+
+// TransformValue applies the secret's transform, if any, to a value.
+func (s *Secret) TransformValue(value string) (string, error) {
+	if s.Transform == nil {
+		return value, nil
+	}
+	return s.Transform.Apply(value)
+}
+
+func applyMask(value string) string {
+	if len(value) <= 4 {
+		return strings.Repeat("*", len(value))
+	}
+
+	// Show first 2 and last 2 characters
+	return value[:2] + strings.Repeat("*", len(value)-4) + value[len(value)-2:]
+}
+
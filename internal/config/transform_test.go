@@ -0,0 +1,161 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestTransformPipeline(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		input   string
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "single mapping still works",
+			yaml:  "type: template\ntemplate: \"pre_{{ .value }}\"",
+			input: "x",
+			want:  "pre_x",
+		},
+		{
+			name:  "decode json and extract",
+			yaml:  "- base64_decode\n- type: json\n  path: .db.password\n- trim",
+			input: "eyJkYiI6eyJwYXNzd29yZCI6IiBzM2NyZXQgIn19",
+			want:  "s3cret",
+		},
+		{
+			name:  "json array index and non-string value",
+			yaml:  "- {type: json, path: \"hosts[1].port\"}",
+			input: `{"hosts":[{"port":1},{"port":5432}]}`,
+			want:  "5432",
+		},
+		{
+			name:  "regex replace then upper",
+			yaml:  "- type: regex_replace\n  pattern: \"^v(\\\\d+)$\"\n  replace: \"version-$1\"\n- upper",
+			input: "v12",
+			want:  "VERSION-12",
+		},
+		{
+			name:  "hex round trip and lower",
+			yaml:  "- hex_encode\n- hex_decode\n- lower",
+			input: "ABC",
+			want:  "abc",
+		},
+		{
+			name:  "options block and url encoding",
+			yaml:  "- type: base64_encode\n  options:\n    encoding: raw_url\n- urlencode",
+			input: "a?b",
+			want:  "YT9i",
+		},
+		{
+			name:  "trim cutset",
+			yaml:  "- {type: trim, cutset: \"\\\"\"}",
+			input: `"quoted"`,
+			want:  "quoted",
+		},
+		{
+			name:  "template helpers",
+			yaml:  "- type: template\n  template: '{{ .value | json \"user\" | upper }}:{{ .value | json \"pass\" | b64enc }}'",
+			input: `{"user":"app","pass":"pw"}`,
+			want:  "APP:cHc=",
+		},
+		{
+			name:    "error names failing step",
+			yaml:    "- trim\n- base64_decode",
+			input:   "not base64!",
+			wantErr: "transform step 2 (base64_decode): invalid base64 input",
+		},
+		{
+			name:    "missing json key",
+			yaml:    "- {type: json, path: missing}",
+			input:   `{"a":1}`,
+			wantErr: `step 1 (json): JSON path missing: key "missing" not found`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tr Transform
+			if err := yaml.Unmarshal([]byte(tt.yaml), &tr); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if err := tr.Validate(); err != nil {
+				t.Fatalf("Validate() = %v", err)
+			}
+			got, err := tr.Apply(tt.input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Apply() error = %v, want %q", err, tt.wantErr)
+				}
+				if strings.Contains(err.Error(), tt.input) {
+					t.Errorf("error must not contain the value: %v", err)
+				}
+				var terr *TransformError
+				if !errors.As(err, &terr) || terr.Step == 0 {
+					t.Errorf("error is not a TransformError with its step: %#v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Apply() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransformValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{"unknown step", "- trim\n- rot13", "transform step 2 (rot13): unknown transform type"},
+		{"missing required option", "- type: regex_replace", `step 1 (regex_replace): option "pattern" is required`},
+		{"bad regex", "- {type: regex_replace, pattern: \"(\"}", "invalid pattern"},
+		{"bad template", "type: template\ntemplate: \"{{ .value \"", "transform template: invalid template"},
+		{"unknown template function", "type: template\ntemplate: \"{{ rot13 .value }}\"", "invalid template"},
+		{"bad base64 encoding", "- {type: base64_decode, encoding: base32}", "unknown base64 encoding"},
+		{"bad json path", "- {type: json, path: \"a..b\"}", "invalid JSON path"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tr Transform
+			if err := yaml.Unmarshal([]byte(tt.yaml), &tr); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if err := tr.Validate(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadValidatesTransformPipeline(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "test-config.yaml")
+	cfgText := `
+secrets:
+  - alias: db
+    provider: aws
+    name: app/db
+    transform:
+      - base64_decode
+      - type: json
+`
+	if err := os.WriteFile(configFile, []byte(cfgText), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Load(configFile)
+	if err == nil || !strings.Contains(err.Error(), `alias db: transform step 2 (json): option "path" is required`) {
+		t.Fatalf("Load() error = %v", err)
+	}
+}
+
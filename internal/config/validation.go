@@ -0,0 +1,369 @@
+package config
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Validation holds the rules a secret value must satisfy before it is used.
+type Validation struct {
+	Regex          string         `yaml:"regex"`           // Value must match this regular expression
+	MinLength      *int           `yaml:"min_length"`      // Minimum length in characters
+	MaxLength      *int           `yaml:"max_length"`      // Maximum length in characters
+	Trimmed        bool           `yaml:"trimmed"`         // No leading or trailing whitespace (including newlines)
+	JSON           bool           `yaml:"json"`            // Value must be valid JSON
+	JSONSchema     map[string]any `yaml:"json_schema"`     // Value must be JSON matching this schema (subset, see docs)
+	PEM            bool           `yaml:"pem"`             // Value must contain PEM certificates that are currently valid
+	URL            bool           `yaml:"url"`             // Value must be an absolute URL
+	NotPlaceholder bool           `yaml:"not_placeholder"` // Value must not be a known placeholder such as "changeme"
+	Placeholders   []string       `yaml:"placeholders"`    // Additional placeholder values to reject
+}
+
+// defaultPlaceholders are values that indicate a secret was never set.
+var defaultPlaceholders = []string{
+	"changeme", "change_me", "change-me", "changeit", "placeholder", "todo", "tbd", "fixme",
+	"xxx", "xxxx", "secret", "password", "example", "dummy", "default", "replaceme", "replace_me",
+	"<secret>", "<password>", "null", "none", "undefined",
+}
+
+// ValidationError reports a value that failed a validation rule. It never
+// contains the value.
+type ValidationError struct {
+	Rule   string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("validation failed (%s): %s", e.Rule, e.Reason)
+}
+
+func invalid(rule, format string, args ...any) error {
+	return &ValidationError{Rule: rule, Reason: fmt.Sprintf(format, args...)}
+}
+
+// CheckValue applies the secret's validation rules, if any, to value.
+func (s *Secret) CheckValue(value string) error {
+	if s.Validation == nil {
+		return nil
+	}
+	return s.Validation.Check(value)
+}
+
+// validate checks that the rules themselves are well-formed.
+func (v *Validation) validate() error {
+	if v.Regex != "" {
+		if _, err := regexp.Compile(v.Regex); err != nil {
+			return fmt.Errorf("validate.regex: %w", err)
+		}
+	}
+	if v.MinLength != nil && *v.MinLength < 0 {
+		return fmt.Errorf("validate.min_length must not be negative")
+	}
+	if v.MinLength != nil && v.MaxLength != nil && *v.MinLength > *v.MaxLength {
+		return fmt.Errorf("validate.min_length is greater than validate.max_length")
+	}
+	if v.JSONSchema != nil {
+		if err := checkSchema(v.JSONSchema, "$"); err != nil {
+			return fmt.Errorf("validate.json_schema: %w", err)
+		}
+	}
+	return nil
+}
+
+// Check applies every configured rule to value and returns the first
+// failure as a *ValidationError.
+func (v *Validation) Check(value string) error {
+	if v.NotPlaceholder || len(v.Placeholders) > 0 {
+		normalized := strings.ToLower(strings.TrimSpace(value))
+		for _, p := range append(append([]string{}, defaultPlaceholders...), v.Placeholders...) {
+			if normalized == strings.ToLower(strings.TrimSpace(p)) {
+				return invalid("not_placeholder", "value is a placeholder")
+			}
+		}
+	}
+	if v.Trimmed && strings.TrimFunc(value, unicode.IsSpace) != value {
+		return invalid("trimmed", "value has leading or trailing whitespace")
+	}
+	n := utf8.RuneCountInString(value)
+	if v.MinLength != nil && n < *v.MinLength {
+		return invalid("min_length", "length %d is less than %d", n, *v.MinLength)
+	}
+	if v.MaxLength != nil && n > *v.MaxLength {
+		return invalid("max_length", "length %d is greater than %d", n, *v.MaxLength)
+	}
+	if v.Regex != "" {
+		re, err := regexp.Compile(v.Regex)
+		if err != nil {
+			return invalid("regex", "invalid pattern: %v", err)
+		}
+		if !re.MatchString(value) {
+			return invalid("regex", "value does not match %s", v.Regex)
+		}
+	}
+	if v.JSON || v.JSONSchema != nil {
+		dec := json.NewDecoder(strings.NewReader(value))
+		dec.UseNumber()
+		var doc any
+		if err := dec.Decode(&doc); err != nil || dec.More() {
+			return invalid("json", "value is not valid JSON")
+		}
+		if v.JSONSchema != nil {
+			if err := matchSchema(v.JSONSchema, doc, "$"); err != nil {
+				return invalid("json_schema", "%v", err)
+			}
+		}
+	}
+	if v.URL {
+		u, err := url.Parse(strings.TrimSpace(value))
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return invalid("url", "value is not an absolute URL")
+		}
+	}
+	if v.PEM {
+		if err := checkPEM(value, time.Now()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPEM requires at least one certificate and that every certificate is
+// within its validity period.
+func checkPEM(value string, now time.Time) error {
+	rest := []byte(value)
+	certs := 0
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return invalid("pem", "certificate %d cannot be parsed", certs+1)
+		}
+		certs++
+		if now.Before(cert.NotBefore) {
+			return invalid("pem", "certificate %d (%s) is not valid before %s", certs, cert.Subject.CommonName, cert.NotBefore.UTC().Format(time.RFC3339))
+		}
+		if now.After(cert.NotAfter) {
+			return invalid("pem", "certificate %d (%s) expired at %s", certs, cert.Subject.CommonName, cert.NotAfter.UTC().Format(time.RFC3339))
+		}
+	}
+	if certs == 0 {
+		return invalid("pem", "no PEM certificate found")
+	}
+	return nil
+}
+
+// schemaKeywords are the JSON Schema keywords understood by matchSchema.
+var schemaKeywords = map[string]bool{
+	"type": true, "required": true, "properties": true, "additionalProperties": true,
+	"items": true, "enum": true, "minLength": true, "maxLength": true, "pattern": true,
+	"minimum": true, "maximum": true, "minItems": true, "maxItems": true,
+	"$schema": true, "title": true, "description": true,
+}
+
+// checkSchema rejects keywords and shapes that matchSchema does not support,
+// so that a typo does not silently disable a rule.
+func checkSchema(schema map[string]any, at string) error {
+	for k, v := range schema {
+		if !schemaKeywords[k] {
+			return fmt.Errorf("%s: unsupported keyword %q", at, k)
+		}
+		switch k {
+		case "properties":
+			props, ok := v.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s: properties must be a mapping", at)
+			}
+			for name, p := range props {
+				sub, ok := p.(map[string]any)
+				if !ok {
+					return fmt.Errorf("%s.%s: schema must be a mapping", at, name)
+				}
+				if err := checkSchema(sub, at+"."+name); err != nil {
+					return err
+				}
+			}
+		case "items":
+			sub, ok := v.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s: items must be a mapping", at)
+			}
+			if err := checkSchema(sub, at+"[]"); err != nil {
+				return err
+			}
+		case "pattern":
+			s, _ := v.(string)
+			if _, err := regexp.Compile(s); err != nil {
+				return fmt.Errorf("%s: pattern: %w", at, err)
+			}
+		case "type":
+			for _, t := range schemaTypes(v) {
+				switch t {
+				case "string", "number", "integer", "boolean", "object", "array", "null":
+				default:
+					return fmt.Errorf("%s: unknown type %q", at, t)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func schemaTypes(v any) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []any:
+		out := make([]string, 0, len(t))
+		for _, x := range t {
+			s, _ := x.(string)
+			out = append(out, s)
+		}
+		return out
+	}
+	return nil
+}
+
+// matchSchema validates doc against a subset of JSON Schema. Errors name the
+// location and rule but never the offending value.
+func matchSchema(schema map[string]any, doc any, at string) error {
+	if types, ok := schema["type"]; ok {
+		matched := false
+		for _, t := range schemaTypes(types) {
+			if jsonType(doc, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: expected type %v", at, types)
+		}
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if fmt.Sprint(e) == fmt.Sprint(doc) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: value is not one of the allowed values", at)
+		}
+	}
+	switch d := doc.(type) {
+	case string:
+		n := utf8.RuneCountInString(d)
+		if m, ok := schemaNumber(schema["minLength"]); ok && float64(n) < m {
+			return fmt.Errorf("%s: shorter than minLength", at)
+		}
+		if m, ok := schemaNumber(schema["maxLength"]); ok && float64(n) > m {
+			return fmt.Errorf("%s: longer than maxLength", at)
+		}
+		if p, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(p); err != nil || !re.MatchString(d) {
+				return fmt.Errorf("%s: does not match pattern %s", at, p)
+			}
+		}
+	case json.Number:
+		f, err := d.Float64()
+		if err != nil {
+			return fmt.Errorf("%s: invalid number", at)
+		}
+		if m, ok := schemaNumber(schema["minimum"]); ok && f < m {
+			return fmt.Errorf("%s: less than minimum", at)
+		}
+		if m, ok := schemaNumber(schema["maximum"]); ok && f > m {
+			return fmt.Errorf("%s: greater than maximum", at)
+		}
+	case map[string]any:
+		if req, ok := schema["required"].([]any); ok {
+			for _, r := range req {
+				name, _ := r.(string)
+				if _, ok := d[name]; !ok {
+					return fmt.Errorf("%s: missing required property %q", at, name)
+				}
+			}
+		}
+		props, _ := schema["properties"].(map[string]any)
+		for name, val := range d {
+			sub, ok := props[name].(map[string]any)
+			if !ok {
+				if extra, ok := schema["additionalProperties"].(bool); ok && !extra {
+					return fmt.Errorf("%s: unexpected property %q", at, name)
+				}
+				continue
+			}
+			if err := matchSchema(sub, val, at+"."+name); err != nil {
+				return err
+			}
+		}
+	case []any:
+		if m, ok := schemaNumber(schema["minItems"]); ok && float64(len(d)) < m {
+			return fmt.Errorf("%s: fewer than minItems", at)
+		}
+		if m, ok := schemaNumber(schema["maxItems"]); ok && float64(len(d)) > m {
+			return fmt.Errorf("%s: more than maxItems", at)
+		}
+		if sub, ok := schema["items"].(map[string]any); ok {
+			for i, item := range d {
+				if err := matchSchema(sub, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func jsonType(doc any, t string) bool {
+	switch d := doc.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case string:
+		return t == "string"
+	case json.Number:
+		if t == "number" {
+			return true
+		}
+		f, err := d.Float64()
+		return t == "integer" && err == nil && f == math.Trunc(f)
+	case map[string]any:
+		return t == "object"
+	case []any:
+		return t == "array"
+	}
+	return false
+}
+
+func schemaNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func testCertPEM(t *testing.T, notBefore, notAfter time.Time) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestValidationCheck(t *testing.T) {
+	now := time.Now()
+	validCert := testCertPEM(t, now.Add(-time.Hour), now.Add(time.Hour))
+	expiredCert := testCertPEM(t, now.Add(-2*time.Hour), now.Add(-time.Hour))
+
+	tests := []struct {
+		name     string
+		rules    string
+		value    string
+		wantRule string // empty means the value is valid
+	}{
+		{"regex match", "regex: '^sk_[a-z0-9]+$'", "sk_abc123", ""},
+		{"regex mismatch", "regex: '^sk_'", "pk_abc", "regex"},
+		{"min length", "min_length: 8", "short", "min_length"},
+		{"max length", "max_length: 3", "toolong", "max_length"},
+		{"length counts characters", "max_length: 2", "éé", ""},
+		{"trailing newline", "trimmed: true", "tok3n\n", "trimmed"},
+		{"trimmed ok", "trimmed: true", "value", ""},
+		{"placeholder", "not_placeholder: true", " ChangeMe ", "not_placeholder"},
+		{"custom placeholder", "placeholders: [fill-me-in]", "FILL-ME-IN", "not_placeholder"},
+		{"not a placeholder", "not_placeholder: true", "d8f7a6b5", ""},
+		{"json ok", "json: true", `{"a":1}`, ""},
+		{"json invalid", "json: true", `{"a":`, "json"},
+		{"json trailing data", "json: true", `{} {}`, "json"},
+		{"url ok", "url: true", "postgres://db.internal:5432/app", ""},
+		{"url without scheme", "url: true", "db.internal:5432", "url"},
+		{"pem valid", "pem: true", validCert, ""},
+		{"pem expired", "pem: true", expiredCert, "pem"},
+		{"pem garbage", "pem: true", "not a cert", "pem"},
+		{
+			"schema ok",
+			"json_schema: {type: object, required: [user, port], properties: {user: {type: string, minLength: 1}, port: {type: integer, minimum: 1, maximum: 65535}}}",
+			`{"user":"app","port":5432}`,
+			"",
+		},
+		{
+			"schema missing property",
+			"json_schema: {type: object, required: [user]}",
+			`{"port":5432}`,
+			"json_schema",
+		},
+		{
+			"schema wrong type",
+			"json_schema: {type: object, properties: {port: {type: integer}}}",
+			`{"port":"5432"}`,
+			"json_schema",
+		},
+		{
+			"schema enum and items",
+			"json_schema: {type: array, minItems: 1, items: {enum: [read, write]}}",
+			`["read","admin"]`,
+			"json_schema",
+		},
+		{
+			"schema additional properties",
+			"json_schema: {type: object, additionalProperties: false, properties: {a: {}}}",
+			`{"a":1,"b":2}`,
+			"json_schema",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v Validation
+			if err := yaml.Unmarshal([]byte(tt.rules), &v); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if err := v.validate(); err != nil {
+				t.Fatalf("validate() = %v", err)
+			}
+			err := v.Check(tt.value)
+			if tt.wantRule == "" {
+				if err != nil {
+					t.Fatalf("Check() = %v", err)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) || verr.Rule != tt.wantRule {
+				t.Fatalf("Check() = %v, want rule %s", err, tt.wantRule)
+			}
+			if strings.TrimSpace(tt.value) != "" && strings.Contains(err.Error(), strings.TrimSpace(tt.value)) {
+				t.Errorf("error must not contain the value: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidationRulesInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		wantErr string
+	}{
+		{"bad regex", "regex: '('", "validate.regex"},
+		{"min greater than max", "{min_length: 5, max_length: 2}", "greater than"},
+		{"unsupported schema keyword", "json_schema: {type: object, oneOf: []}", `unsupported keyword "oneOf"`},
+		{"unknown schema type", "json_schema: {properties: {a: {type: text}}}", `$.a: unknown type "text"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v Validation
+			if err := yaml.Unmarshal([]byte(tt.rules), &v); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if err := v.validate(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validate() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// WatchConfig holds settings for `skv watch`.
+type WatchConfig struct {
+	TagIntervals map[string]string `yaml:"tag_intervals"` // Poll interval per tag, e.g. {db: 1m}
+}
+
+func (w WatchConfig) validate() error {
+	for tag, v := range w.TagIntervals {
+		if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+			return fmt.Errorf("watch.tag_intervals.%s: invalid interval %q", tag, v)
+		}
+	}
+	return nil
+}
+
+// WatchInterval returns the poll interval configured for s: its own
+// watch_interval, else the shortest interval of its tags. ok is false when
+// neither is set.
+func (c *Config) WatchInterval(s *Secret) (d time.Duration, ok bool) {
+	if s.WatchInterval != "" {
+		d, err := time.ParseDuration(s.WatchInterval)
+		return d, err == nil
+	}
+	for _, tag := range s.Tags {
+		v, found := c.Watch.TagIntervals[tag]
+		if !found {
+			continue
+		}
+		if td, err := time.ParseDuration(v); err == nil && (!ok || td < d) {
+			d, ok = td, true
+		}
+	}
+	return d, ok
+}
+
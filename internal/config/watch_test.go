@@ -0,0 +1,73 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchInterval(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "test-config.yaml")
+	cfgText := `
+watch:
+  tag_intervals:
+    db: 1m
+    critical: 10s
+secrets:
+  - alias: own
+    provider: aws
+    name: own
+    tags: [db]
+    watch_interval: 5m
+  - alias: tagged
+    provider: aws
+    name: tagged
+    tags: [db, critical]
+  - alias: plain
+    provider: aws
+    name: plain
+`
+	if err := os.WriteFile(configFile, []byte(cfgText), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(configFile)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	tests := []struct {
+		alias string
+		want  time.Duration
+		ok    bool
+	}{
+		{"own", 5 * time.Minute, true},
+		{"tagged", 10 * time.Second, true},
+		{"plain", 0, false},
+	}
+	for _, tt := range tests {
+		s, _ := cfg.FindByAlias(tt.alias)
+		if got, ok := cfg.WatchInterval(s); got != tt.want || ok != tt.ok {
+			t.Errorf("WatchInterval(%s) = %v, %v; want %v, %v", tt.alias, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	invalid := []struct {
+		name, cfg, want string
+	}{
+		{"secret interval", "secrets:\n  - alias: a\n    provider: aws\n    name: a\n    watch_interval: soon\n", "invalid watch_interval"},
+		{"zero secret interval", "secrets:\n  - alias: a\n    provider: aws\n    name: a\n    watch_interval: 0s\n", "invalid watch_interval"},
+		{"tag interval", "watch:\n  tag_intervals:\n    db: -1m\nsecrets:\n  - alias: a\n    provider: aws\n    name: a\n", "watch.tag_intervals.db"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(configFile, []byte(tt.cfg), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Load(configFile); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Load() = %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
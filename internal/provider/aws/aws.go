@@ -59,6 +59,9 @@ func (a *awsProvider) FetchSecret(ctx context.Context, spec provider.SecretSpec)
 		if errors.As(err, &rnfe) {
 			return "", provider.ErrNotFound
 		}
+		if terr := asThrottled(err); terr != nil {
+			err = terr
+		}
 		return "", fmt.Errorf("aws get secret: %w", err)
 	}
 	if out.SecretString != nil {
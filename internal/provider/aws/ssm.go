@@ -55,6 +55,9 @@ func (p *ssmProvider) FetchSecret(ctx context.Context, spec provider.SecretSpec)
 				return "", provider.ErrNotFound
 			}
 		}
+		if terr := asThrottled(err); terr != nil {
+			err = terr
+		}
 		return "", fmt.Errorf("aws ssm get parameter: %w", err)
 	}
 	if out.Parameter == nil || out.Parameter.Value == nil {
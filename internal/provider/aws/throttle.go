@@ -0,0 +1,37 @@
+package aws
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"skv/internal/provider"
+)
+
+// throttleCodes are the API error codes AWS services use for rate limiting.
+var throttleCodes = map[string]bool{
+	"Throttling":                true,
+	"ThrottlingException":       true,
+	"ThrottledException":        true,
+	"TooManyRequestsException":  true,
+	"RequestLimitExceeded":      true,
+	"RequestThrottled":          true,
+	"RequestThrottledException": true,
+}
+
+// asThrottled returns err as a *provider.ThrottledError when AWS rejected
+// the request because of a rate limit, or nil otherwise.
+func asThrottled(err error) error {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) || !throttleCodes[apiErr.ErrorCode()] {
+		return nil
+	}
+	te := &provider.ThrottledError{Err: err}
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) && respErr.Response != nil && respErr.Response.Response != nil {
+		te.RetryAfter = provider.ParseRetryAfter(respErr.Response.Header, time.Now())
+	}
+	return te
+}
+
@@ -51,6 +51,9 @@ func (a *appConfigProvider) FetchSecret(ctx context.Context, spec provider.Secre
 	val, err := appcfgGet(ctx, endpoint, key, label)
 	if err != nil {
 		// No clean not-found mapping in SDK; surface error
+		if terr := asThrottled(err); terr != nil {
+			err = terr
+		}
 		return "", fmt.Errorf("azure appconfig get: %w", err)
 	}
 	return val, nil
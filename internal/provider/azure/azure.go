@@ -48,6 +48,9 @@ func (a *azureProvider) FetchSecret(ctx context.Context, spec provider.SecretSpe
 				return "", provider.ErrNotFound
 			}
 		}
+		if terr := asThrottled(err); terr != nil {
+			err = terr
+		}
 		return "", fmt.Errorf("azure: get secret: %w", err)
 	}
 	if resp.Value == nil {
@@ -0,0 +1,25 @@
+package azure
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"skv/internal/provider"
+)
+
+// asThrottled returns err as a *provider.ThrottledError when Azure answered
+// 429 Too Many Requests, or nil otherwise.
+func asThrottled(err error) error {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) || respErr.StatusCode != http.StatusTooManyRequests {
+		return nil
+	}
+	te := &provider.ThrottledError{Err: err}
+	if respErr.RawResponse != nil {
+		te.RetryAfter = provider.ParseRetryAfter(respErr.RawResponse.Header, time.Now())
+	}
+	return te
+}
+
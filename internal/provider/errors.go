@@ -1,7 +1,48 @@
 package provider
 
-import "errors"
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // ErrNotFound indicates the requested secret does not exist in the provider.
 var ErrNotFound = errors.New("secret not found")
 
+// ThrottledError indicates the provider rejected a request because of a
+// rate limit. RetryAfter is the delay the backend asked for, or 0.
+type ThrottledError struct {
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *ThrottledError) Error() string {
+	if e.RetryAfter > 0 {
+		return "throttled (retry after " + e.RetryAfter.String() + "): " + e.Err.Error()
+	}
+	return "throttled: " + e.Err.Error()
+}
+
+func (e *ThrottledError) Unwrap() error { return e.Err }
+
+// ParseRetryAfter parses a Retry-After header: a number of seconds or an
+// HTTP date. It returns 0 for missing or invalid values.
+func ParseRetryAfter(h http.Header, now time.Time) time.Duration {
+	v := strings.TrimSpace(h.Get("Retry-After"))
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
@@ -0,0 +1,46 @@
+package provider
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name, header string
+		want         time.Duration
+	}{
+		{"missing", "", 0},
+		{"seconds", "7", 7 * time.Second},
+		{"negative seconds", "-3", 0},
+		{"http date", now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{"date in the past", now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"invalid", "soon", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			if tt.header != "" {
+				h.Set("Retry-After", tt.header)
+			}
+			if got := ParseRetryAfter(h, now); got != tt.want {
+				t.Errorf("ParseRetryAfter(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThrottledError(t *testing.T) {
+	base := errors.New("rate exceeded")
+	err := error(&ThrottledError{RetryAfter: 2 * time.Second, Err: base})
+	if !errors.Is(err, base) {
+		t.Error("ThrottledError does not unwrap to its cause")
+	}
+	if got, want := err.Error(), "throttled (retry after 2s): rate exceeded"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
@@ -20,10 +20,19 @@ import (
 // - env: optional CSV of k=v entries to extend env
 // - trim: optional "true" to trim whitespace from stdout
 // The secret name (spec.Name) is appended as the last argument.
-type execProvider struct{}
+type execProvider struct {
+	run Runner
+}
+
+// Runner starts a command and waits for it to exit, like (*exec.Cmd).Run.
+type Runner func(*exec.Cmd) error
 
 // New returns a new exec-based provider.
-func New() provider.Provider { return &execProvider{} }
+func New() provider.Provider { return &execProvider{run: (*exec.Cmd).Run} }
+
+// NewWithRunner returns an exec-based provider that runs commands with run,
+// for callers that must see the exit of every child process themselves.
+func NewWithRunner(run Runner) provider.Provider { return &execProvider{run: run} }
 
 func (e *execProvider) FetchSecret(ctx context.Context, spec provider.SecretSpec) (string, error) {
 	command := strings.TrimSpace(spec.Extras["cmd"])
@@ -66,7 +75,7 @@ func (e *execProvider) FetchSecret(ctx context.Context, spec provider.SecretSpec
 		}
 		c.Env = env
 	}
-	if err := c.Run(); err != nil {
+	if err := e.run(c); err != nil {
 		if stderr.Len() > 0 {
 			return "", fmt.Errorf("exec provider: %v: %s", err, strings.TrimSpace(stderr.String()))
 		}
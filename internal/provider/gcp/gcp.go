@@ -56,6 +56,9 @@ func (g *gcpProvider) FetchSecret(ctx context.Context, spec provider.SecretSpec)
 		if ok && (st.Code() == codes.NotFound || st.Code() == codes.PermissionDenied) {
 			return "", provider.ErrNotFound
 		}
+		if ok && st.Code() == codes.ResourceExhausted {
+			err = &provider.ThrottledError{Err: err}
+		}
 		return "", fmt.Errorf("gcp: access secret: %w", err)
 	}
 	if res.Payload == nil || res.Payload.Data == nil {
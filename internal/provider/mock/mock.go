@@ -6,6 +6,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"skv/internal/provider"
 )
@@ -19,8 +20,16 @@ func New() provider.Provider { return &mockProvider{} }
 // - value: returned as secret value
 // - not_found: "true" to return provider.ErrNotFound
 // - error: non-empty string to return an error with that message
+// - delay: duration to wait before answering, honoring ctx cancellation
 // If none provided, returns spec.Name as value.
-func (m *mockProvider) FetchSecret(_ context.Context, spec provider.SecretSpec) (string, error) {
+func (m *mockProvider) FetchSecret(ctx context.Context, spec provider.SecretSpec) (string, error) {
+	if d, err := time.ParseDuration(spec.Extras["delay"]); err == nil && d > 0 {
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
 	if strings.EqualFold(spec.Extras["not_found"], "true") {
 		return "", provider.ErrNotFound
 	}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"strings"
 	"testing"
+	"time"
 
 	"skv/internal/provider"
 )
@@ -164,3 +165,17 @@ func TestMockProvider_ErrorHandling(t *testing.T) {
 	}
 }
 
+func TestMockProvider_DelayHonorsContext(t *testing.T) {
+	p := New()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	spec := provider.SecretSpec{
+		Name:   "slow",
+		Extras: map[string]string{"delay": "1s"},
+	}
+	if _, err := p.FetchSecret(ctx, spec); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
@@ -3,6 +3,8 @@ package provider
 
 import (
 	"context"
+	"log/slog"
+	"sort"
 )
 
 // Provider fetches a secret value by spec.
@@ -19,6 +21,41 @@ type SecretSpec struct {
 	Extras   map[string]string // Provider-specific configuration options
 }
 
+// publicExtras lists extras keys whose values are safe to show in logs:
+// fixed-shape identifiers only. Everything else is redacted because it may
+// carry a credential, including free-form values such as commands, paths
+// and URLs, which can embed one.
+var publicExtras = map[string]struct{}{
+	"region": {}, "profile": {}, "project": {}, "label": {}, "namespace": {},
+	"mount": {}, "key": {}, "version": {}, "version_stage": {}, "version_id": {},
+	"trim": {},
+}
+
+// LogValue implements slog.LogValuer so a spec can be logged without
+// leaking credentials passed through extras.
+func (s SecretSpec) LogValue() slog.Value {
+	keys := make([]string, 0, len(s.Extras))
+	for k := range s.Extras {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	extras := make([]slog.Attr, 0, len(keys))
+	for _, k := range keys {
+		v := s.Extras[k]
+		if _, ok := publicExtras[k]; !ok && v != "" {
+			v = "[REDACTED]"
+		}
+		extras = append(extras, slog.String(k, v))
+	}
+	return slog.GroupValue(
+		slog.String("alias", s.Alias),
+		slog.String("provider", s.Provider),
+		slog.String("name", s.Name),
+		slog.String("env", s.EnvName),
+		slog.Attr{Key: "extras", Value: slog.GroupValue(extras...)},
+	)
+}
+
 // Global registry of available providers
 var registry = map[string]Provider{}
 
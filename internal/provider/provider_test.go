@@ -1,7 +1,10 @@
 package provider
 
 import (
+	"bytes"
 	"context"
+	"log/slog"
+	"strings"
 	"testing"
 )
 
@@ -90,3 +93,43 @@ func BenchmarkSecretSpecCreation(b *testing.B) {
 	})
 }
 
+func TestSecretSpecLogValueRedacts(t *testing.T) {
+	tests := []struct {
+		name   string
+		extras map[string]string
+		shown  []string
+		hidden []string
+	}{
+		{
+			name:   "credentials",
+			extras: map[string]string{"token": "s.abc123", "secret_id": "xyz789", "region": "us-east-1"},
+			shown:  []string{"us-east-1", "[REDACTED]"},
+			hidden: []string{"s.abc123", "xyz789"},
+		},
+		{
+			name:   "free-form extras",
+			extras: map[string]string{"cmd": "fetch --token=hunter2", "address": "https://user:pw@vault:8200", "mount": "kv"},
+			shown:  []string{"mount=kv"},
+			hidden: []string{"hunter2", "user:pw"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&buf, nil))
+			logger.Info("fetch", "spec", SecretSpec{Alias: "db", Provider: "vault", Extras: tt.extras})
+			out := buf.String()
+			for _, s := range tt.hidden {
+				if strings.Contains(out, s) {
+					t.Errorf("%q leaked into log: %s", s, out)
+				}
+			}
+			for _, s := range tt.shown {
+				if !strings.Contains(out, s) {
+					t.Errorf("log output lacks %q: %s", s, out)
+				}
+			}
+		})
+	}
+}
+
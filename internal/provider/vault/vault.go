@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 
 	vaultapi "github.com/hashicorp/vault/api"
@@ -65,6 +66,10 @@ func (v *vaultProvider) FetchSecret(ctx context.Context, spec provider.SecretSpe
 	logical := client.Logical()
 	s, err2 := logical.ReadWithContext(ctx, spec.Name)
 	if err2 != nil {
+		var respErr *vaultapi.ResponseError
+		if errors.As(err2, &respErr) && respErr.StatusCode == http.StatusTooManyRequests {
+			err2 = &provider.ThrottledError{Err: err2}
+		}
 		return "", fmt.Errorf("vault read: %w", err2)
 	}
 	if s == nil {